@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/user"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Annotations recording who has a tunnel open into a pod, visible in kubectl describe pod
+const (
+	forwardedByAnnotation = "bugx.io/forwarded-by"
+	forwardedAtAnnotation = "bugx.io/forwarded-at"
+)
+
+// forwardedBy identifies the local user as user@host
+func forwardedBy() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return name
+	}
+	return name + "@" + host
+}
+
+// patchPodAnnotations merge-patches the forwarding annotations of a pod; nil values remove them
+func patchPodAnnotations(clientset *kubernetes.Clientset, namespace, podName string, by, at interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				forwardedByAnnotation: by,
+				forwardedAtAnnotation: at,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = clientset.CoreV1().Pods(namespace).Patch(context.TODO(), podName, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// annotatePod marks a pod as having a tunnel open. Failures, including RBAC denials,
+// are reported as warnings since the tunnel works without the annotation.
+func annotatePod(clientset *kubernetes.Clientset, namespace, podName string) {
+	err := patchPodAnnotations(clientset, namespace, podName, forwardedBy(), timeSource.Now().UTC().Format(time.RFC3339))
+	switch {
+	case err == nil:
+	case apierrors.IsForbidden(err):
+		warnf("not allowed to annotate pod %s/%s, continuing without the annotation", namespace, podName)
+	default:
+		warnf("failed to annotate pod %s/%s: %v", namespace, podName, err)
+	}
+}
+
+// unannotatePod removes the annotations added by annotatePod. A pod that is already gone is not an error.
+func unannotatePod(clientset *kubernetes.Clientset, namespace, podName string) {
+	err := patchPodAnnotations(clientset, namespace, podName, nil, nil)
+	switch {
+	case err == nil, apierrors.IsNotFound(err):
+	case apierrors.IsForbidden(err):
+		warnf("not allowed to remove the annotation from pod %s/%s", namespace, podName)
+	default:
+		warnf("failed to remove the annotation from pod %s/%s: %v", namespace, podName, err)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import "time"
+
+// Default circuit breaker settings of connect --follow and of background daemons
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerWindow   = time.Minute
+	defaultBreakerCooldown = 5 * time.Minute
+)
+
+// BreakerSettings are the circuit breaker settings recorded with a background connection
+// (connect --breaker-failures, --breaker-window, --breaker-cooldown)
+type BreakerSettings struct {
+	Failures int           `json:"failures"`
+	Window   time.Duration `json:"window"`
+	Cooldown time.Duration `json:"cooldown"`
+}
+
+// circuitBreaker keeps a reconnect loop from hammering a dead cluster: once failures
+// consecutive attempts have failed within window it opens, and no attempt is made
+// until cooldown has passed. A successful attempt closes it again.
+type circuitBreaker struct {
+	failures int // 0 disables the breaker
+	window   time.Duration
+	cooldown time.Duration
+
+	recent    []time.Time // times of the consecutive failures still within the window
+	openUntil time.Time
+}
+
+// failure records a failed attempt now and reports whether it opened the breaker
+func (b *circuitBreaker) failure() bool {
+	if b.failures <= 0 {
+		return false
+	}
+	now := timeSource.Now()
+
+	b.recent = append(b.recent, now)
+	expired := 0
+	for expired < len(b.recent) && now.Sub(b.recent[expired]) > b.window {
+		expired++
+	}
+	b.recent = b.recent[expired:]
+
+	if len(b.recent) < b.failures {
+		return false
+	}
+	b.recent = nil
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// success records a successful attempt, closing the breaker
+func (b *circuitBreaker) success() {
+	b.recent = nil
+	b.openUntil = time.Time{}
+}
+
+// wait returns how long from now the breaker still refuses attempts
+func (b *circuitBreaker) wait() time.Duration {
+	if now := timeSource.Now(); now.Before(b.openUntil) {
+		return b.openUntil.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAndCoolsDown(t *testing.T) {
+	fake := useFakeClock(t)
+	breaker := &circuitBreaker{failures: 3, window: time.Minute, cooldown: 5 * time.Minute}
+
+	if breaker.failure() || breaker.failure() {
+		t.Fatalf("breaker opened before 3 failures")
+	}
+	fake.Advance(10 * time.Second)
+	if !breaker.failure() {
+		t.Fatalf("breaker did not open on the 3rd failure within the window")
+	}
+	if wait := breaker.wait(); wait != 5*time.Minute {
+		t.Fatalf("wait() = %s right after opening, want 5m", wait)
+	}
+
+	fake.Advance(4 * time.Minute)
+	if wait := breaker.wait(); wait != time.Minute {
+		t.Fatalf("wait() = %s 4m into the cooldown, want 1m", wait)
+	}
+	fake.Advance(time.Minute)
+	if wait := breaker.wait(); wait != 0 {
+		t.Fatalf("wait() = %s after the cooldown, want 0", wait)
+	}
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	fake := useFakeClock(t)
+	breaker := &circuitBreaker{failures: 3, window: time.Minute, cooldown: time.Minute}
+
+	// Failures spread wider than the window never add up to 3
+	for i := 0; i < 5; i++ {
+		if breaker.failure() {
+			t.Fatalf("breaker opened on failure %d although only 2 fall within the window", i+1)
+		}
+		fake.Advance(31 * time.Second)
+	}
+}
+
+func TestCircuitBreakerSuccessResets(t *testing.T) {
+	useFakeClock(t)
+	breaker := &circuitBreaker{failures: 2, window: time.Minute, cooldown: time.Minute}
+
+	breaker.failure()
+	breaker.success()
+	if breaker.failure() {
+		t.Fatalf("breaker counted a failure from before a success")
+	}
+	if !breaker.failure() {
+		t.Fatalf("breaker did not open on 2 consecutive failures")
+	}
+	breaker.success()
+	if wait := breaker.wait(); wait != 0 {
+		t.Fatalf("wait() = %s after a success, want 0", wait)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	useFakeClock(t)
+	breaker := &circuitBreaker{failures: 0, window: time.Minute, cooldown: time.Minute}
+	for i := 0; i < 10; i++ {
+		if breaker.failure() {
+			t.Fatalf("disabled breaker opened")
+		}
+	}
+}
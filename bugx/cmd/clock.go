@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+)
+
+// clock is a source of the current time, timeouts and tickers, so code that depends on
+// wall-clock time (uptimes, TTLs, retry backoff, the daemon's periodic work) can be driven
+// by a fake one
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker delivers ticks on C every period until stopped, like time.Ticker
+type ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// timeSource is the clock used by the daemon, reconnect loops and connection timestamps
+var timeSource clock = realClock{}
+
+// realClock is the system clock
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) ticker       { return realTicker{time.NewTicker(d)} }
+
+// realTicker is a time.Ticker
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// timeSince returns the time elapsed since t according to timeSource
+func timeSince(t time.Time) time.Duration {
+	return timeSource.Now().Sub(t)
+}
+
+// fakeClock is a clock that only moves when advanced, for tests. Channels returned by After
+// receive once the clock has been advanced to or past their deadline, and tickers tick once
+// per Advance that crosses one or more of their periods (extra ticks are dropped, as with
+// time.Ticker).
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	tickers []*fakeTicker
+}
+
+// fakeWaiter is a pending After of a fakeClock
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// fakeTicker is a ticker of a fakeClock
+type fakeTicker struct {
+	clock  *fakeClock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+// newFakeClock returns a fake clock set to now
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	if d <= 0 {
+		panic("non-positive interval for fakeClock.NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{clock: c, period: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the After channels and tickers that are due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+
+	pending := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(c.now) {
+			pending = append(pending, waiter)
+			continue
+		}
+		waiter.ch <- c.now
+	}
+	c.waiters = pending
+
+	for _, t := range c.tickers {
+		if t.next.After(c.now) {
+			continue
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+	}
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// useFakeClock makes timeSource a fake clock for the duration of the test
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	fake := newFakeClock(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	previous := timeSource
+	timeSource = fake
+	t.Cleanup(func() { timeSource = previous })
+	return fake
+}
+
+// received reports whether ch has a value ready
+func received(ch <-chan time.Time) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFakeClockAfter(t *testing.T) {
+	fake := useFakeClock(t)
+
+	soon, later := timeSource.After(time.Minute), timeSource.After(time.Hour)
+	fake.Advance(59 * time.Second)
+	if received(soon) {
+		t.Fatalf("After(1m) fired after 59s")
+	}
+	fake.Advance(time.Second)
+	if !received(soon) {
+		t.Fatalf("After(1m) did not fire after 1m")
+	}
+	if received(later) {
+		t.Fatalf("After(1h) fired after 1m")
+	}
+	if !received(timeSource.After(0)) {
+		t.Fatalf("After(0) did not fire at once")
+	}
+}
+
+func TestFakeClockTicker(t *testing.T) {
+	fake := useFakeClock(t)
+
+	ticker := timeSource.NewTicker(30 * time.Second)
+	fake.Advance(29 * time.Second)
+	if received(ticker.C()) {
+		t.Fatalf("ticker fired before its period")
+	}
+	fake.Advance(time.Second)
+	if !received(ticker.C()) {
+		t.Fatalf("ticker did not fire after its period")
+	}
+
+	// Missed ticks are dropped, as with time.Ticker
+	fake.Advance(2 * time.Minute)
+	if !received(ticker.C()) || received(ticker.C()) {
+		t.Fatalf("ticker did not deliver exactly one tick for several missed periods")
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Minute)
+	if received(ticker.C()) {
+		t.Fatalf("stopped ticker fired")
+	}
+}
+
+// advanceUntil advances the fake clock by step until done receives, failing after a
+// real-time bound so a wait that ignores timeSource cannot hang the test
+func advanceUntil[T any](t *testing.T, fake *fakeClock, step time.Duration, done <-chan T) T {
+	t.Helper()
+	bound := time.After(10 * time.Second)
+	for {
+		select {
+		case value := <-done:
+			return value
+		case <-bound:
+			t.Fatalf("wait did not finish after advancing the fake clock to %s", fake.Now())
+		case <-time.After(time.Millisecond):
+			fake.Advance(step)
+		}
+	}
+}
+
+func TestWaitForExitUsesTimeSource(t *testing.T) {
+	fake := useFakeClock(t)
+	start := fake.Now()
+
+	done := make(chan bool, 1)
+	go func() { done <- waitForExit(os.Getpid(), time.Minute) }()
+	if exited := advanceUntil(t, fake, time.Second, done); exited {
+		t.Errorf("waitForExit() = true for a running process")
+	}
+	if elapsed := fake.Now().Sub(start); elapsed < time.Minute {
+		t.Errorf("waitForExit() gave up after %s of fake time, want the 1m timeout", elapsed)
+	}
+}
+
+func TestGetServiceWaitingUsesTimeSource(t *testing.T) {
+	fake := useFakeClock(t)
+	previousOutput := output
+	output = io.Discard
+	t.Cleanup(func() { output = previousOutput })
+	clientset := k8sfake.NewClientset()
+
+	type result struct {
+		svc *corev1.Service
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		svc, err := getServiceWaiting(clientset, "app", "web", time.Minute)
+		done <- result{svc, err}
+	}()
+	fake.Advance(timings.RetryInterval)
+	if _, err := clientset.CoreV1().Services("app").Create(context.TODO(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web"}}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := advanceUntil(t, fake, timings.RetryInterval, done); got.err != nil || got.svc.Name != "web" {
+		t.Errorf("getServiceWaiting() = %v, %v, want the created service", got.svc, got.err)
+	}
+
+	go func() {
+		svc, err := getServiceWaiting(clientset, "app", "missing", time.Minute)
+		done <- result{svc, err}
+	}()
+	if got := advanceUntil(t, fake, timings.RetryInterval, done); ExitCode(got.err) != ExitNotFound {
+		t.Errorf("getServiceWaiting() for a missing service = %v, want not found after the timeout", got.err)
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// completionTimeout bounds the API requests made while completing on the command line
+const completionTimeout = 3 * time.Second
+
+// NewCompletionCmd creates the completion command
+func NewCompletionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion",
+		Short: "Generate shell completion scripts",
+		Long: `Generate the completion script for bash, zsh, fish or powershell.
+Besides commands and flags, service names, namespaces and connections are
+completed from the cluster and the recorded connections.
+
+  source <(bugx completion bash)
+  source <(bugx completion zsh)
+  bugx completion fish | source
+  bugx completion powershell | Out-String | Invoke-Expression`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "bash",
+		Short: "Generate the bash completion script (needs bash-completion v2)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Root().GenBashCompletionV2(cmd.OutOrStdout(), true)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "zsh",
+		Short: "Generate the zsh completion script",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Root().GenZshCompletion(cmd.OutOrStdout())
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "fish",
+		Short: "Generate the fish completion script",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Root().GenFishCompletion(cmd.OutOrStdout(), true)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "powershell",
+		Short: "Generate the powershell completion script",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Root().GenPowerShellCompletionWithDesc(cmd.OutOrStdout())
+		},
+	})
+
+	return cmd
+}
+
+// completionClientset returns a clientset for the --kubeconfig of the command being completed.
+// Completion does not run the root's pre-run, so the profile is loaded here.
+func completionClientset(cmd *cobra.Command) (*kubernetes.Clientset, bool) {
+	if profile, _ := cmd.Flags().GetString("profile"); activeProfile == nil {
+		loadActiveProfile(profile)
+	}
+	kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+	kubeconfigPath := getKubeconfigPath(kubeconfig)
+	if kubeconfigPath == "" {
+		return nil, false
+	}
+	_, clientset, err := getClients(kubeconfigPath, kubeContextFlag)
+	if err != nil {
+		return nil, false
+	}
+	return clientset, true
+}
+
+// completeServiceNames completes the service argument with the services in --namespace
+func completeServiceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	clientset, ok := completionClientset(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	namespace, _ := cmd.Flags().GetString("namespace")
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	services, err := clientset.CoreV1().Services(resolveNamespace(namespace)).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, svc := range services.Items {
+		names = append(names, svc.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeNamespaces completes a --namespace flag with the cluster's namespaces
+func completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	clientset, ok := completionClientset(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeConnectionNames completes the argument with the services and aliases of the
+// recorded connections, limited to --namespace when it is given
+func completeConnectionNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	connections, err := loadConnections()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	namespace, _ := cmd.Flags().GetString("namespace")
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, conn := range connections {
+		if namespace != "" && conn.Namespace != namespace {
+			continue
+		}
+		for _, name := range []string{conn.ServiceName, conn.Alias} {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
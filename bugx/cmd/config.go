@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bugxcli/bugx/config"
+)
+
+// NewConfigCmd creates the config command
+func NewConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage bugx configuration profiles",
+		Long: `Manage named configuration profiles (e.g. dev, staging, prod).
+
+Each profile stores its own API URL, cluster name, default namespace and
+kubeconfig under ~/.bugx/profiles/. The active profile is chosen with
+"bugx config use-profile" or per command with --profile.`,
+	}
+
+	configCmd.AddCommand(NewConfigSetProfileCmd())
+	configCmd.AddCommand(NewConfigUseProfileCmd())
+	configCmd.AddCommand(NewConfigProfilesCmd())
+	configCmd.AddCommand(NewConfigSetTimingCmd())
+	configCmd.AddCommand(NewConfigTimingsCmd())
+	configCmd.AddCommand(NewConfigSetMaxConnectionsCmd())
+	configCmd.AddCommand(NewConfigSetUpdateURLCmd())
+	configCmd.AddCommand(NewConfigSetStoreFormatCmd())
+	configCmd.AddCommand(NewConfigEffectiveCmd())
+
+	return configCmd
+}
+
+// NewConfigSetProfileCmd creates the config set-profile command
+func NewConfigSetProfileCmd() *cobra.Command {
+	var (
+		apiURL      string
+		clusterName string
+		namespace   string
+		kubeconfig  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set-profile [name]",
+		Short: "Create or update a profile",
+		Long:  `Create a profile, or update the given fields of an existing one.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.NewConfig()
+
+			profile, err := cfg.LoadProfile(args[0])
+			if err != nil {
+				profile = &config.Profile{Name: args[0]}
+			}
+
+			if cmd.Flags().Changed("api-url") {
+				profile.APIURL = apiURL
+			}
+			if cmd.Flags().Changed("cluster-name") {
+				profile.ClusterName = clusterName
+			}
+			if cmd.Flags().Changed("namespace") {
+				profile.Namespace = namespace
+			}
+			if cmd.Flags().Changed("kubeconfig") {
+				profile.Kubeconfig = kubeconfig
+			}
+
+			if err := cfg.SaveProfile(*profile); err != nil {
+				return fmt.Errorf("failed to save profile: %v", err)
+			}
+
+			fmt.Fprintf(output, "Profile %q saved.\n", profile.Name)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&apiURL, "api-url", "", "API URL used to sync connections")
+	cmd.Flags().StringVar(&clusterName, "cluster-name", "", "Cluster the profile is for; commands warn when the kubeconfig context points at another cluster")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Default namespace")
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file")
+
+	return cmd
+}
+
+// NewConfigUseProfileCmd creates the config use-profile command
+func NewConfigUseProfileCmd() *cobra.Command {
+	var clearActive bool
+
+	cmd := &cobra.Command{
+		Use:   "use-profile [name]",
+		Short: "Set the active profile",
+		Long:  `Set the profile whose defaults apply when --profile is not given.`,
+		Args:  cobra.RangeArgs(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.NewConfig()
+
+			if clearActive {
+				if err := cfg.SaveActiveProfile(""); err != nil {
+					return fmt.Errorf("failed to save config: %v", err)
+				}
+				fmt.Fprintln(output, "Active profile cleared.")
+				return nil
+			}
+
+			if len(args) != 1 {
+				return fmt.Errorf("requires a profile name (or --clear)")
+			}
+
+			if _, err := cfg.LoadProfile(args[0]); err != nil {
+				return err
+			}
+			if err := cfg.SaveActiveProfile(args[0]); err != nil {
+				return fmt.Errorf("failed to save config: %v", err)
+			}
+
+			fmt.Fprintf(output, "Switched to profile %q.\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&clearActive, "clear", false, "Stop using a profile by default")
+
+	return cmd
+}
+
+// NewConfigProfilesCmd creates the config profiles command
+func NewConfigProfilesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List profiles",
+		Long:  `List saved profiles. The active profile is marked with *.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg := config.NewConfig()
+
+			names, err := cfg.ListProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to list profiles: %v", err)
+			}
+			if len(names) == 0 {
+				fmt.Fprintln(output, "No profiles. Create one with: bugx config set-profile <name>")
+				return nil
+			}
+
+			active := ""
+			if activeProfile != nil {
+				active = activeProfile.Name
+			}
+
+			for _, name := range names {
+				marker := " "
+				if name == active {
+					marker = "*"
+				}
+				fmt.Fprintf(output, "%s %s\n", marker, name)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigSetTimingCmd creates the config set-timing command
+func NewConfigSetTimingCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-timing [name] [duration]",
+		Short: "Tune an interval bugx waits on",
+		Long: `Set one of the intervals bugx waits on, for every command. A duration of 0
+restores the default. Run "bugx config timings" for the names and current values.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, ok := timings.Get(args[0]); !ok {
+				return usageError("unknown timing %q (known timings: %s)", args[0], strings.Join(config.TimingNames(), ", "))
+			}
+			value, err := time.ParseDuration(args[1])
+			if err != nil || value < 0 {
+				return usageError("invalid duration %q", args[1])
+			}
+
+			cfg := config.NewConfig()
+			if err := cfg.SaveTiming(args[0], value); err != nil {
+				return fmt.Errorf("failed to save timing: %v", err)
+			}
+
+			if value == 0 {
+				fmt.Fprintf(output, "Timing %s reset to its default\n", args[0])
+			} else {
+				fmt.Fprintf(output, "Timing %s set to %s\n", args[0], value)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigTimingsCmd creates the config timings command
+func NewConfigTimingsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "timings",
+		Short: "List tunable intervals",
+		Long:  `List the intervals bugx waits on and their current values. Values changed from the default are marked with *.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			defaults := config.DefaultTimings()
+			for _, name := range config.TimingNames() {
+				value, _ := timings.Get(name)
+				def, _ := defaults.Get(name)
+				marker := " "
+				if value != def {
+					marker = "*"
+				}
+				fmt.Fprintf(output, "%s %-16s %s\n", marker, name, value)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigSetMaxConnectionsCmd creates the config set-max-connections command
+func NewConfigSetMaxConnectionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-max-connections [count]",
+		Short: "Limit how many background connections may run at once",
+		Long: fmt.Sprintf(`Set how many background connections may run at once before connect refuses
+to start another (unless given --force). 0 restores the default of %d.`, config.DefaultMaxConnections),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			max, err := strconv.Atoi(args[0])
+			if err != nil || max < 0 {
+				return usageError("invalid count %q", args[0])
+			}
+
+			cfg := config.NewConfig()
+			if err := cfg.SaveMaxConnections(max); err != nil {
+				return fmt.Errorf("failed to save limit: %v", err)
+			}
+
+			fmt.Fprintf(output, "At most %d background connection(s) may run at once\n", cfg.LoadMaxConnections())
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// NewConfigSetStoreFormatCmd creates the config set-store-format command
+func NewConfigSetStoreFormatCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-store-format [json|yaml]",
+		Short: "Choose whether connections are saved as JSON or YAML",
+		Long: `Choose the format of the connections file: json (connections.json, the default)
+or yaml (connections.yaml), e.g. to edit it by hand. The existing file is read
+in either format and rewritten in the new one the next time it is saved.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format := strings.ToLower(args[0])
+			if format != config.StoreFormatJSON && format != config.StoreFormatYAML {
+				return usageError("invalid format %q (must be json or yaml)", args[0])
+			}
+
+			cfg := config.NewConfig()
+			if err := cfg.SaveStoreFormat(format); err != nil {
+				return fmt.Errorf("failed to save store format: %v", err)
+			}
+
+			// Convert right away rather than leaving the old file until the next change
+			storeFormat = format
+			connectionsMutex.Lock()
+			defer connectionsMutex.Unlock()
+			connections, err := loadConnections()
+			if err != nil {
+				return fmt.Errorf("failed to load connections: %v", err)
+			}
+			if err := saveConnections(connections); err != nil {
+				return fmt.Errorf("failed to convert connections file: %v", err)
+			}
+
+			fmt.Fprintf(output, "Connections are saved to %s\n", getConnectionsFile())
+			return nil
+		},
+	}
+	cmd.ValidArgs = []string{config.StoreFormatJSON, config.StoreFormatYAML}
+
+	return cmd
+}
+
+// NewConfigSetUpdateURLCmd creates the config set-update-url command
+func NewConfigSetUpdateURLCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-update-url [url]",
+		Short: "Set the release checked by bugx update",
+		Long: fmt.Sprintf(`Set the URL of the release bugx update checks, in the format of the GitHub
+releases API (e.g. a fork or an internal mirror). An empty URL restores the default,
+%s.`, config.DefaultUpdateURL),
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] != "" && !strings.HasPrefix(args[0], "https://") && !strings.HasPrefix(args[0], "http://") {
+				return usageError("invalid URL %q: must start with https:// or http://", args[0])
+			}
+
+			cfg := config.NewConfig()
+			if err := cfg.SaveUpdateURL(args[0]); err != nil {
+				return fmt.Errorf("failed to save update URL: %v", err)
+			}
+
+			fmt.Fprintf(output, "bugx update checks %s\n", cfg.LoadUpdateURL())
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+// effectiveSetting is one resolved setting and where its value came from
+type effectiveSetting struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// NewConfigEffectiveCmd creates the config effective command
+func NewConfigEffectiveCmd() *cobra.Command {
+	var (
+		namespace    string
+		kubeconfig   string
+		outputFormat string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "effective",
+		Short: "Show the settings commands resolve and where they come from",
+		Long: `Show the namespace, kubeconfig, context and API URL that commands resolve,
+and where each value came from: a flag, the active profile, an environment
+variable, the config file, the kubeconfig, or the built-in default.
+
+Pass the same --namespace, --kubeconfig or --context as the command being
+debugged to see how they combine with the other layers.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var settings []effectiveSetting
+			add := func(name, value, source string) {
+				settings = append(settings, effectiveSetting{Name: name, Value: value, Source: source})
+			}
+
+			if activeProfile != nil {
+				source := sourceConfigFile
+				if cmd.Flags().Changed("profile") {
+					source = sourceFlag
+				}
+				add("profile", activeProfile.Name, source)
+			} else {
+				add("profile", "", sourceNone)
+			}
+
+			value, source := resolveNamespaceSource(namespace)
+			add("namespace", value, source)
+
+			kubeconfigPath, source := kubeconfigPathSource(kubeconfig)
+			add("kubeconfig", kubeconfigPath, source)
+
+			value, source = resolveContextSource(kubeContextFlag, kubeconfigPath)
+			add("context", value, source)
+
+			value, source = resolveAPIURLSource()
+			add("api-url", value, source)
+
+			if ok, err := printFormatted(outputFormat, "", settings); ok {
+				return err
+			}
+
+			for _, setting := range settings {
+				value := setting.Value
+				if value == "" {
+					value = "-"
+				}
+				fmt.Fprintf(output, "%-12s %-40s %s\n", setting.Name, value, setting.Source)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace as it would be passed to another command")
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Kubeconfig as it would be passed to another command")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json")
+
+	return cmd
+}
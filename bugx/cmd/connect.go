@@ -1,40 +1,98 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
+
+	"bugxcli/bugx/config"
 )
 
 // NewConnectCmd creates the connect command
 func NewConnectCmd() *cobra.Command {
 	var (
-		kubeconfig string
-		namespace  string
-		localPort  string
-		remotePort string
-		background bool
+		kubeconfig   string
+		namespace    string
+		localPort    string
+		remotePort   string
+		background   bool
+		printKubectl bool
+		dryRun       bool
+		sync         bool
+		sinceLog     int
+		addresses    []string
+		execCommand  string
+		envSecret    string
+
+		readonlyCheck bool
+		strict        bool
+		allowPrimary  bool
+		primaryLabels []string
+		readyFile     string
+		readyTimeout  time.Duration
+		ordinal       int
+		podSelection  string
+		owner         string
+
+		failFastNoEndpoints bool
+		labelFromPod        []string
+		waitForService      time.Duration
+		alias               string
+		podWaitReady        time.Duration
+
+		tlsServerName         string
+		insecureSkipTLSVerify bool
+		printLogsOnFailure    bool
+		annotate              bool
+		localPortRange        string
+		follow                bool
+		mirrorPorts           []string
+		maxConnections        int
+		force                 bool
+		replace               bool
+		healthCmd             string
+		ttl                   time.Duration
+		fromFile              string
+		pinnedPod             string
+		podNamespace          string
+		warnCrossNamespace    bool
+		printEndpoint         bool
+		scheme                string
+		labelSelector         string
+		recordCommand         bool
+
+		quietErrors bool
+		breaker     circuitBreaker
+		servicename string // the service being connected, for --quiet-errors
+		spawned     bool   // whether the daemon was spawned, which records its own history
 	)
 
 	cmd := &cobra.Command{
-		Use:   "connect [servicename]",
+		Use:   "connect [servicename | --from-file file | --label-selector selector]",
 		Short: "Create a port-forward tunnel to a service",
 		Long: `Create a port-forward tunnel to expose a Kubernetes service locally.
 		
@@ -42,172 +100,1123 @@ This command finds a pod behind the service and creates a port-forward connectio
 Use --background to run in the background (default).`,
 		Args: cobra.RangeArgs(0, 1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// If no args, show help or list
-			if len(args) == 0 {
+			// A tunnel file supplies the service and defaults for the flags not given on the command line
+			var spec *connectSpec
+			kubeContext := kubeContextFlag
+			if fromFile != "" {
+				if len(args) > 0 {
+					return usageError("a service name cannot be given with --from-file")
+				}
+				var err error
+				if spec, err = loadConnectSpec(fromFile); err != nil {
+					return err
+				}
+				args = []string{spec.Service}
+				if kubeContextFlag == "" {
+					kubeContext = spec.Context
+				}
+				flags := cmd.Flags()
+				if !flags.Changed("namespace") {
+					namespace = spec.Namespace
+				}
+				if !flags.Changed("localport") {
+					localPort = spec.LocalPort
+				}
+				if !flags.Changed("remoteport") {
+					remotePort = spec.RemotePort
+				}
+				if !flags.Changed("kubeconfig") {
+					kubeconfig = spec.Kubeconfig
+				}
+				if !flags.Changed("as") {
+					alias = spec.Alias
+				}
+				if !flags.Changed("address") && len(spec.Address) > 0 {
+					addresses = spec.Address
+				}
+			}
+
+			if labelSelector != "" {
+				if len(args) > 0 {
+					return usageError("--label-selector cannot be combined with a service name or --from-file")
+				}
+				if _, err := labels.Parse(labelSelector); err != nil {
+					return usageError("invalid --label-selector %q: %v", labelSelector, err)
+				}
+			} else if len(args) == 0 {
+				// If no args, show help or list
 				return cmd.Help()
+			} else {
+				servicename = args[0]
+			}
+
+			if follow && (background || execCommand != "") {
+				return usageError("--follow requires --background=false and cannot be combined with --exec")
+			}
+			if !follow && !background && (cmd.Flags().Changed("breaker-failures") || cmd.Flags().Changed("breaker-window") || cmd.Flags().Changed("breaker-cooldown")) {
+				return usageError("--breaker-failures, --breaker-window and --breaker-cooldown require --follow or --background")
+			}
+			if sync && !background {
+				return usageError("--sync requires --background; a foreground connection is not recorded and so cannot be reported")
+			}
+			if breaker.failures < 0 || breaker.window <= 0 || breaker.cooldown <= 0 {
+				return usageError("--breaker-failures must not be negative, --breaker-window and --breaker-cooldown must be positive")
+			}
+			if podNamespace != "" && pinnedPod == "" {
+				return usageError("--pod-namespace requires --pod")
+			}
+			if pinnedPod != "" && (ordinal >= 0 || len(mirrorPorts) > 0 || follow) {
+				return usageError("--pod cannot be combined with --ordinal, --mirror or --follow")
+			}
+			if err := validatePodSelection(podSelection); err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("pod-selection") && (pinnedPod != "" || ordinal >= 0) {
+				return usageError("--pod-selection cannot be combined with --pod or --ordinal")
+			}
+			if owner != "" {
+				if pinnedPod != "" {
+					return usageError("--owner cannot be combined with --pod")
+				}
+				parsed, err := parseOwner(owner)
+				if err != nil {
+					return err
+				}
+				owner = parsed
+			}
+			if healthCmd != "" {
+				if !background {
+					return usageError("--health-cmd is only supported for background connections")
+				}
+				if _, err := renderHealthCommand(healthCmd, healthCheckData{}); err != nil {
+					return usageError("%v", err)
+				}
+			}
+			if scheme != "" && !printEndpoint {
+				return usageError("--scheme requires --print-endpoint")
+			}
+			if ttl != 0 {
+				if !background {
+					return usageError("--ttl is only supported for background connections")
+				}
+				if ttl < 0 {
+					return usageError("invalid --ttl %s (must be positive)", ttl)
+				}
+			}
+			if len(mirrorPorts) > 0 {
+				if !background {
+					return usageError("--mirror is only supported for background connections")
+				}
+				if _, err := parseLocalPorts(strings.Join(mirrorPorts, ",")); err != nil {
+					return err
+				}
 			}
 
-			servicename := args[0]
+			// Validate the local port before making any API calls
+			if localPort != "" {
+				ports, err := parseLocalPorts(localPort)
+				if err != nil {
+					return err
+				}
+				if len(ports) > 1 {
+					return usageError("only one local port may be given, got %q", localPort)
+				}
+			}
+			var portRange [2]int
+			if localPortRange != "" {
+				if localPort != "" {
+					return usageError("--localport and --local-port-range cannot be used together")
+				}
+				first, last, err := parsePortRange(localPortRange)
+				if err != nil {
+					return err
+				}
+				portRange = [2]int{first, last}
+			}
 
 			// Get kubeconfig path
 			kubeconfigPath := getKubeconfigPath(kubeconfig)
 			if kubeconfigPath == "" {
-				return fmt.Errorf("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
+				return notFoundError("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
 			}
 
-			// Build config from kubeconfig
-			config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+			// Build config and clientset from kubeconfig
+			config, clientset, err := getClients(kubeconfigPath, kubeContext)
 			if err != nil {
-				return fmt.Errorf("failed to build config: %v", err)
+				return err
 			}
-
-			// Create clientset
-			clientset, err := kubernetes.NewForConfig(config)
-			if err != nil {
-				return fmt.Errorf("failed to create clientset: %v", err)
+			if kubeContext == "" {
+				kubeContext = currentContext(kubeconfigPath)
 			}
 
 			// Default namespace
-			if namespace == "" {
-				namespace = "default"
+			namespace = resolveNamespace(namespace)
+			if podNamespace == "" {
+				podNamespace = namespace
+			}
+
+			// A label selector or a prefix that matches exactly one service stands for it,
+			// unless we are waiting for the service to appear
+			if labelSelector != "" {
+				if servicename, err = serviceByLabelSelector(clientset, namespace, labelSelector); err != nil {
+					return err
+				}
+			} else if waitForService == 0 {
+				if servicename, err = expandServicePrefix(clientset, namespace, servicename); err != nil {
+					return err
+				}
 			}
 
 			// Get service to find selector and port
-			svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), servicename, metav1.GetOptions{})
+			svc, err := getServiceWaiting(clientset, namespace, servicename, waitForService)
 			if err != nil {
-				return fmt.Errorf("failed to get service: %v", err)
+				return err
 			}
 
-			// Determine remote port
-			remotePortInt := int32(3306) // Default
-			if remotePort != "" {
-				port, err := strconv.ParseInt(remotePort, 10, 32)
-				if err != nil {
-					return fmt.Errorf("invalid remote port: %v", err)
+			if failFastNoEndpoints {
+				if err := checkReadyEndpoints(clientset, svc); err != nil {
+					return err
 				}
-				remotePortInt = int32(port)
-			} else if len(svc.Spec.Ports) > 0 {
-				remotePortInt = svc.Spec.Ports[0].Port
 			}
 
-			// Find a pod behind the service
-			var selectorParts []string
-			for k, v := range svc.Spec.Selector {
-				selectorParts = append(selectorParts, fmt.Sprintf("%s=%s", k, v))
+			// Determine remote port
+			remotePortInt, err := resolveRemotePort(svc, remotePort)
+			if err != nil {
+				return err
+			}
+			if _, annotated := svc.Annotations[forwardPortAnnotation]; remotePort == "" && !annotated && len(svc.Spec.Ports) > 1 {
+				if remotePortInt, err = chooseServicePort(svc); err != nil {
+					return err
+				}
 			}
-			selector := strings.Join(selectorParts, ",")
 
-			if selector == "" {
-				return fmt.Errorf("service %s has no selector", servicename)
+			// Find a pod behind the service, unless one was given with --pod. A service without
+			// a selector is resolved through the pod its hand-managed endpoints point to.
+			var pods []corev1.Pod
+			var pod *corev1.Pod
+			var endpointPorts []corev1.EndpointPort
+			endpointPinned := false
+			if pinnedPod != "" {
+				if pod, err = clientset.CoreV1().Pods(podNamespace).Get(context.TODO(), pinnedPod, metav1.GetOptions{}); err != nil {
+					if apierrors.IsNotFound(err) {
+						return notFoundError("pod %s not found in namespace %s", pinnedPod, podNamespace)
+					}
+					return apiFailure(err, "failed to get pod %s/%s: %v", podNamespace, pinnedPod, err)
+				}
+			} else if len(svc.Spec.Selector) == 0 {
+				if len(mirrorPorts) > 0 || follow {
+					return usageError("--mirror and --follow need a service with a selector, but %s has none", svc.Name)
+				}
+				if pod, endpointPorts, err = endpointPod(clientset, svc); err != nil {
+					return err
+				}
+				podNamespace, endpointPinned = pod.Namespace, true
+				if pod.Namespace != svc.Namespace && warnCrossNamespace {
+					warnf("the endpoints of service %s/%s point to pod %s in namespace %s; this tunnel crosses a namespace boundary",
+						svc.Namespace, svc.Name, pod.Name, pod.Namespace)
+				}
+			} else {
+				selection, err := newResolvedService(svc).SelectPod(clientset, PodSelectOptions{
+					PreferReady: podWaitReady > 0,
+					UseOrdinal:  ordinal >= 0,
+					Ordinal:     ordinal,
+					Strategy:    podSelection,
+					Owner:       owner,
+				})
+				if err != nil {
+					return err
+				}
+				pods, pod = selection.Pods, selection.Pod
+				if owner == "" && len(selection.Owners) > 1 {
+					warnf("the pods of service %s belong to %s; forwarding to %s of %s. Pass --owner to choose",
+						servicename, strings.Join(selection.Owners, ", "), pod.Name, podOwner(pod))
+				}
+			}
+			if podWaitReady > 0 && !isPodReady(pod) {
+				if pod, err = waitForPodReady(clientset, pod, podWaitReady); err != nil {
+					return err
+				}
+			}
+			podName := pod.Name
+			servicePort := remotePortInt
+			if endpointPinned {
+				if !literalRemotePort(svc, remotePort) {
+					remotePortInt = endpointTargetPort(svc, endpointPorts, remotePortInt)
+				}
+			} else if remotePortInt, err = resolvePodPort(svc, pod, remotePort, remotePortInt); err != nil {
+				return err
 			}
 
-			pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
-				LabelSelector: selector,
-			})
-			if err != nil {
-				return fmt.Errorf("failed to list pods: %v", err)
+			// Warn (or refuse, in strict mode) before tunneling into a primary
+			if readonlyCheck || strict {
+				if match := primaryLabelMatch(pod, primaryLabels); match != "" {
+					if strict && !allowPrimary {
+						return usageError("pod %s is a primary (%s); pass --allow-primary to forward to it", podName, match)
+					}
+					warnf("pod %s is a primary (%s); writes through this tunnel go to the primary", podName, match)
+				}
 			}
 
-			if len(pods.Items) == 0 {
-				return fmt.Errorf("no pods found for service %s with selector %s", servicename, selector)
+			if readyFile != "" {
+				if readyFile, err = filepath.Abs(readyFile); err != nil {
+					return fmt.Errorf("invalid ready file path: %v", err)
+				}
 			}
 
-			podName := pods.Items[0].Name
+			hook := &execHook{command: execCommand}
+			if envSecret != "" {
+				if err := hook.loadSecretEnv(clientset, namespace, envSecret); err != nil {
+					return err
+				}
+			}
 
 			// Determine local port
 			localPortInt := "3307" // Default
 			if localPort != "" {
 				localPortInt = localPort
+			} else if localPortRange != "" {
+				if localPortInt, err = pickLocalPort(portRange[0], portRange[1], addresses); err != nil {
+					return err
+				}
 			} else {
-				localPortInt = strconv.Itoa(int(remotePortInt) + 1)
+				var ok bool
+				if localPortInt, ok = defaultLocalPort(servicePort); !ok {
+					return usageError("the default local port, service port %d + 1, is past 65535; pass one with --localport or --local-port-range", servicePort)
+				}
+			}
+			warnPrivilegedPort(localPortInt)
+			endpoint := ""
+			if printEndpoint {
+				protocol, err := endpointScheme(svc, remotePortInt, scheme)
+				if err != nil {
+					return err
+				}
+				endpoint = endpointURL(protocol, addresses, localPortInt)
+			}
+			seen := map[string]bool{localPortInt: true}
+			for _, port := range mirrorPorts {
+				if seen[port] {
+					return usageError("local port %s is given more than once", port)
+				}
+				seen[port] = true
+			}
+
+			if printKubectl || dryRun {
+				resolved := ConnectionInfo{Namespace: namespace, PodNamespace: podNamespace, Kubeconfig: kubeconfigPath, Context: kubeContext}
+				if strings.Join(addresses, ",") != strings.Join(defaultAddresses, ",") {
+					resolved.Address = strings.Join(addresses, ",")
+				}
+				fmt.Fprintln(output, kubectlPortForward(resolved, podName, localPortInt, remotePortInt))
+			}
+			if dryRun {
+				return nil
 			}
 
 			// Check if connection already exists
-			existing, _ := findConnection(servicename, namespace)
-			if existing != nil && existing.Status == "active" {
-				return fmt.Errorf("connection to %s/%s already exists on localhost:%s", namespace, servicename, existing.LocalPort)
+			existing, _ := findConnection(kubeContext, servicename, namespace)
+			if existing != nil && existing.ServiceName == servicename && existing.Status != "stopped" && replace {
+				if err := replaceConnection(existing); err != nil {
+					return err
+				}
+				existing = nil
+			}
+			if existing != nil && existing.ServiceName == servicename && existing.Status != "stopped" {
+				return alreadyExistsError("connection to %s/%s already exists on %s", namespace, servicename, localEndpoint(existing.Addresses(), existing.LocalPort))
+			}
+			if alias != "" {
+				if existing, _ := findConnection(kubeContext, alias, namespace); existing != nil && existing.ServiceName != servicename {
+					return alreadyExistsError("name %q is already used by the connection to %s/%s", alias, namespace, existing.ServiceName)
+				}
 			}
 
 			if background {
+				if !force {
+					if err := checkConnectionLimit(maxConnections); err != nil {
+						return err
+					}
+				}
+
 				// Run in background
-				return createBackgroundPortForward(config, clientset, namespace, servicename, podName, localPortInt, remotePortInt, kubeconfigPath)
+				conn := ConnectionInfo{
+					ServiceName: servicename,
+					Namespace:   namespace,
+					LocalPort:   localPortInt,
+					RemotePort:  remotePortInt,
+					ServicePort: namedTargetPort(svc, remotePort, servicePort),
+					PodName:     podName,
+					Address:     strings.Join(addresses, ","),
+					Kubeconfig:  kubeconfigPath,
+					Context:     kubeContext,
+					Cluster:     contextCluster(kubeconfigPath, kubeContext),
+					Server:      apiServer(config),
+					Labels:      podLabels(pod, labelFromPod),
+					Alias:       alias,
+
+					PodSelection: podSelection,
+					Owner:        owner,
+
+					Transport:             forwardTransport,
+					PingInterval:          pingInterval,
+					SSHJump:               sshJump,
+					TLSServerName:         tlsServerName,
+					InsecureSkipTLSVerify: insecureSkipTLSVerify,
+					AnnotatePod:           annotate,
+					HealthCmd:             healthCmd,
+					Breaker:               &BreakerSettings{Failures: breaker.failures, Window: breaker.window, Cooldown: breaker.cooldown},
+				}
+				if spec != nil {
+					spec.applyLabels(&conn)
+				}
+				if pinnedPod != "" || endpointPinned {
+					conn.PodNamespace = podNamespace
+				}
+				if endpointPinned {
+					conn.PodFromEndpoints = true
+					if !literalRemotePort(svc, remotePort) {
+						conn.ServicePort = servicePort
+					}
+				}
+				if recordCommand {
+					conn.Command = recordedCommand()
+				}
+				if ttl > 0 {
+					conn.ExpiresAt = timeSource.Now().Add(ttl)
+				}
+				if len(mirrorPorts) > 0 {
+					conn.Mirrors = assignMirrors(pods, podName, mirrorPorts)
+					if err := resolveMirrorPorts(conn.Mirrors, pods, svc, conn.ServicePort); err != nil {
+						return err
+					}
+				}
+				opts := backgroundOptions{
+					sync:         sync,
+					sinceLog:     sinceLog,
+					hook:         hook,
+					readyFile:    readyFile,
+					readyTimeout: readyTimeout,
+					endpoint:     endpoint,
+				}
+				if printLogsOnFailure {
+					opts.diagnose = func() string {
+						return diagnoseConnectFailure(clientset, svc, podName)
+					}
+				}
+				spawned = true
+				return createBackgroundPortForward(conn, opts)
 			} else {
 				// Run in foreground
-				return createForegroundPortForward(config, clientset, namespace, podName, localPortInt, remotePortInt)
+				config = withTLSOverrides(config, tlsServerName, insecureSkipTLSVerify)
+				if follow {
+					return followPortForward(config, clientset, namespace, servicename, podName, localPortInt, remotePortInt, namedTargetPort(svc, remotePort, servicePort), addresses, endpoint, readyFile, readyTimeout, annotate, PodSelectOptions{Strategy: podSelection, Owner: owner}, &breaker)
+				}
+				if annotate {
+					annotatePod(clientset, podNamespace, podName)
+					defer unannotatePod(clientset, podNamespace, podName)
+				}
+				return createForegroundPortForward(config, clientset, podNamespace, podName, localPortInt, remotePortInt, addresses, endpoint, hook, readyFile, readyTimeout)
 			}
 		},
 	}
 
-	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file (defaults to KUBECONFIG env var or ~/.kube/config)")
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace of the service")
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file, or comma-separated files to merge (defaults to KUBECONFIG env var or ~/.kube/config)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
 	cmd.Flags().StringVarP(&localPort, "localport", "l", "", "Local port to forward to (defaults to remote port + 1)")
 	cmd.Flags().StringVarP(&remotePort, "remoteport", "r", "", "Remote port on the pod (defaults to first service port)")
+	cmd.Flags().StringSliceVar(&mirrorPorts, "mirror", nil, "Extra local ports forwarding to the same remote port, each to another pod round-robin (e.g. 3308,3309)")
+	cmd.Flags().StringVar(&localPortRange, "local-port-range", "", "Pick the local port from this range instead of remote port + 1, e.g. 30000-30100")
 	cmd.Flags().BoolVarP(&background, "background", "b", true, "Run port-forward in background")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Read the service and connect settings from a YAML or JSON tunnel file; flags given on the command line take precedence")
+	cmd.Flags().StringVar(&healthCmd, "health-cmd", "", "Command run periodically by the daemon to check the tunnel, e.g. 'pg_isready -h 127.0.0.1 -p {{.LocalPort}}'; a non-zero exit marks it unhealthy")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Stop and remove the background connection after this long, e.g. 2h, even while it is in use")
+	cmd.Flags().IntVar(&maxConnections, "max-connections", 0, "Refuse to start a background connection when this many are already running (default: the configured limit, 50 unless set)")
+	cmd.Flags().BoolVar(&force, "force", false, "Start the background connection even if the connection limit is reached")
+	cmd.Flags().BoolVar(&replace, "replace", false, "Disconnect an existing connection to the same service and namespace first instead of failing")
+	cmd.Flags().BoolVar(&follow, "follow", false, "In foreground mode, reconnect to a new pod when the forward drops instead of exiting, until Ctrl+C")
+	cmd.Flags().IntVar(&breaker.failures, "breaker-failures", defaultBreakerFailures, "With --follow or a background daemon, pause reconnecting after this many consecutive failed attempts within --breaker-window (0 never pauses)")
+	cmd.Flags().DurationVar(&breaker.window, "breaker-window", defaultBreakerWindow, "The window in which --breaker-failures failed reconnect attempts open the circuit breaker")
+	cmd.Flags().DurationVar(&breaker.cooldown, "breaker-cooldown", defaultBreakerCooldown, "How long reconnecting pauses once the circuit breaker opened")
+	cmd.Flags().DurationVar(&podWaitReady, "pod-wait-ready", 0, "Wait up to this long for the selected pod to become Ready before forwarding, e.g. 2m")
+	cmd.Flags().BoolVar(&annotate, "annotate-pod", false, "Annotate the pod with bugx.io/forwarded-by and bugx.io/forwarded-at while the tunnel is open (modifies the pod; needs patch permission)")
+	cmd.Flags().BoolVar(&printLogsOnFailure, "print-logs-on-failure", false, "If the background daemon fails to start, also show the pod's status and recent events and the service's endpoint readiness")
+	cmd.Flags().StringVar(&tlsServerName, "tls-server-name", "", "Server name to verify the API server certificate against when opening the forward (for clusters behind a proxy)")
+	cmd.Flags().BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Skip verification of the API server certificate when opening the forward (insecure; dev clusters only)")
+	cmd.Flags().StringVar(&alias, "as", "", "Alias for the connection, accepted by disconnect and status in place of the service name")
+	cmd.Flags().DurationVar(&waitForService, "wait-for-service", 0, "Wait up to this long for the service to be created, e.g. 2m (0 fails immediately)")
+	cmd.Flags().BoolVar(&failFastNoEndpoints, "fail-fast-on-no-endpoints", false, "Fail if the service has no ready endpoints instead of forwarding to a pod that may not be serving")
+	cmd.Flags().StringVar(&labelSelector, "label-selector", "", "Connect to the one service whose labels match this selector instead of naming it, e.g. app=web")
+	cmd.Flags().StringVar(&pinnedPod, "pod", "", "Forward to this pod instead of one selected through the service (the service still keys the connection and supplies the port)")
+	cmd.Flags().StringVar(&podNamespace, "pod-namespace", "", "Namespace of the --pod pod, if not the service's")
+	cmd.Flags().BoolVar(&printEndpoint, "print-endpoint", false, "Once the tunnel is up, print a connection string for it on stdout, e.g. postgresql://localhost:5433/ (printed even with --quiet)")
+	cmd.Flags().StringVar(&scheme, "scheme", "", "Protocol of the --print-endpoint connection string, e.g. postgresql, mysql, redis (default: the service's bugx.io/scheme annotation, else inferred from the port)")
+	cmd.Flags().BoolVar(&warnCrossNamespace, "warn-if-cross-namespace-ref", true, "Warn when the hand-managed endpoints of a service without a selector point to a pod in another namespace")
+	cmd.Flags().IntVar(&ordinal, "ordinal", -1, "Forward to the StatefulSet pod with this ordinal (e.g. 0 for <statefulset>-0)")
+	cmd.Flags().StringVar(&owner, "owner", "", "Only forward to pods of this workload, e.g. deployment/web-green, when the service selects pods of several (blue/green)")
+	cmd.Flags().StringVar(&podSelection, "pod-selection", podSelectionFirst, "Which pod behind the service to forward to: first, random (a Ready pod) or least-restarts (the Ready pod whose containers restarted least); also used when the pod is picked again")
+	cmd.Flags().StringSliceVar(&addresses, "address", defaultAddresses, "Local addresses to listen on (comma separated, e.g. ::1 or 127.0.0.1,::1)")
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 10*time.Second, "How long to wait for the port-forward to become ready")
+	cmd.Flags().StringVar(&readyFile, "on-ready-write-file", "", "File to write the local port to once the forward is ready (removed on shutdown)")
+	cmd.Flags().StringVar(&execCommand, "exec", "", "Command to run once the port-forward is ready (BUGX_LOCAL_PORT is set; in foreground mode the tunnel stops when it exits)")
+	cmd.Flags().StringVar(&envSecret, "env-from-secret", "", "Secret in the service namespace whose keys are printed as redacted exports and passed to --exec")
+	cmd.Flags().BoolVar(&readonlyCheck, "readonly-check", false, "Warn when the selected pod carries a primary/leader label")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Refuse to forward to a primary pod unless --allow-primary is given (implies --readonly-check)")
+	cmd.Flags().BoolVar(&allowPrimary, "allow-primary", false, "Allow forwarding to a primary pod in --strict mode")
+	cmd.Flags().StringSliceVar(&labelFromPod, "label-from-pod", nil, "Pod label keys to copy into the connection record, for connect list --filter (e.g. app,version)")
+	cmd.Flags().StringSliceVar(&primaryLabels, "primary-labels", []string{"role=master", "role=primary"}, "Labels (key or key=value) that mark a pod as primary")
+	cmd.Flags().BoolVar(&printKubectl, "print-kubectl", false, "Print the equivalent kubectl port-forward command before connecting")
+	cmd.Flags().IntVar(&sinceLog, "since-log", 20, "Number of daemon log lines to include when a background connect fails (0 to disable)")
+	cmd.Flags().BoolVar(&sync, "sync", false, "Report the background connection to the configured API (skipped when no api_url/token is configured)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Resolve the pod and ports, print the equivalent kubectl command, and exit without connecting")
+	cmd.Flags().BoolVar(&recordCommand, "record-command", false, "Store this command line in the connection record, shown by connect list --wide and history (sensitive values are redacted)")
+	cmd.Flags().BoolVar(&quietErrors, "quiet-errors", false, "On failure, record the error in the history and print a warning but exit 0 (usage errors still fail)")
+
+	// With --quiet-errors a failure is recorded and reported, but does not fail the command.
+	// Usage errors still do: they would fail every run, not just this one. With
+	// --label-selector, a failure before a service matched is recorded under the selector.
+	runConnect := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		err := runConnect(cmd, args)
+		target := servicename
+		if target == "" {
+			target = labelSelector
+		}
+		if err == nil || !quietErrors || target == "" || ExitCode(err) == ExitUsage {
+			return err
+		}
+		if !spawned {
+			recordHistory("connect", ConnectionInfo{ServiceName: target, Namespace: resolveNamespace(namespace)}, err)
+		}
+		warnf("connect to %s failed (ignored with --quiet-errors): %v", target, err)
+		return nil
+	}
 
 	// Add list as a subcommand
 	cmd.AddCommand(NewConnectListCmd())
+	cmd.AddCommand(NewConnectRestoreCmd())
+	cmd.AddCommand(NewConnectRemapCmd())
+	cmd.AddCommand(NewConnectLogsCmd())
+
+	cmd.ValidArgsFunction = completeServiceNames
+	cmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
 
 	return cmd
 }
 
 // NewConnectListCmd creates the connect list command
 func NewConnectListCmd() *cobra.Command {
+	var (
+		groupBy      string
+		compact      bool
+		wide         bool
+		outputFormat string
+		tmpl         string
+		currentOnly  bool
+		kubeconfig   string
+		filter       string
+	)
+
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List all active port-forward connections",
 		Long:  `List all active port-forward connections.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if groupBy != "namespace" && groupBy != "context" && groupBy != "none" {
+				return usageError("invalid --group-by value %q (must be namespace, context or none)", groupBy)
+			}
+
+			selector := labels.Everything()
+			if filter != "" {
+				var err error
+				if selector, err = labels.Parse(filter); err != nil {
+					return usageError("invalid --filter %q: %v", filter, err)
+				}
+			}
+
 			connections, err := loadConnections()
 			if err != nil {
 				return fmt.Errorf("failed to load connections: %v", err)
 			}
 
+			// Resolve the active context when filtering by it
+			activeContext := ""
+			if currentOnly {
+				kubeconfigPath := getKubeconfigPath(kubeconfig)
+				if kubeconfigPath == "" {
+					return notFoundError("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
+				}
+				activeContext = currentContext(kubeconfigPath)
+			}
+
 			// Filter active connections
-			var activeConnections []ConnectionInfo
+			activeConnections := []ConnectionInfo{}
 			for _, conn := range connections {
+				if currentOnly && conn.Context != activeContext {
+					continue
+				}
+				if !selector.Matches(labels.Set(conn.Labels)) {
+					continue
+				}
+
 				// Check if process is still running
 				if isProcessRunning(conn.PID) {
 					activeConnections = append(activeConnections, conn)
 				} else {
 					// Update status to stopped
-					updateConnectionStatus(conn.ServiceName, conn.Namespace, "stopped")
+					updateConnectionStatus(conn.Context, conn.ServiceName, conn.Namespace, "stopped")
 				}
 			}
 
-			displayConnections(activeConnections)
+			if outputFormat == "ports-json" {
+				_, err := printFormatted("json", "", newPortMappings(activeConnections))
+				return err
+			}
+			if ok, err := printFormatted(outputFormat, tmpl, activeConnections); ok {
+				return err
+			}
+
+			if compact {
+				displayConnectionsCompact(activeConnections, wide)
+				return nil
+			}
+
+			displayConnections(activeConnections, groupBy, wide)
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&groupBy, "group-by", "namespace", "Group connections by: namespace, context, none")
+	cmd.Flags().BoolVar(&currentOnly, "current-context", false, "Only show connections created against the kubeconfig's current context")
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file used by --current-context")
+	cmd.Flags().StringVar(&filter, "filter", "", "Only show connections whose labels match this selector, e.g. app=web")
+	cmd.Flags().BoolVar(&compact, "compact", false, "Print one connection per line in aligned columns")
+	cmd.Flags().BoolVar(&wide, "wide", false, "Also show bytes forwarded in and out of each tunnel and the API server it was opened through")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json, ports-json (service, namespace and local port only) or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the connection list with -o template")
+
 	return cmd
 }
 
-// createForegroundPortForward creates a port-forward connection in foreground
-func createForegroundPortForward(config *rest.Config, clientset *kubernetes.Clientset, namespace, podName, localPort string, remotePort int32) error {
-	transport, upgrader, err := spdy.RoundTripperFor(config)
+// getServiceWaiting gets a service, retrying while it does not exist yet for up to timeout
+func getServiceWaiting(clientset kubernetes.Interface, namespace, name string, timeout time.Duration) (*corev1.Service, error) {
+	deadline := timeSource.Now().Add(timeout)
+	waiting := false
+
+	for {
+		svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err == nil {
+			return svc, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return nil, apiFailure(err, "failed to get service: %v", err)
+		}
+		if timeSource.Now().After(deadline) {
+			if waiting {
+				return nil, notFoundError("service %s/%s did not appear within %s", namespace, name, timeout)
+			}
+			return nil, notFoundError("failed to get service: %v", err)
+		}
+
+		if !waiting {
+			fmt.Fprintf(output, "Waiting for service %s/%s to be created...\n", namespace, name)
+			waiting = true
+		}
+		<-timeSource.After(timings.RetryInterval)
+	}
+}
+
+// expandServicePrefix returns name if a service has that exact name, else the one service whose
+// name starts with it. When nothing matches, name is returned unchanged for the caller to report.
+func expandServicePrefix(clientset kubernetes.Interface, namespace, name string) (string, error) {
+	_, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err == nil {
+		return name, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", apiFailure(err, "failed to get service %s/%s: %v", namespace, name, err)
+	}
+
+	services, err := listServices(clientset, namespace, "", "", "")
+	if err != nil {
+		return "", apiFailure(err, "failed to list services: %v", err)
+	}
+
+	var matches []string
+	for _, svc := range services {
+		if strings.HasPrefix(svc.Name, name) {
+			matches = append(matches, svc.Name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return name, nil
+	case 1:
+		fmt.Fprintf(output, "Using service %s/%s\n", namespace, matches[0])
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", usageError("%q matches several services in %s: %s", name, namespace, strings.Join(matches, ", "))
+}
+
+// serviceByLabelSelector returns the name of the one service in namespace whose labels match selector
+func serviceByLabelSelector(clientset kubernetes.Interface, namespace, selector string) (string, error) {
+	services, err := listServices(clientset, namespace, selector, "", "")
+	if err != nil {
+		return "", apiFailure(err, "failed to list services: %v", err)
+	}
+
+	var matches []string
+	for _, svc := range services {
+		matches = append(matches, svc.Name)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", notFoundError("no service in %s matches --label-selector %s", namespace, selector)
+	case 1:
+		fmt.Fprintf(output, "Using service %s/%s\n", namespace, matches[0])
+		return matches[0], nil
+	}
+	sort.Strings(matches)
+	return "", usageError("--label-selector %s matches several services in %s: %s", selector, namespace, strings.Join(matches, ", "))
+}
+
+// listPodsForService lists the pods behind the service using its selector
+func listPodsForService(clientset *kubernetes.Clientset, svc *corev1.Service) ([]corev1.Pod, error) {
+	selection, err := newResolvedService(svc).SelectPod(clientset, PodSelectOptions{})
 	if err != nil {
-		return fmt.Errorf("failed to create round tripper: %v", err)
+		return nil, err
+	}
+	return selection.Pods, nil
+}
+
+// podLabels returns the pod's values for the given label keys, skipping keys the pod lacks
+func podLabels(pod *corev1.Pod, keys []string) map[string]string {
+	var copied map[string]string
+	for _, key := range keys {
+		value, ok := pod.Labels[key]
+		if !ok {
+			continue
+		}
+		if copied == nil {
+			copied = make(map[string]string)
+		}
+		copied[key] = value
+	}
+	return copied
+}
+
+// checkReadyEndpoints returns an error if the service's Endpoints object has no ready addresses
+func checkReadyEndpoints(clientset *kubernetes.Clientset, svc *corev1.Service) error {
+	ready, notReady, err := countEndpoints(clientset, svc)
+	if err != nil {
+		return err
+	}
+	if ready == 0 {
+		return unreachableError("service %s has no ready endpoints (%d not ready)", svc.Name, notReady)
+	}
+	return nil
+}
+
+// countEndpoints counts the ready and not-ready addresses in the service's Endpoints object.
+// A missing Endpoints object counts as no addresses.
+func countEndpoints(clientset *kubernetes.Clientset, svc *corev1.Service) (ready, notReady int, err error) {
+	endpoints, err := clientset.CoreV1().Endpoints(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("failed to get endpoints: %v", err)
+	}
+
+	for _, subset := range endpoints.Subsets {
+		ready += len(subset.Addresses)
+		notReady += len(subset.NotReadyAddresses)
+	}
+	return ready, notReady, nil
+}
+
+// preferReadyPod returns the first Ready pod, or the first pod if none are Ready
+func preferReadyPod(pods []corev1.Pod) *corev1.Pod {
+	for i := range pods {
+		if isPodReady(&pods[i]) {
+			return &pods[i]
+		}
+	}
+	return &pods[0]
+}
+
+// isPodReady reports whether the pod's Ready condition is true
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waitForPodReady watches the pod until it becomes Ready, is deleted, or timeout elapses
+func waitForPodReady(clientset *kubernetes.Clientset, pod *corev1.Pod, timeout time.Duration) (*corev1.Pod, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	fmt.Fprintf(output, "Waiting up to %s for pod %s to become ready...\n", timeout, pod.Name)
+
+	watcher, err := clientset.CoreV1().Pods(pod.Namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", pod.Name).String(),
+		ResourceVersion: pod.ResourceVersion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch pod %s: %v", pod.Name, err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("pod %s did not become ready within %s", pod.Name, timeout)
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return nil, fmt.Errorf("watch on pod %s closed before it became ready", pod.Name)
+			}
+			switch event.Type {
+			case watch.Deleted:
+				return nil, fmt.Errorf("pod %s was deleted while waiting for it to become ready", pod.Name)
+			case watch.Error:
+				return nil, fmt.Errorf("failed to watch pod %s: %v", pod.Name, apierrors.FromObject(event.Object))
+			}
+			if updated, ok := event.Object.(*corev1.Pod); ok && isPodReady(updated) {
+				return updated, nil
+			}
+		}
+	}
+}
+
+// selectPodByOrdinal finds the StatefulSet pod with the given ordinal (<statefulset>-<ordinal>)
+func selectPodByOrdinal(pods []corev1.Pod, ordinal int) (*corev1.Pod, error) {
+	statefulSets := make(map[string]bool)
+	for i := range pods {
+		for _, owner := range pods[i].OwnerReferences {
+			if owner.Kind != "StatefulSet" {
+				continue
+			}
+			statefulSets[owner.Name] = true
+			if pods[i].Name == fmt.Sprintf("%s-%d", owner.Name, ordinal) {
+				return &pods[i], nil
+			}
+		}
+	}
+
+	if len(statefulSets) == 0 {
+		return nil, fmt.Errorf("--ordinal requires pods managed by a StatefulSet, but none of the service's pods are")
+	}
+	return nil, fmt.Errorf("no pod with ordinal %d found behind the service", ordinal)
+}
+
+// defaultLocalPort returns the local port used when none is given, the service port + 1,
+// or false when that would be past 65535
+func defaultLocalPort(servicePort int32) (string, bool) {
+	if servicePort >= 65535 {
+		return "", false
+	}
+	return strconv.Itoa(int(servicePort) + 1), true
+}
+
+// warnPrivilegedPort warns when a local port below 1024 is requested by a non-root user,
+// since binding it will likely fail with a permissions error
+func warnPrivilegedPort(localPort string) {
+	port, err := strconv.Atoi(localPort)
+	if err != nil || port >= 1024 || runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	warnf("local port %d is privileged and binding it usually requires root; consider an unprivileged port such as --localport %d", port, port+8000)
+}
+
+// parseLocalPorts validates a comma-separated list of local ports, each of which must be 1-65535
+func parseLocalPorts(value string) ([]string, error) {
+	var ports []string
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		port, err := strconv.Atoi(part)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, usageError("invalid local port %q: must be a number between 1 and 65535", part)
+		}
+		ports = append(ports, part)
+	}
+	return ports, nil
+}
+
+// parsePortRange parses a local port range of the form first-last
+func parsePortRange(value string) (int, int, error) {
+	firstStr, lastStr, ok := strings.Cut(value, "-")
+	first, err1 := strconv.Atoi(strings.TrimSpace(firstStr))
+	last, err2 := strconv.Atoi(strings.TrimSpace(lastStr))
+	if !ok || err1 != nil || err2 != nil || first < 1 || last > 65535 || first > last {
+		return 0, 0, usageError("invalid local port range %q: expected first-last within 1-65535, e.g. 30000-30100", value)
+	}
+	return first, last, nil
+}
+
+// pickLocalPort returns the first port in first..last that is not allocated to a recorded
+// connection and can be bound on every listen address. The port registry is consulted
+// first, so ports of other tunnels are skipped without probing them.
+func pickLocalPort(first, last int, addresses []string) (string, error) {
+	used := make(map[string]bool)
+	if ports, err := allocatedPorts(); err == nil {
+		for _, port := range ports {
+			used[port.LocalPort] = true
+		}
+	}
+
+	for port := first; port <= last; port++ {
+		candidate := strconv.Itoa(port)
+		if !used[candidate] && portAvailable(candidate, addresses) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free local port in range %d-%d", first, last)
+}
+
+// replaceConnection stops the daemon of an existing connection and removes its record,
+// so connect --replace can start the new tunnel in its place
+func replaceConnection(existing *ConnectionInfo) error {
+	if isProcessRunning(existing.PID) {
+		if err := terminateProcess(existing.PID); err != nil {
+			return fmt.Errorf("failed to stop existing connection to %s/%s: %v", existing.Namespace, existing.ServiceName, err)
+		}
+	}
+	if err := removeConnection(existing.Context, existing.ServiceName, existing.Namespace); err != nil {
+		return fmt.Errorf("failed to remove existing connection: %v", err)
+	}
+	fmt.Fprintf(output, "Stopped existing connection to %s/%s on %s\n", existing.Namespace, existing.ServiceName, localEndpoint(existing.Addresses(), existing.LocalPort))
+	return nil
+}
+
+// portAvailable reports whether port can currently be bound on every address
+func portAvailable(port string, addresses []string) bool {
+	for _, address := range addresses {
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, port))
+		if err != nil {
+			return false
+		}
+		listener.Close()
+	}
+	return true
+}
+
+// resolvePodPort maps the port chosen by resolveRemotePort to the port the selected pod listens on.
+// Ports given as numbers, by flag or annotation, are used as is. Ports taken from the service are
+// translated through their targetPort; a named targetPort is looked up in the pod's containers,
+// so backends that map the name to different container ports are each reached correctly.
+func resolvePodPort(svc *corev1.Service, pod *corev1.Pod, remotePort string, port int32) (int32, error) {
+	if literalRemotePort(svc, remotePort) {
+		return port, nil
+	}
+	return podTargetPort(svc, pod, port)
+}
+
+// literalRemotePort reports whether the remote port was given as a number, by flag or annotation
+func literalRemotePort(svc *corev1.Service, remotePort string) bool {
+	literal := remotePort
+	if literal == "" {
+		literal = svc.Annotations[forwardPortAnnotation]
+	}
+	_, err := strconv.Atoi(literal)
+	return err == nil
+}
+
+// podTargetPort returns the port pod listens on for service port port: its targetPort, looked
+// up among the pod's container ports when it is a name
+func podTargetPort(svc *corev1.Service, pod *corev1.Pod, port int32) (int32, error) {
+	for _, servicePort := range svc.Spec.Ports {
+		if servicePort.Port != port {
+			continue
+		}
+		target := servicePort.TargetPort
+		if target.Type == intstr.String && target.StrVal != "" {
+			for _, container := range pod.Spec.Containers {
+				for _, containerPort := range container.Ports {
+					if containerPort.Name == target.StrVal {
+						return containerPort.ContainerPort, nil
+					}
+				}
+			}
+			return 0, fmt.Errorf("pod %s has no container port named %q (the targetPort of service port %d)", pod.Name, target.StrVal, port)
+		}
+		if target.Type == intstr.Int && target.IntVal != 0 {
+			return target.IntVal, nil
+		}
+		return port, nil
+	}
+	return port, nil
+}
+
+// namedTargetPort returns port if resolvePodPort looked it up through a named targetPort, which
+// can map to a different port on each pod and so has to be resolved again whenever the pod
+// changes; otherwise it returns 0, as the remote port is the same for every pod
+func namedTargetPort(svc *corev1.Service, remotePort string, port int32) int32 {
+	if literalRemotePort(svc, remotePort) {
+		return 0
+	}
+	for _, servicePort := range svc.Spec.Ports {
+		if servicePort.Port == port && servicePort.TargetPort.Type == intstr.String && servicePort.TargetPort.StrVal != "" {
+			return port
+		}
+	}
+	return 0
+}
+
+// preferredPortNames are the service port names preferred when no port is given, in order.
+// Names with one of these as a protocol prefix (e.g. http-api, the Istio convention) come next.
+var preferredPortNames = []string{"http", "https", "grpc"}
+
+// preferredPortNumbers are the port numbers preferred after the names, in order: web servers,
+// then common databases and app servers. Ports such as metrics exporters are not among them.
+var preferredPortNumbers = []int32{80, 443, 8080, 8443, 5432, 3306, 6379, 27017, 9200, 3000, 8000}
+
+// preferredServicePort picks the port of a multi-port service to forward by default: the first
+// port named like preferredPortNames, else with their protocol prefix, else the first with one
+// of preferredPortNumbers, else the first port. It returns the index of the port and why it won.
+func preferredServicePort(svc *corev1.Service) (int, string) {
+	ports := svc.Spec.Ports
+	for _, name := range preferredPortNames {
+		for i, port := range ports {
+			if port.Name == name {
+				return i, fmt.Sprintf("it is named %s", name)
+			}
+		}
+	}
+	for _, name := range preferredPortNames {
+		for i, port := range ports {
+			if strings.HasPrefix(port.Name, name+"-") {
+				return i, fmt.Sprintf("its name %s starts with %s-", port.Name, name)
+			}
+		}
+	}
+	for _, number := range preferredPortNumbers {
+		for i, port := range ports {
+			if port.Port == number {
+				return i, fmt.Sprintf("%d is a common port", number)
+			}
+		}
+	}
+	return 0, "it is the first port"
+}
+
+// chooseServicePort lists the ports of a multi-port service and, on a terminal, asks which
+// one to forward, offering the preferredServicePort. Without a terminal that port is used.
+// The list is informational and goes to output; only the prompt itself is written to stderr.
+func chooseServicePort(svc *corev1.Service) (int32, error) {
+	fmt.Fprintf(output, "Service %s exposes %d ports:\n", svc.Name, len(svc.Spec.Ports))
+	for i, port := range svc.Spec.Ports {
+		name := ""
+		if port.Name != "" {
+			name = " (" + port.Name + ")"
+		}
+		fmt.Fprintf(output, "  [%d] %d/%s%s\n", i+1, port.Port, port.Protocol, name)
+	}
+
+	index, reason := preferredServicePort(svc)
+	preferred := svc.Spec.Ports[index].Port
+	if !isTerminal(os.Stdin) {
+		fmt.Fprintf(output, "Forwarding port %d because %s; use --remoteport or the %s annotation to choose another\n", preferred, reason, forwardPortAnnotation)
+		return preferred, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Port to forward [%d, %d because %s]: ", index+1, preferred, reason)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return preferred, nil
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return preferred, nil
+	}
+
+	// Accept the list index, the port number or the port name
+	if index, err := strconv.Atoi(answer); err == nil && index >= 1 && index <= len(svc.Spec.Ports) {
+		return svc.Spec.Ports[index-1].Port, nil
+	}
+	for _, port := range svc.Spec.Ports {
+		if answer == port.Name || answer == strconv.Itoa(int(port.Port)) {
+			return port.Port, nil
+		}
+	}
+	return 0, usageError("invalid choice %q: enter a number from 1 to %d, a port or a port name", answer, len(svc.Spec.Ports))
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// forwardPortAnnotation lets service owners declare the port bugx forwards to by default.
+// Its value is a port number or the name of one of the service's ports.
+const forwardPortAnnotation = "bugx.io/forward-port"
+
+// resolveRemotePort returns the port to forward to: the flag value if given, else the
+// service's forwardPortAnnotation, else the preferredServicePort
+func resolveRemotePort(svc *corev1.Service, remotePort string) (int32, error) {
+	if remotePort != "" {
+		if port, err := strconv.ParseInt(remotePort, 10, 32); err == nil {
+			if port < 1 || port > 65535 {
+				return 0, usageError("invalid remote port %d: must be between 1 and 65535", port)
+			}
+			return int32(port), nil
+		}
+		for _, port := range svc.Spec.Ports {
+			if port.Name == remotePort {
+				return port.Port, nil
+			}
+		}
+		return 0, usageError("invalid remote port %q: not a number or the name of a port of service %s", remotePort, svc.Name)
 	}
 
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
-	hostIP := strings.TrimPrefix(config.Host, "https://")
-	hostIP = strings.TrimPrefix(hostIP, "http://")
+	if value, ok := svc.Annotations[forwardPortAnnotation]; ok {
+		if port, err := strconv.ParseInt(value, 10, 32); err == nil {
+			if port < 1 || port > 65535 {
+				return 0, fmt.Errorf("service %s has invalid %s annotation %q (port must be between 1 and 65535)", svc.Name, forwardPortAnnotation, value)
+			}
+			return int32(port), nil
+		}
+		for _, port := range svc.Spec.Ports {
+			if port.Name == value {
+				return port.Port, nil
+			}
+		}
+		return 0, fmt.Errorf("service %s has invalid %s annotation %q (must be a port number or the name of a service port)", svc.Name, forwardPortAnnotation, value)
+	}
 
-	serverURL := &url.URL{
-		Scheme: "https",
-		Path:   path,
-		Host:   hostIP,
+	if len(svc.Spec.Ports) > 0 {
+		index, _ := preferredServicePort(svc)
+		return svc.Spec.Ports[index].Port, nil
 	}
 
+	return 3306, nil // Default
+}
+
+// primaryLabelMatch returns the first of the given key or key=value labels the pod carries
+func primaryLabelMatch(pod *corev1.Pod, primaryLabels []string) string {
+	for _, label := range primaryLabels {
+		key, value, hasValue := strings.Cut(label, "=")
+		if actual, ok := pod.Labels[key]; ok && (!hasValue || actual == value) {
+			return fmt.Sprintf("%s=%s", key, actual)
+		}
+	}
+	return ""
+}
+
+// createForegroundPortForward creates a port-forward connection in foreground
+// A non-empty endpoint (connect --print-endpoint) is printed on stdout once the forward is ready.
+func createForegroundPortForward(config *rest.Config, clientset *kubernetes.Clientset, namespace, podName, localPort string, remotePort int32, addresses []string, endpoint string, hook *execHook, readyFile string, readyTimeout time.Duration) error {
 	stopChan := make(chan struct{}, 1)
 	readyChan := make(chan struct{})
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
-
 	ports := []string{fmt.Sprintf("%s:%d", localPort, remotePort)}
-	pf, err := portforward.New(dialer, ports, stopChan, readyChan, os.Stdout, os.Stderr)
+	pf, err := newPortForwarder(config, namespace, podName, addresses, ports, stopChan, readyChan, output, os.Stderr)
 	if err != nil {
-		return fmt.Errorf("failed to create port-forward: %v", err)
+		return err
 	}
 
 	errChan := make(chan error, 1)
@@ -217,138 +1226,454 @@ func createForegroundPortForward(config *rest.Config, clientset *kubernetes.Clie
 
 	select {
 	case <-readyChan:
-		fmt.Println()
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Printf("  Port-forward established successfully!\n")
-		fmt.Printf("  Pod:     %s/%s\n", namespace, podName)
-		fmt.Printf("  Local:   localhost:%s\n", localPort)
-		fmt.Printf("  Remote:  %d\n", remotePort)
-		fmt.Println()
-		fmt.Println("  Press Ctrl+C to stop the port-forward")
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Println()
+		printForegroundBanner(namespace, podName, localPort, remotePort, addresses, endpoint)
+		hook.printExports()
+
+		if readyFile != "" {
+			if err := writeReadyFile(readyFile, localPort); err != nil {
+				warnf("failed to write ready file: %v", err)
+			}
+			defer os.Remove(readyFile)
+		}
 	case err := <-errChan:
+		// The forward can return without error before ever becoming ready;
+		// there is nothing to wait on in that case
 		if err != nil {
-			return fmt.Errorf("port-forward failed: %v", err)
+			return unreachableError("port-forward failed: %v", err)
 		}
+		return unreachableError("port-forward exited before becoming ready")
+	case <-timeSource.After(readyTimeout):
+		close(stopChan)
+		<-errChan
+		return unreachableError("port-forward was not ready after %s (use --ready-timeout to wait longer)", readyTimeout)
 	}
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
-	<-sig
+	defer signal.Stop(sig)
+
+	// With an exec hook the tunnel lives as long as the command. Ctrl+C stops the
+	// command and then the tunnel, and a forward that ends stops the command and
+	// whatever it started.
+	if hook.command != "" {
+		proc, err := hook.start(localPort)
+		if err != nil {
+			close(stopChan)
+			<-errChan
+			return err
+		}
+
+		var hookErr error
+		select {
+		case <-proc.done:
+			hookErr = proc.err
+		case <-sig:
+			fmt.Fprintln(output, "\nStopping exec command...")
+			proc.stop()
+		case err := <-errChan:
+			proc.stop()
+			return foregroundForwardEnded(clientset, namespace, podName, err)
+		}
+		close(stopChan)
+		<-errChan
+		fmt.Fprintln(output, "Port-forward stopped.")
+		return hookErr
+	}
 
-	fmt.Println("\nStopping port-forward...")
+	select {
+	case <-sig:
+	case err := <-errChan:
+		return foregroundForwardEnded(clientset, namespace, podName, err)
+	}
+
+	fmt.Fprintln(output, "\nStopping port-forward...")
 	close(stopChan)
 	<-errChan
-	fmt.Println("Port-forward stopped.")
+	fmt.Fprintln(output, "Port-forward stopped.")
 	return nil
 }
 
-// createBackgroundPortForward creates a port-forward connection in background by spawning a daemon process
-func createBackgroundPortForward(config *rest.Config, clientset *kubernetes.Clientset, namespace, serviceName, podName, localPort string, remotePort int32, kubeconfigPath string) error {
+// foregroundForwardEnded explains why an established foreground forward ended on its own,
+// checking whether its pod was deleted so the user isn't left with a raw client-go error
+func foregroundForwardEnded(clientset *kubernetes.Clientset, namespace, podName string, err error) error {
+	if deleted, checkErr := podDeleted(clientset, namespace, podName); checkErr == nil && deleted {
+		return notFoundError("target pod %s/%s was deleted; reconnect with --follow to auto-retarget", namespace, podName)
+	}
+	if err != nil {
+		return unreachableError("port-forward to pod %s/%s ended: %v", namespace, podName, err)
+	}
+	return unreachableError("port-forward to pod %s/%s ended", namespace, podName)
+}
+
+// printForegroundBanner announces an established foreground port-forward, followed by its
+// endpoint, if one is given, on a line of its own on stdout
+func printForegroundBanner(namespace, podName, localPort string, remotePort int32, addresses []string, endpoint string) {
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintf(output, "  Port-forward established successfully!\n")
+	fmt.Fprintf(output, "  Pod:     %s/%s\n", namespace, podName)
+	fmt.Fprintf(output, "  Local:   %s\n", localEndpoint(addresses, localPort))
+	fmt.Fprintf(output, "  Remote:  %d\n", remotePort)
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "  Press Ctrl+C to stop the port-forward")
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(output)
+	printEndpointLine(endpoint)
+}
+
+// followPortForward runs a foreground port-forward that, when the forward drops,
+// re-resolves the service's pod and reconnects until interrupted. A non-zero servicePort has
+// a named targetPort, which is looked up again on each new pod to find its remote port.
+// Failed reconnect attempts count against breaker, which pauses reconnecting when it opens.
+func followPortForward(config *rest.Config, clientset *kubernetes.Clientset, namespace, serviceName, podName, localPort string, remotePort, servicePort int32, addresses []string, endpoint, readyFile string, readyTimeout time.Duration, annotate bool, podSelect PodSelectOptions, breaker *circuitBreaker) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	if readyFile != "" {
+		defer os.Remove(readyFile)
+	}
+
+	established := false
+	reconnectFailed := func() {
+		if breaker.failure() {
+			fmt.Fprintf(output, "[%s] circuit open: %d reconnects failed within %s; pausing for %s\n", timeSource.Now().Format("15:04:05"), breaker.failures, breaker.window, breaker.cooldown)
+		}
+	}
+	for {
+		// Back off after a failed attempt; a dropped connection is retried at once
+		retry := timings.RetryInterval
+
+		stopChan := make(chan struct{}, 1)
+		readyChan := make(chan struct{})
+		errChan := make(chan error, 1)
+
+		ports := []string{fmt.Sprintf("%s:%d", localPort, remotePort)}
+		pf, err := newPortForwarder(config, namespace, podName, addresses, ports, stopChan, readyChan, io.Discard, os.Stderr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			errChan <- pf.ForwardPorts()
+		}()
+
+		select {
+		case <-readyChan:
+			breaker.success()
+			if annotate {
+				annotatePod(clientset, namespace, podName)
+			}
+			if !established {
+				printForegroundBanner(namespace, podName, localPort, remotePort, addresses, endpoint)
+				if readyFile != "" {
+					if err := writeReadyFile(readyFile, localPort); err != nil {
+						warnf("failed to write ready file: %v", err)
+					}
+				}
+				established = true
+			} else {
+				fmt.Fprintf(output, "[%s] reconnected to pod %s\n", timeSource.Now().Format("15:04:05"), podName)
+			}
+
+			select {
+			case err := <-errChan:
+				if annotate {
+					unannotatePod(clientset, namespace, podName)
+				}
+				fmt.Fprintf(output, "[%s] connection to pod %s lost: %v; reconnecting...\n", timeSource.Now().Format("15:04:05"), podName, err)
+				retry = 0
+			case <-sig:
+				fmt.Fprintln(output, "\nStopping port-forward...")
+				close(stopChan)
+				<-errChan
+				if annotate {
+					unannotatePod(clientset, namespace, podName)
+				}
+				fmt.Fprintln(output, "Port-forward stopped.")
+				return nil
+			}
+		case err := <-errChan:
+			if !established {
+				if err != nil {
+					return unreachableError("port-forward failed: %v", err)
+				}
+				return unreachableError("port-forward exited before becoming ready")
+			}
+			fmt.Fprintf(output, "[%s] reconnect failed: %v\n", timeSource.Now().Format("15:04:05"), err)
+			reconnectFailed()
+		case <-timeSource.After(readyTimeout):
+			close(stopChan)
+			<-errChan
+			if !established {
+				return unreachableError("port-forward was not ready after %s (use --ready-timeout to wait longer)", readyTimeout)
+			}
+			fmt.Fprintf(output, "[%s] reconnect to pod %s timed out\n", timeSource.Now().Format("15:04:05"), podName)
+			reconnectFailed()
+		case <-sig:
+			close(stopChan)
+			<-errChan
+			fmt.Fprintln(output, "Port-forward stopped.")
+			return nil
+		}
+
+		// Pick a pod again, since the old one may be gone, retrying until one is available
+		for {
+			if wait := breaker.wait(); wait > retry {
+				retry = wait
+			}
+			select {
+			case <-timeSource.After(retry):
+			case <-sig:
+				fmt.Fprintln(output, "Port-forward stopped.")
+				return nil
+			}
+			newPod, newRemotePort, err := resolveServicePod(clientset, namespace, serviceName, servicePort, podSelect, false)
+			if err == nil {
+				podName = newPod.Name
+				if newRemotePort != 0 {
+					remotePort = newRemotePort
+				}
+				break
+			}
+			fmt.Fprintf(output, "[%s] reconnecting... %v\n", timeSource.Now().Format("15:04:05"), err)
+			reconnectFailed()
+			retry = timings.RetryInterval
+		}
+	}
+}
+
+// checkConnectionLimit refuses to start another daemon when max are already running.
+// A max of 0 uses the limit from the config file.
+func checkConnectionLimit(max int) error {
+	if max == 0 {
+		max = config.NewConfig().LoadMaxConnections()
+	}
+
+	// Connections that cannot be counted must not turn the limit off
+	connections, err := loadConnections()
+	if err != nil {
+		return fmt.Errorf("cannot check the connection limit: %v; pass --force to start anyway", err)
+	}
+
+	running := 0
+	for _, conn := range connections {
+		if isProcessRunning(conn.PID) {
+			running++
+		}
+	}
+	if running >= max {
+		return limitError("%d connections are already running (limit %d); disconnect some, raise the limit with --max-connections or bugx config set-max-connections, or pass --force", running, max)
+	}
+	return nil
+}
+
+// backgroundOptions controls how a background port-forward is started and reported
+type backgroundOptions struct {
+	sync         bool
+	sinceLog     int
+	hook         *execHook
+	readyFile    string
+	readyTimeout time.Duration
+	noBanner     bool   // callers starting several tunnels print their own summary
+	endpoint     string // connection string printed on stdout once the daemon runs (connect --print-endpoint)
+
+	// diagnose, if set, returns cluster-side diagnostics to add when the daemon fails to start
+	diagnose func() string
+}
+
+// daemonExecutable returns the binary to spawn as the background daemon.
+// BUGX_DAEMON_BIN overrides the current executable, e.g. to run bugx under a wrapper.
+func daemonExecutable() (string, error) {
+	if path := os.Getenv("BUGX_DAEMON_BIN"); path != "" {
+		return path, nil
+	}
+
 	// Get current executable path
 	execPath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %v", err)
+		return "", fmt.Errorf("failed to get executable path: %v", err)
+	}
+	return execPath, nil
+}
+
+// createBackgroundPortForward creates a port-forward connection in background by spawning a daemon process.
+// conn describes the tunnel; its PID, status and log file are filled in once the daemon is running.
+func createBackgroundPortForward(conn ConnectionInfo, opts backgroundOptions) error {
+	// A daemon that cannot be recorded could not be listed or stopped by bugx later
+	if err := checkStoreWritable(); err != nil {
+		return fmt.Errorf("cannot start a background connection without saving it (%v); use --background=false to forward in the foreground instead", err)
 	}
 
+	execPath, err := daemonExecutable()
+	if err != nil {
+		return err
+	}
+
+	// Connections recorded before the transport was stored use the current setting
+	transport := conn.Transport
+	if transport == "" {
+		transport = forwardTransport
+	}
+
+	breaker := conn.breakerSettings()
+
 	// Use nohup or direct exec with proper daemonization
 	// Create command to run daemon
-	cmd := exec.Command(execPath, "daemon", "portforward",
-		"--kubeconfig", kubeconfigPath,
-		"--namespace", namespace,
-		"--service", serviceName,
-		"--pod", podName,
-		"--localport", localPort,
-		"--remoteport", strconv.Itoa(int(remotePort)),
-	)
-
-	// Set up process group to detach from parent
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setsid: true, // Create new session (daemon)
+	args := []string{"daemon", "portforward",
+		"--kubeconfig", conn.Kubeconfig,
+		"--context", conn.Context,
+		"--namespace", conn.Namespace,
+		"--service", conn.ServiceName,
+		"--pod", conn.PodName,
+		"--pod-namespace", conn.PodNamespace,
+		"--pod-from-endpoints=" + strconv.FormatBool(conn.PodFromEndpoints),
+		"--localport", conn.LocalPort,
+		"--remoteport", strconv.Itoa(int(conn.RemotePort)),
+		"--service-port", strconv.Itoa(int(conn.ServicePort)),
+		"--address", conn.Address,
+		"--request-timeout", requestTimeout.String(),
+		"--transport", transport,
+		"--ping-interval", conn.PingInterval.String(),
+		"--ssh-jump", conn.SSHJump,
+		"--ready-file", opts.readyFile,
+		"--ready-timeout", opts.readyTimeout.String(),
+		"--tls-server-name", conn.TLSServerName,
+		"--insecure-skip-tls-verify=" + strconv.FormatBool(conn.InsecureSkipTLSVerify),
+		"--annotate-pod=" + strconv.FormatBool(conn.AnnotatePod),
+		"--mirror", formatMirrors(conn.Mirrors),
+		"--health-cmd", conn.HealthCmd,
+		"--pod-selection", conn.PodSelection,
+		"--owner", conn.Owner,
+		"--expires-at", formatExpiry(conn.ExpiresAt),
+		"--breaker-failures", strconv.Itoa(breaker.Failures),
+		"--breaker-window", breaker.Window.String(),
+		"--breaker-cooldown", breaker.Cooldown.String(),
 	}
+	cmd := exec.Command(execPath, args...)
+
+	// Detach from the parent so the daemon outlives this process and its terminal
+	cmd.SysProcAttr = daemonSysProcAttr()
 
-	// Redirect stdin/stdout/stderr to /dev/null or log file
-	nullFile, err := os.OpenFile("/dev/null", os.O_WRONLY, 0)
+	// Stdout and stderr go to the connection's log file. Streams left nil are connected to
+	// os.DevNull by exec on every platform; a non-file writer such as io.Discard would be fed
+	// through a pipe that breaks once this process exits, failing the detached daemon's writes.
+	cmd.Stdin = nil
+	logPath := getLogFile(conn.Context, conn.Namespace, conn.ServiceName)
+	logFile, err := openLogFile(logPath)
 	if err != nil {
-		// Fallback to Discard if /dev/null not available
-		cmd.Stdin = nil
-		cmd.Stdout = io.Discard
-		cmd.Stderr = io.Discard
+		warnf("failed to open daemon log file, output will be discarded: %v", err)
+		logPath = ""
 	} else {
-		cmd.Stdin = nullFile
-		cmd.Stdout = nullFile
-		cmd.Stderr = nullFile
-		defer nullFile.Close()
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		defer logFile.Close()
 	}
 
 	// Start the daemon process (don't wait for it)
 	if err := cmd.Start(); err != nil {
+		recordHistory("connect", conn, err)
 		return fmt.Errorf("failed to start daemon process: %v", err)
 	}
 
 	pid := cmd.Process.Pid
 
-	// Don't wait for the process - let it run independently
-	// Release the process handle so parent can exit
-	_ = cmd.Process.Release()
+	// Reap the process if it exits while we are still around, so an early
+	// failure is not hidden behind a zombie that still answers signal 0
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
 
 	// Give it a moment to start and initialize
-	time.Sleep(800 * time.Millisecond)
+	<-timeSource.After(timings.SpawnWait)
 
 	// Check if process is still running (give it more time)
-	time.Sleep(200 * time.Millisecond)
-	if !isProcessRunning(pid) {
+	<-timeSource.After(timings.SpawnCheck)
+	select {
+	case <-exited:
 		// Daemon failed to start - return error instead of falling back
-		return fmt.Errorf("daemon process (PID %d) failed to start or exited immediately. The daemon may have encountered an error. Try running the daemon manually to see the error: bugx daemon portforward --kubeconfig %s --namespace %s --service %s --pod %s --localport %s --remoteport %d",
-			pid, kubeconfigPath, namespace, serviceName, podName, localPort, remotePort)
+		recordHistory("connect", conn, fmt.Errorf("daemon exited immediately (log: %s)", logPath))
+		diagnostics := ""
+		if opts.diagnose != nil {
+			diagnostics = "\n\n" + opts.diagnose()
+		}
+		if logPath != "" && opts.sinceLog > 0 {
+			if lines, err := tailFile(logPath, opts.sinceLog); err == nil && len(lines) > 0 {
+				return unreachableError("daemon process (PID %d) failed to start or exited immediately. Last %d lines of %s:\n\n  %s%s",
+					pid, len(lines), logPath, strings.Join(lines, "\n  "), diagnostics)
+			}
+		}
+		if diagnostics != "" {
+			return unreachableError("daemon process (PID %d) failed to start or exited immediately (log: %s)%s", pid, logPath, diagnostics)
+		}
+		return unreachableError("daemon process (PID %d) failed to start or exited immediately. The daemon may have encountered an error. Try running the daemon manually to see the error: %s",
+			pid, shellJoin(append([]string{execPath}, args...)))
+	default:
 	}
 
 	// Save connection info
-	conn := ConnectionInfo{
-		PID:         pid,
-		ServiceName: serviceName,
-		Namespace:   namespace,
-		LocalPort:   localPort,
-		RemotePort:  remotePort,
-		PodName:     podName,
-		Kubeconfig:  kubeconfigPath,
-		Status:      "active",
-	}
+	conn.PID = pid
+	conn.Status = "active"
+	conn.StartedAt = timeSource.Now()
+	conn.LogFile = logPath
 
 	if err := addConnection(conn); err != nil {
 		// Try to kill the process if we can't save connection info
 		if proc, err := os.FindProcess(pid); err == nil {
 			proc.Kill()
 		}
+		recordHistory("connect", conn, err)
 		return fmt.Errorf("failed to save connection info: %v", err)
 	}
+	recordHistory("connect", conn, nil)
 
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Printf("  Port-forward started in background!\n")
-	fmt.Printf("  Service: %s/%s\n", namespace, serviceName)
-	fmt.Printf("  Pod:     %s\n", podName)
-	fmt.Printf("  Local:   localhost:%s\n", localPort)
-	fmt.Printf("  Remote:  %d\n", remotePort)
-	fmt.Printf("  PID:     %d\n", pid)
-	fmt.Println()
-	fmt.Printf("  Use 'bugx connect list' to see all connections\n")
-	fmt.Printf("  Use 'bugx disconnect %s' to stop this connection\n", serviceName)
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
+	if opts.sync {
+		if err := syncConnection(conn); err != nil {
+			warnf("%v", err)
+		}
+	}
 
-	return nil
+	if opts.noBanner {
+		printEndpointLine(opts.endpoint)
+		return opts.hook.run(conn.LocalPort)
+	}
+
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintf(output, "  Port-forward started in background!\n")
+	fmt.Fprintf(output, "  Service: %s/%s\n", conn.Namespace, conn.ServiceName)
+	fmt.Fprintf(output, "  Pod:     %s\n", conn.podRef())
+	fmt.Fprintf(output, "  Local:   %s\n", localEndpoint(conn.Addresses(), conn.LocalPort))
+	fmt.Fprintf(output, "  Remote:  %d\n", conn.RemotePort)
+	fmt.Fprintf(output, "  PID:     %d\n", pid)
+	fmt.Fprintln(output)
+	fmt.Fprintf(output, "  Use 'bugx connect list' to see all connections\n")
+	fmt.Fprintf(output, "  Use 'bugx disconnect %s' to stop this connection\n", conn.ServiceName)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(output)
+	opts.hook.printExports()
+	printEndpointLine(opts.endpoint)
+
+	return opts.hook.run(conn.LocalPort)
+}
+
+// formatExpiry formats a connection's expiry for the daemon's --expires-at, empty when it has none
+func formatExpiry(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return ""
+	}
+	return expiresAt.Format(time.RFC3339)
 }
 
 // createBackgroundPortForwardInProcess creates port-forward in current process (fallback)
-func createBackgroundPortForwardInProcess(config *rest.Config, namespace, serviceName, podName, localPort string, remotePort int32, kubeconfigPath string) error {
+func createBackgroundPortForwardInProcess(config *rest.Config, namespace, serviceName, podName, localPort string, remotePort int32, addresses []string, kubeconfigPath string) error {
 	stopChan := make(chan struct{}, 1)
 	readyChan := make(chan struct{})
 	errChan := make(chan error, 1)
 
 	go func() {
-		err := runPortForwardInGoroutine(config, namespace, podName, localPort, remotePort, stopChan, readyChan)
+		err := runPortForwardInGoroutine(config, namespace, podName, localPort, remotePort, addresses, stopChan, readyChan)
 		if err != nil {
 			errChan <- err
 		}
@@ -365,6 +1690,7 @@ func createBackgroundPortForwardInProcess(config *rest.Config, namespace, servic
 			LocalPort:   localPort,
 			RemotePort:  remotePort,
 			PodName:     podName,
+			Address:     strings.Join(addresses, ","),
 			Kubeconfig:  kubeconfigPath,
 			Status:      "active",
 		}
@@ -374,20 +1700,20 @@ func createBackgroundPortForwardInProcess(config *rest.Config, namespace, servic
 			return fmt.Errorf("failed to save connection info: %v", err)
 		}
 
-		fmt.Println()
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Printf("  Port-forward started in background!\n")
-		fmt.Printf("  Service: %s/%s\n", namespace, serviceName)
-		fmt.Printf("  Pod:     %s\n", podName)
-		fmt.Printf("  Local:   localhost:%s\n", localPort)
-		fmt.Printf("  Remote:  %d\n", remotePort)
-		fmt.Printf("  PID:     %d\n", pid)
-		fmt.Println()
-		fmt.Printf("  Note: Process will keep running in background.\n")
-		fmt.Printf("  Use 'bugx connect list' to see all connections\n")
-		fmt.Printf("  Use 'bugx disconnect %s' to stop this connection\n", serviceName)
-		fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-		fmt.Println()
+		fmt.Fprintln(output)
+		fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Fprintf(output, "  Port-forward started in background!\n")
+		fmt.Fprintf(output, "  Service: %s/%s\n", namespace, serviceName)
+		fmt.Fprintf(output, "  Pod:     %s\n", podName)
+		fmt.Fprintf(output, "  Local:   %s\n", localEndpoint(addresses, localPort))
+		fmt.Fprintf(output, "  Remote:  %d\n", remotePort)
+		fmt.Fprintf(output, "  PID:     %d\n", pid)
+		fmt.Fprintln(output)
+		fmt.Fprintf(output, "  Note: Process will keep running in background.\n")
+		fmt.Fprintf(output, "  Use 'bugx connect list' to see all connections\n")
+		fmt.Fprintf(output, "  Use 'bugx disconnect %s' to stop this connection\n", serviceName)
+		fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		fmt.Fprintln(output)
 
 		// Set up signal handler to clean up on exit
 		sigChan := make(chan os.Signal, 1)
@@ -399,11 +1725,11 @@ func createBackgroundPortForwardInProcess(config *rest.Config, namespace, servic
 			case err := <-errChan:
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Port-forward error: %v\n", err)
-					updateConnectionStatus(serviceName, namespace, "stopped")
+					updateConnectionStatus("", serviceName, namespace, "stopped")
 				}
 			case <-sigChan:
 				close(stopChan)
-				removeConnection(serviceName, namespace)
+				removeConnection("", serviceName, namespace)
 				os.Exit(0)
 			}
 		}()
@@ -411,72 +1737,218 @@ func createBackgroundPortForwardInProcess(config *rest.Config, namespace, servic
 		// Block forever to keep process alive
 		select {}
 	case err := <-errChan:
-		return fmt.Errorf("port-forward failed: %v", err)
+		return unreachableError("port-forward failed: %v", err)
 	}
 }
 
 // runPortForwardInGoroutine runs port-forward in a goroutine
-func runPortForwardInGoroutine(config *rest.Config, namespace, podName, localPort string, remotePort int32, stopChan chan struct{}, readyChan chan struct{}) error {
-	transport, upgrader, err := spdy.RoundTripperFor(config)
+func runPortForwardInGoroutine(config *rest.Config, namespace, podName, localPort string, remotePort int32, addresses []string, stopChan chan struct{}, readyChan chan struct{}) error {
+	ports := []string{fmt.Sprintf("%s:%d", localPort, remotePort)}
+	pf, err := newPortForwarder(config, namespace, podName, addresses, ports, stopChan, readyChan, io.Discard, io.Discard)
 	if err != nil {
-		return fmt.Errorf("failed to create round tripper: %v", err)
+		return err
 	}
 
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
-	hostIP := strings.TrimPrefix(config.Host, "https://")
-	hostIP = strings.TrimPrefix(hostIP, "http://")
+	return pf.ForwardPorts()
+}
 
-	serverURL := &url.URL{
-		Scheme: "https",
-		Path:   path,
-		Host:   hostIP,
+// displayConnections displays connections in a user-friendly format.
+// Unless groupBy is "none", connections are printed beneath a header per group.
+// With wide set, transfer counts are shown for each connection.
+func displayConnections(connections []ConnectionInfo, groupBy string, wide bool) {
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	if len(connections) == 0 {
+		fmt.Fprintln(output, "  No Active Connections")
+	} else {
+		fmt.Fprintf(output, "  Active Connections (%d)\n", len(connections))
+	}
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(output)
+
+	if groupBy == "none" {
+		for i, conn := range connections {
+			displayConnection(i+1, conn, fmt.Sprintf("%s/%s", conn.Namespace, conn.ServiceName), "  ", wide)
+			if i < len(connections)-1 {
+				fmt.Fprintln(output)
+			}
+		}
+	} else {
+		index := 1
+		groups := groupConnections(connections, groupBy)
+		for g, group := range groups {
+			fmt.Fprintf(output, "  %s: %s (%d)\n", groupBy, group.name, len(group.connections))
+			for _, conn := range group.connections {
+				title := conn.ServiceName
+				if groupBy != "namespace" {
+					title = fmt.Sprintf("%s/%s", conn.Namespace, conn.ServiceName)
+				}
+				fmt.Fprintln(output)
+				displayConnection(index, conn, title, "    ", wide)
+				index++
+			}
+			if g < len(groups)-1 {
+				fmt.Fprintln(output)
+			}
+		}
 	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
 
-	ports := []string{fmt.Sprintf("%s:%d", localPort, remotePort)}
-	pf, err := portforward.New(dialer, ports, stopChan, readyChan, io.Discard, io.Discard)
-	if err != nil {
-		return fmt.Errorf("failed to create port-forward: %v", err)
-	}
+// portMapping is one entry of connect list -o ports-json. Scripts depend on this shape:
+// fields may be added, but never renamed or removed.
+type portMapping struct {
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	LocalPort string `json:"localPort"`
+}
 
-	return pf.ForwardPorts()
+// newPortMappings trims connections to their service-to-local-port mapping
+func newPortMappings(connections []ConnectionInfo) []portMapping {
+	mappings := make([]portMapping, 0, len(connections))
+	for _, conn := range connections {
+		mappings = append(mappings, portMapping{
+			Service:   conn.ServiceName,
+			Namespace: conn.Namespace,
+			LocalPort: conn.LocalPort,
+		})
+	}
+	return mappings
 }
 
-// displayConnections displays connections in a user-friendly format
-func displayConnections(connections []ConnectionInfo) {
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	if len(connections) == 0 {
-		fmt.Println("  No Active Connections")
-	} else {
-		fmt.Printf("  Active Connections (%d)\n", len(connections))
+// displayConnectionsCompact displays one connection per line in aligned columns.
+// A TTL column is added when any connection was made with connect --ttl.
+func displayConnectionsCompact(connections []ConnectionInfo, wide bool) {
+	withTTL := false
+	for _, conn := range connections {
+		if !conn.ExpiresAt.IsZero() {
+			withTTL = true
+		}
 	}
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
 
-	for i, conn := range connections {
-		fmt.Printf("  [%d] %s/%s\n", i+1, conn.Namespace, conn.ServiceName)
-		fmt.Printf("      Pod:      %s\n", conn.PodName)
-		fmt.Printf("      Local:    localhost:%s\n", conn.LocalPort)
-		fmt.Printf("      Remote:   %d\n", conn.RemotePort)
-		fmt.Printf("      PID:      %d\n", conn.PID)
-		fmt.Printf("      Status:   %s\n", conn.Status)
-		if i < len(connections)-1 {
-			fmt.Println()
+	w := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+	fmt.Fprint(w, "NAMESPACE\tSERVICE\tLOCAL\tREMOTE\tPID\tSTATUS")
+	if withTTL {
+		fmt.Fprint(w, "\tTTL")
+	}
+	if wide {
+		fmt.Fprint(w, "\tIN\tOUT\tSERVER")
+	}
+	fmt.Fprintln(w)
+	for _, conn := range connections {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s",
+			conn.Namespace, conn.ServiceName, localEndpoint(conn.Addresses(), conn.LocalPort), conn.RemotePort, conn.PID, conn.Status)
+		if withTTL {
+			ttl := "-"
+			if !conn.ExpiresAt.IsZero() {
+				ttl = conn.ttlRemaining()
+			}
+			fmt.Fprintf(w, "\t%s", ttl)
+		}
+		if wide {
+			fmt.Fprintf(w, "\t%s\t%s\t%s", formatBytes(conn.BytesIn), formatBytes(conn.BytesOut), conn.Server)
 		}
+		fmt.Fprintln(w)
 	}
+	w.Flush()
+}
 
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+// displayConnection displays a single connection entry with the given indentation
+func displayConnection(index int, conn ConnectionInfo, title, indent string, wide bool) {
+	fmt.Fprintf(output, "%s[%d] %s\n", indent, index, title)
+	if conn.Alias != "" {
+		fmt.Fprintf(output, "%s    Alias:    %s\n", indent, conn.Alias)
+	}
+	fmt.Fprintf(output, "%s    Pod:      %s\n", indent, conn.podRef())
+	fmt.Fprintf(output, "%s    Local:    %s\n", indent, localEndpoint(conn.Addresses(), conn.LocalPort))
+	for _, mirror := range conn.Mirrors {
+		fmt.Fprintf(output, "%s    Mirror:   %s -> %s\n", indent, localEndpoint(conn.Addresses(), mirror.LocalPort), mirror.PodName)
+	}
+	fmt.Fprintf(output, "%s    Remote:   %d\n", indent, conn.RemotePort)
+	fmt.Fprintf(output, "%s    PID:      %d\n", indent, conn.PID)
+	fmt.Fprintf(output, "%s    Status:   %s\n", indent, conn.Status)
+	if conn.Status == "circuit-open" && !conn.CircuitOpenUntil.IsZero() {
+		fmt.Fprintf(output, "%s    Circuit:  open, next reconnect at %s\n", indent, conn.CircuitOpenUntil.Format("15:04:05"))
+	}
+	if !conn.ExpiresAt.IsZero() {
+		fmt.Fprintf(output, "%s    TTL:      %s (expires %s)\n", indent, conn.ttlRemaining(), conn.ExpiresAt.Format("15:04:05"))
+	}
+	if len(conn.Labels) > 0 {
+		fmt.Fprintf(output, "%s    Labels:   %s\n", indent, labels.Set(conn.Labels))
+	}
+	if conn.HealthCmd != "" {
+		fmt.Fprintf(output, "%s    Health:   %s\n", indent, healthSummary(conn))
+	}
+	if wide {
+		fmt.Fprintf(output, "%s    In:       %s\n", indent, formatBytes(conn.BytesIn))
+		fmt.Fprintf(output, "%s    Out:      %s\n", indent, formatBytes(conn.BytesOut))
+		if conn.Server != "" {
+			fmt.Fprintf(output, "%s    Server:   %s\n", indent, conn.Server)
+		}
+		if conn.Command != "" {
+			fmt.Fprintf(output, "%s    Command:  %s\n", indent, conn.Command)
+		}
+	}
 }
 
-// isProcessRunning checks if a process is still running
-func isProcessRunning(pid int) bool {
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return false
+// healthSummary describes the last --health-cmd result of a connection
+func healthSummary(conn ConnectionInfo) string {
+	if conn.HealthCheckedAt.IsZero() {
+		return "not checked yet"
 	}
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	return fmt.Sprintf("%s (at %s)", conn.HealthResult, conn.HealthCheckedAt.Format("15:04:05"))
+}
+
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// connectionGroup is a named set of connections for grouped display
+type connectionGroup struct {
+	name        string
+	connections []ConnectionInfo
+}
+
+// groupConnections groups connections by the given field, sorted by group name
+func groupConnections(connections []ConnectionInfo, groupBy string) []connectionGroup {
+	var groups []connectionGroup
+	positions := make(map[string]int)
+
+	for _, conn := range connections {
+		var name string
+		switch groupBy {
+		case "namespace":
+			name = conn.Namespace
+		case "context":
+			name = conn.Context
+			if name == "" {
+				name = "<unknown>"
+			}
+		}
+
+		pos, ok := positions[name]
+		if !ok {
+			pos = len(groups)
+			positions[name] = pos
+			groups = append(groups, connectionGroup{name: name})
+		}
+		groups[pos].connections = append(groups[pos].connections, conn)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
 }
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestResolveRemotePortRange(t *testing.T) {
+	annotated := func(value string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Annotations: map[string]string{forwardPortAnnotation: value}},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		}
+	}
+
+	for _, value := range []string{"1", "8080", "65535"} {
+		if _, err := resolveRemotePort(annotated(value), ""); err != nil {
+			t.Errorf("annotation %s: %v", value, err)
+		}
+	}
+	for _, value := range []string{"0", "-1", "65536", "99999"} {
+		_, err := resolveRemotePort(annotated(value), "")
+		if err == nil || !strings.Contains(err.Error(), "between 1 and 65535") {
+			t.Errorf("annotation %s: err = %v, want a port range error", value, err)
+		}
+		if _, err := resolveRemotePort(annotated("http"), value); err == nil || ExitCode(err) != ExitUsage {
+			t.Errorf("--remoteport %s: err = %v, want a usage error", value, err)
+		}
+	}
+}
+
+func TestDefaultLocalPort(t *testing.T) {
+	if port, ok := defaultLocalPort(5432); !ok || port != "5433" {
+		t.Errorf("defaultLocalPort(5432) = %q, %v, want 5433", port, ok)
+	}
+	if port, ok := defaultLocalPort(65534); !ok || port != "65535" {
+		t.Errorf("defaultLocalPort(65534) = %q, %v, want 65535", port, ok)
+	}
+	if port, ok := defaultLocalPort(65535); ok {
+		t.Errorf("defaultLocalPort(65535) = %q, want no default", port)
+	}
+}
+
+func TestConnectSyncRequiresBackground(t *testing.T) {
+	useTempStore(t)
+	t.Setenv("HOME", t.TempDir())
+
+	root := NewRootCmd()
+	root.SetArgs([]string{"connect", "web", "--background=false", "--sync"})
+	root.SilenceErrors, root.SilenceUsage = true, true
+	_, err := root.ExecuteC()
+	if err == nil || ExitCode(err) != ExitUsage || !strings.Contains(err.Error(), "--sync requires --background") {
+		t.Errorf("connect --background=false --sync: err = %v, want a usage error", err)
+	}
+}
+
+func TestExpandServicePrefix(t *testing.T) {
+	useTempStore(t)
+	clientset := fake.NewClientset(
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "payments-api", Namespace: "app"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "payments-db", Namespace: "app"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "app"}},
+	)
+
+	for prefix, want := range map[string]string{"web": "web", "we": "web", "payments-d": "payments-db", "nothing": "nothing"} {
+		if got, err := expandServicePrefix(clientset, "app", prefix); err != nil || got != want {
+			t.Errorf("expandServicePrefix(%q) = %q, %v, want %q", prefix, got, err, want)
+		}
+	}
+	if _, err := expandServicePrefix(clientset, "app", "payments"); ExitCode(err) != ExitUsage {
+		t.Errorf("ambiguous prefix: err = %v, want a usage error", err)
+	}
+
+	// A denied or failed lookup is reported as such, not as a missing service
+	clientset.PrependReactor("get", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "services"}, "web", errors.New("RBAC"))
+	})
+	if _, err := expandServicePrefix(clientset, "app", "web"); !apierrors.IsForbidden(err) {
+		t.Errorf("forbidden get: err = %v, want the API error", err)
+	}
+	clientset.PrependReactor("get", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+	})
+	if _, err := expandServicePrefix(clientset, "app", "web"); ExitCode(err) != ExitUnreachable {
+		t.Errorf("unavailable API server: err = %v, want exit code %d", err, ExitUnreachable)
+	}
+}
+
+func TestChooseServicePortListsThroughOutput(t *testing.T) {
+	var listed strings.Builder
+	previous, stdin := output, os.Stdin
+	output = &listed
+	t.Cleanup(func() { output, os.Stdin = previous, stdin })
+
+	// A pipe is not a terminal, so the preferred port is taken without a prompt
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	os.Stdin = reader
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "metrics", Port: 9090, Protocol: corev1.ProtocolTCP},
+			{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP},
+		}},
+	}
+	port, err := chooseServicePort(svc)
+	if err != nil || port != 80 {
+		t.Errorf("chooseServicePort() = %d, %v, want the preferred port 80", port, err)
+	}
+	if !strings.Contains(listed.String(), "Service web exposes 2 ports:") || !strings.Contains(listed.String(), "[2] 80/TCP (http)") {
+		t.Errorf("port list not written to output:\n%s", listed.String())
+	}
+}
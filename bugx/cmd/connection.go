@@ -1,48 +1,258 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"bugxcli/bugx/config"
 )
 
 // ConnectionInfo stores information about an active port-forward connection
 type ConnectionInfo struct {
 	PID         int    `json:"pid"`
 	ServiceName string `json:"service_name"`
+	Alias       string `json:"alias,omitempty"`
 	Namespace   string `json:"namespace"`
 	LocalPort   string `json:"local_port"`
 	RemotePort  int32  `json:"remote_port"`
+	ServicePort int32  `json:"service_port,omitempty"` // set when RemotePort is looked up again on each new pod, through a named targetPort or the endpoints of a service without a selector
 	PodName     string `json:"pod_name"`
+	Address     string `json:"address,omitempty"`
 	Kubeconfig  string `json:"kubeconfig"`
-	Status      string `json:"status"` // "active", "stopped"
+	Context     string `json:"context,omitempty"`
+	Cluster     string `json:"cluster,omitempty"` // the context's cluster in the kubeconfig
+	Server      string `json:"server,omitempty"`  // the API server the tunnel was opened through, as resolved at connect time
+	Status      string `json:"status"`            // "active", "unhealthy" (failing --health-cmd), "circuit-open" (reconnects paused), "draining", "stopped"
+	LogFile     string `json:"log_file,omitempty"`
+	Command     string `json:"command,omitempty"` // the invocation that created it, with connect --record-command
+
+	// PodNamespace is set when the pod was given with connect --pod or found through the
+	// hand-managed endpoints of a service without a selector (PodFromEndpoints), possibly in
+	// another namespace than the service. A --pod pod is kept on SIGHUP and restore instead of
+	// being re-resolved; restore looks up an endpoints pod in the endpoints again.
+	PodNamespace     string `json:"pod_namespace,omitempty"`
+	PodFromEndpoints bool   `json:"pod_from_endpoints,omitempty"`
+	PodSelection     string `json:"pod_selection,omitempty"` // connect --pod-selection, reused when the pod is picked again
+	Owner            string `json:"owner,omitempty"`         // connect --owner, likewise
+
+	Transport             string        `json:"transport,omitempty"`
+	PingInterval          time.Duration `json:"ping_interval,omitempty"`
+	SSHJump               string        `json:"ssh_jump,omitempty"`
+	TLSServerName         string        `json:"tls_server_name,omitempty"`
+	InsecureSkipTLSVerify bool          `json:"insecure_skip_tls_verify,omitempty"`
+	AnnotatePod           bool          `json:"annotate_pod,omitempty"`
+
+	// HealthCmd is run periodically by the daemon; its last result is kept alongside
+	HealthCmd       string    `json:"health_cmd,omitempty"`
+	HealthResult    string    `json:"health_result,omitempty"`
+	HealthCheckedAt time.Time `json:"health_checked_at,omitzero"`
+
+	// Mirrors are extra local ports forwarding the same remote port, each to its own pod
+	Mirrors []MirrorInfo `json:"mirrors,omitempty"`
+
+	Labels   map[string]string `json:"labels,omitempty"`
+	Restarts int               `json:"restarts,omitempty"`
+	BytesIn  int64             `json:"bytes_in,omitempty"`
+	BytesOut int64             `json:"bytes_out,omitempty"`
+
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	LastHealthy time.Time `json:"last_healthy,omitzero"`
+
+	// ExpiresAt is when the daemon stops and removes the connection, set with connect --ttl
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+
+	// Breaker configures the circuit breaker of the daemon's reconnects; nil uses the defaults.
+	// CircuitOpenUntil is set while the breaker is open and the daemon makes no attempt.
+	Breaker          *BreakerSettings `json:"breaker,omitempty"`
+	CircuitOpenUntil time.Time        `json:"circuit_open_until,omitzero"`
+}
+
+// connectionsFileVersion is the current schema version of the connections file
+const connectionsFileVersion = 1
+
+// connectionsStore is the on-disk format of the connections file
+type connectionsStore struct {
+	Version     int              `json:"version"`
+	Connections []ConnectionInfo `json:"connections"`
+}
+
+// TargetNamespace returns the namespace of the pod the connection forwards to
+func (c ConnectionInfo) TargetNamespace() string {
+	if c.PodNamespace != "" {
+		return c.PodNamespace
+	}
+	return c.Namespace
+}
+
+// podRef returns the pod name, prefixed with its namespace when that is not the service's
+func (c ConnectionInfo) podRef() string {
+	if c.TargetNamespace() != c.Namespace {
+		return c.TargetNamespace() + "/" + c.PodName
+	}
+	return c.PodName
+}
+
+// expired reports whether a connection made with connect --ttl is past its expiry
+func (c ConnectionInfo) expired() bool {
+	return !c.ExpiresAt.IsZero() && !timeSource.Now().Before(c.ExpiresAt)
+}
+
+// ttlRemaining describes the time left before a connection made with connect --ttl expires
+func (c ConnectionInfo) ttlRemaining() string {
+	left := c.ExpiresAt.Sub(timeSource.Now())
+	if left <= 0 {
+		return "expired"
+	}
+	return left.Round(time.Second).String()
+}
+
+// Addresses returns the local addresses the connection listens on
+func (c ConnectionInfo) Addresses() []string {
+	if c.Address == "" {
+		return defaultAddresses
+	}
+	return strings.Split(c.Address, ",")
 }
 
 var (
 	connectionsMutex sync.Mutex
-	connectionsFile  string
+	connectionsFile  string // without its extension, which follows storeFormat
+
+	// storeFormat is the format connections are written in, from the config (see config set-store-format)
+	storeFormat = config.StoreFormatJSON
 )
 
 func init() {
 	homeDir, _ := os.UserHomeDir()
 	configDir := filepath.Join(homeDir, ".bugx")
-	connectionsFile = filepath.Join(configDir, "connections.json")
+	connectionsFile = filepath.Join(configDir, "connections")
 }
 
-// getConnectionsFile returns the path to the connections file
+// getConnectionsFile returns the path to the connections file in the configured format
 func getConnectionsFile() string {
-	return connectionsFile
+	return connectionsFile + "." + storeFormat
+}
+
+// otherConnectionsFile returns the path the connections file has in the format not configured
+func otherConnectionsFile() string {
+	if storeFormat == config.StoreFormatYAML {
+		return connectionsFile + "." + config.StoreFormatJSON
+	}
+	return connectionsFile + "." + config.StoreFormatYAML
+}
+
+// existingConnectionsFile returns the connections file to read: the one in the configured
+// format, or, right after the format was changed, the one written in the other format
+func existingConnectionsFile() string {
+	path := getConnectionsFile()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(otherConnectionsFile()); err == nil {
+			return otherConnectionsFile()
+		}
+	}
+	return path
+}
+
+// getLogFile returns the path of the daemon log file for a connection.
+// Connections in a named context get the context as a prefix, so clusters don't share a log.
+func getLogFile(kubeContext, namespace, serviceName string) string {
+	name := fmt.Sprintf("%s_%s.log", namespace, serviceName)
+	if kubeContext != "" {
+		// Context names may contain path separators, e.g. EKS ARNs
+		name = strings.NewReplacer("/", "-", `\`, "-", ":", "-").Replace(kubeContext) + "_" + name
+	}
+	return filepath.Join(filepath.Dir(getConnectionsFile()), "logs", name)
+}
+
+// openLogFile creates (or truncates) a daemon log file
+func openLogFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
+// tailFile returns up to the last n lines of a file
+func tailFile(path string, n int) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// memoryStore holds the connections for the rest of the process once the connections
+// file cannot be written, e.g. because ~/.bugx is on a read-only or full filesystem
+var memoryStore struct {
+	enabled     bool
+	connections []ConnectionInfo
+}
+
+// isUnwritable reports whether err means the config directory cannot be written to
+func isUnwritable(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.ENOSPC) || os.IsPermission(err)
+}
+
+// fallBackToMemory keeps connections in memory for the rest of the session after a write failure
+func fallBackToMemory(connections []ConnectionInfo, err error) {
+	if !memoryStore.enabled {
+		warnf("cannot write %s, connections will not be saved this session: %v", getConnectionsFile(), err)
+	}
+	memoryStore.enabled = true
+	memoryStore.connections = append([]ConnectionInfo{}, connections...)
+}
+
+// checkStoreWritable reports an error when connections cannot be saved, because the session
+// already fell back to memoryStore or the connections file's directory cannot be written to
+func checkStoreWritable() error {
+	dir := filepath.Dir(getConnectionsFile())
+	if memoryStore.enabled {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
 }
 
 // loadConnections loads all connections from the file
 func loadConnections() ([]ConnectionInfo, error) {
-	filePath := getConnectionsFile()
+	if memoryStore.enabled {
+		return append([]ConnectionInfo{}, memoryStore.connections...), nil
+	}
+
+	filePath := existingConnectionsFile()
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0700); err != nil {
+		if isUnwritable(err) {
+			fallBackToMemory(nil, err)
+			return []ConnectionInfo{}, nil
+		}
 		return nil, fmt.Errorf("failed to create config directory: %v", err)
 	}
 
@@ -55,32 +265,102 @@ func loadConnections() ([]ConnectionInfo, error) {
 		return nil, fmt.Errorf("failed to read connections file: %v", err)
 	}
 
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return []ConnectionInfo{}, nil
+	}
+
+	// Files written before the schema was versioned hold a plain array
+	if data[0] == '[' {
+		return migrateConnections(data)
+	}
+
+	// The format is told by the content rather than the extension, so a file converted by hand
+	// (or a JSON file renamed to .yaml) still loads
+	var store connectionsStore
+	if data[0] == '{' {
+		err = json.Unmarshal(data, &store)
+	} else {
+		err = yaml.Unmarshal(data, &store)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connections file: %v", err)
+	}
+
+	if store.Version > connectionsFileVersion {
+		return nil, fmt.Errorf("connections file version %d is newer than supported version %d; please upgrade bugx", store.Version, connectionsFileVersion)
+	}
+
+	return store.Connections, nil
+}
+
+// migrateConnections upgrades a legacy plain-array connections file in place
+func migrateConnections(data []byte) ([]ConnectionInfo, error) {
 	var connections []ConnectionInfo
-	if len(data) > 0 {
-		if err := json.Unmarshal(data, &connections); err != nil {
-			return nil, fmt.Errorf("failed to parse connections file: %v", err)
-		}
+	if err := json.Unmarshal(data, &connections); err != nil {
+		return nil, fmt.Errorf("failed to parse connections file: %v", err)
+	}
+
+	if err := saveConnections(connections); err != nil {
+		return nil, fmt.Errorf("failed to migrate connections file: %v", err)
 	}
 
 	return connections, nil
 }
 
-// saveConnections saves connections to the file
+// saveConnections saves connections to the file.
+// If the file cannot be written, the session falls back to memoryStore instead of failing.
 func saveConnections(connections []ConnectionInfo) error {
+	if memoryStore.enabled {
+		fallBackToMemory(connections, nil)
+		return nil
+	}
+
 	filePath := getConnectionsFile()
 
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0700); err != nil {
+		if isUnwritable(err) {
+			fallBackToMemory(connections, err)
+			return nil
+		}
 		return fmt.Errorf("failed to create config directory: %v", err)
 	}
 
-	data, err := json.MarshalIndent(connections, "", "  ")
+	store := connectionsStore{
+		Version:     connectionsFileVersion,
+		Connections: connections,
+	}
+
+	var data []byte
+	var err error
+	if storeFormat == config.StoreFormatYAML {
+		data, err = yaml.Marshal(store)
+	} else {
+		data, err = json.MarshalIndent(store, "", "  ")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal connections: %v", err)
 	}
 
-	return os.WriteFile(filePath, data, 0600)
+	// Write under a temporary name and rename, so a full disk cannot leave a truncated file
+	tmpPath := filePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		if isUnwritable(err) {
+			fallBackToMemory(connections, err)
+			return nil
+		}
+		return err
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+
+	// After the format was changed, the file in the old format is superseded
+	os.Remove(otherConnectionsFile())
+	return nil
 }
 
 // addConnection adds a new connection to the list
@@ -97,8 +377,14 @@ func addConnection(conn ConnectionInfo) error {
 	return saveConnections(connections)
 }
 
-// removeConnection removes a connection by service name
-func removeConnection(serviceName, namespace string) error {
+// connectionMatches reports whether conn is the connection to serviceName in namespace
+// within kubeContext. An empty kubeContext matches every context.
+func connectionMatches(conn ConnectionInfo, kubeContext, serviceName, namespace string) bool {
+	return conn.ServiceName == serviceName && conn.Namespace == namespace && (kubeContext == "" || conn.Context == kubeContext)
+}
+
+// removeConnection removes a connection by context, service name and namespace
+func removeConnection(kubeContext, serviceName, namespace string) error {
 	connectionsMutex.Lock()
 	defer connectionsMutex.Unlock()
 
@@ -109,7 +395,7 @@ func removeConnection(serviceName, namespace string) error {
 
 	var updated []ConnectionInfo
 	for _, conn := range connections {
-		if conn.ServiceName != serviceName || conn.Namespace != namespace {
+		if !connectionMatches(conn, kubeContext, serviceName, namespace) {
 			updated = append(updated, conn)
 		}
 	}
@@ -117,8 +403,8 @@ func removeConnection(serviceName, namespace string) error {
 	return saveConnections(updated)
 }
 
-// updateConnectionStatus updates the status of a connection
-func updateConnectionStatus(serviceName, namespace, status string) error {
+// modifyConnection applies fn to the stored connection for the service and saves the result
+func modifyConnection(kubeContext, serviceName, namespace string, fn func(*ConnectionInfo)) error {
 	connectionsMutex.Lock()
 	defer connectionsMutex.Unlock()
 
@@ -128,8 +414,8 @@ func updateConnectionStatus(serviceName, namespace, status string) error {
 	}
 
 	for i := range connections {
-		if connections[i].ServiceName == serviceName && connections[i].Namespace == namespace {
-			connections[i].Status = status
+		if connectionMatches(connections[i], kubeContext, serviceName, namespace) {
+			fn(&connections[i])
 			return saveConnections(connections)
 		}
 	}
@@ -137,8 +423,91 @@ func updateConnectionStatus(serviceName, namespace, status string) error {
 	return fmt.Errorf("connection not found")
 }
 
-// findConnection finds a connection by service name and namespace
-func findConnection(serviceName, namespace string) (*ConnectionInfo, error) {
+// updateConnectionStatus updates the status of a connection
+func updateConnectionStatus(kubeContext, serviceName, namespace, status string) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		conn.Status = status
+	})
+}
+
+// updateConnectionPod records that a connection's forward was restarted against remotePort of
+// podName. A recorded pod namespace follows podNamespace, as the pod behind the endpoints of a
+// service without a selector may move to another namespace.
+func updateConnectionPod(kubeContext, serviceName, namespace, podNamespace, podName string, remotePort int32) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		if conn.PodNamespace != "" {
+			conn.PodNamespace = podNamespace
+		}
+		conn.PodName = podName
+		conn.RemotePort = remotePort
+		conn.Restarts++
+	})
+}
+
+// updateConnectionTarget records the pod and remote port a connection forwards to, without
+// counting a restart, for a pod picked again while retrying a restart already counted
+func updateConnectionTarget(kubeContext, serviceName, namespace, podNamespace, podName string, remotePort int32) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		if conn.PodNamespace != "" {
+			conn.PodNamespace = podNamespace
+		}
+		conn.PodName = podName
+		conn.RemotePort = remotePort
+	})
+}
+
+// updateConnectionStats records the cumulative bytes forwarded by a connection and,
+// unless lastHealthy is zero, when its forward was last seen running
+func updateConnectionStats(kubeContext, serviceName, namespace string, bytesIn, bytesOut int64, lastHealthy time.Time) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		conn.BytesIn = bytesIn
+		conn.BytesOut = bytesOut
+		if !lastHealthy.IsZero() {
+			conn.LastHealthy = lastHealthy
+		}
+	})
+}
+
+// updateConnectionHealth records the result of a health check, marking the connection
+// active when it passed and unhealthy when it failed
+func updateConnectionHealth(kubeContext, serviceName, namespace string, checkErr error, checkedAt time.Time) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		conn.HealthCheckedAt = checkedAt
+		if checkErr == nil {
+			conn.HealthResult = "ok"
+			conn.Status = "active"
+		} else {
+			conn.HealthResult = checkErr.Error()
+			conn.Status = "unhealthy"
+		}
+	})
+}
+
+// updateConnectionCircuit records that the daemon's circuit breaker opened until openUntil,
+// or, with a zero openUntil, that it closed again after a reconnect went through
+func updateConnectionCircuit(kubeContext, serviceName, namespace string, openUntil time.Time) error {
+	return modifyConnection(kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+		conn.CircuitOpenUntil = openUntil
+		if openUntil.IsZero() {
+			conn.Status = "active"
+		} else {
+			conn.Status = "circuit-open"
+		}
+	})
+}
+
+// breakerSettings returns the connection's circuit breaker settings, or the defaults
+func (c ConnectionInfo) breakerSettings() BreakerSettings {
+	if c.Breaker != nil {
+		return *c.Breaker
+	}
+	return BreakerSettings{Failures: defaultBreakerFailures, Window: defaultBreakerWindow, Cooldown: defaultBreakerCooldown}
+}
+
+// findConnection finds a connection by context, service name and namespace.
+// If no connection has that service name, one with a matching alias is returned.
+// With an empty kubeContext, a name used in several contexts is an error listing them.
+func findConnection(kubeContext, name, namespace string) (*ConnectionInfo, error) {
 	connectionsMutex.Lock()
 	defer connectionsMutex.Unlock()
 
@@ -147,11 +516,81 @@ func findConnection(serviceName, namespace string) (*ConnectionInfo, error) {
 		return nil, err
 	}
 
+	var matches []ConnectionInfo
 	for _, conn := range connections {
-		if conn.ServiceName == serviceName && conn.Namespace == namespace {
-			return &conn, nil
+		if connectionMatches(conn, kubeContext, name, namespace) {
+			matches = append(matches, conn)
+		}
+	}
+	if len(matches) == 0 {
+		for _, conn := range connections {
+			if conn.Alias != "" && conn.Alias == name && conn.Namespace == namespace && (kubeContext == "" || conn.Context == kubeContext) {
+				matches = append(matches, conn)
+			}
 		}
 	}
 
-	return nil, fmt.Errorf("connection not found")
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("connection not found")
+	case 1:
+		return &matches[0], nil
+	}
+	return nil, ambiguousContextError(name, namespace, matches)
+}
+
+// ambiguousContextError reports a name that matches connections in several contexts
+func ambiguousContextError(name, namespace string, matches []ConnectionInfo) error {
+	var contexts []string
+	for _, conn := range matches {
+		contexts = append(contexts, conn.Context)
+	}
+	return usageError("%s/%s has connections in several contexts (%s); select one with --context", namespace, name, strings.Join(contexts, ", "))
+}
+
+// findConnectionByPrefix finds the one connection in namespace whose service name or alias
+// starts with prefix. Several matches are an error listing the candidates.
+func findConnectionByPrefix(kubeContext, prefix, namespace string) (*ConnectionInfo, error) {
+	connectionsMutex.Lock()
+	defer connectionsMutex.Unlock()
+
+	connections, err := loadConnections()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ConnectionInfo
+	for _, conn := range connections {
+		if conn.Namespace != namespace || (kubeContext != "" && conn.Context != kubeContext) {
+			continue
+		}
+		if strings.HasPrefix(conn.ServiceName, prefix) || (conn.Alias != "" && strings.HasPrefix(conn.Alias, prefix)) {
+			matches = append(matches, conn)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, notFoundError("connection not found: %s/%s", namespace, prefix)
+	case 1:
+		return &matches[0], nil
+	}
+	var names []string
+	for _, conn := range matches {
+		names = append(names, conn.ServiceName)
+	}
+	if sameServiceName(matches) {
+		return nil, ambiguousContextError(matches[0].ServiceName, namespace, matches)
+	}
+	return nil, usageError("%q matches several connections in %s: %s", prefix, namespace, strings.Join(names, ", "))
+}
+
+// sameServiceName reports whether every connection is to the same service name
+func sameServiceName(connections []ConnectionInfo) bool {
+	for _, conn := range connections {
+		if conn.ServiceName != connections[0].ServiceName {
+			return false
+		}
+	}
+	return true
 }
@@ -3,9 +3,11 @@ package cmd
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 // NewDaemonCmd creates the daemon command (internal, used for background processes)
@@ -25,12 +27,28 @@ func NewDaemonCmd() *cobra.Command {
 // NewDaemonPortForwardCmd creates the daemon portforward command
 func NewDaemonPortForwardCmd() *cobra.Command {
 	var (
-		kubeconfig string
-		namespace  string
-		service    string
-		pod        string
-		localPort  string
-		remotePort string
+		kubeconfig    string
+		namespace     string
+		podNamespace  string
+		fromEndpoints bool
+		service       string
+		pod           string
+		localPort     string
+		remotePort    string
+		addresses     []string
+		readyFile     string
+		readyTimeout  time.Duration
+
+		tlsServerName         string
+		insecureSkipTLSVerify bool
+		annotate              bool
+		mirrorValues          []string
+		healthCmd             string
+		podSelection          string
+		owner                 string
+		expiresAt             string
+		servicePort           int32
+		breaker               circuitBreaker
 	)
 
 	cmd := &cobra.Command{
@@ -42,10 +60,25 @@ func NewDaemonPortForwardCmd() *cobra.Command {
 					kubeconfig, service, pod, localPort, remotePort)
 			}
 
+			if _, err := parseLocalPorts(localPort); err != nil {
+				return err
+			}
+			mirrors, err := parseMirrors(mirrorValues)
+			if err != nil {
+				return err
+			}
+
+			var expiry time.Time
+			if expiresAt != "" {
+				if expiry, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+					return fmt.Errorf("invalid --expires-at: %v", err)
+				}
+			}
+
 			// Build config
-			config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+			config, clientset, err := getClients(kubeconfig, kubeContextFlag)
 			if err != nil {
-				return fmt.Errorf("failed to build config: %v", err)
+				return err
 			}
 
 			// Parse remote port
@@ -54,8 +87,30 @@ func NewDaemonPortForwardCmd() *cobra.Command {
 				return fmt.Errorf("invalid remote port: %v", err)
 			}
 
+			config = withTLSOverrides(config, tlsServerName, insecureSkipTLSVerify)
+
 			// Run daemon
-			return runPortForwardDaemon(config, namespace, pod, localPort, int32(remotePortInt), service)
+			return runPortForwardDaemon(config, clientset, namespace, pod, localPort, int32(remotePortInt), addresses, service, daemonOptions{
+				readyFile:        readyFile,
+				readyTimeout:     readyTimeout,
+				annotatePod:      annotate,
+				mirrors:          mirrors,
+				healthCmd:        healthCmd,
+				podNamespace:     podNamespace,
+				podFromEndpoints: fromEndpoints,
+				kubeContext:      kubeContextFlag,
+				podSelect:        PodSelectOptions{Strategy: podSelection, Owner: owner},
+				servicePort:      servicePort,
+				breaker:          &breaker,
+				expiresAt:        expiry,
+				refreshCredentials: func() (*rest.Config, *kubernetes.Clientset, error) {
+					config, clientset, err := refreshClients(kubeconfig, kubeContextFlag, sshJump)
+					if err != nil {
+						return nil, nil, err
+					}
+					return withTLSOverrides(config, tlsServerName, insecureSkipTLSVerify), clientset, nil
+				},
+			})
 		},
 	}
 
@@ -63,8 +118,25 @@ func NewDaemonPortForwardCmd() *cobra.Command {
 	cmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace")
 	cmd.Flags().StringVar(&service, "service", "", "Service name")
 	cmd.Flags().StringVar(&pod, "pod", "", "Pod name")
+	cmd.Flags().StringVar(&podNamespace, "pod-namespace", "", "Namespace of the pod, if not the service's")
+	cmd.Flags().BoolVar(&fromEndpoints, "pod-from-endpoints", false, "The pod is taken from the endpoints of a service without a selector, and looked up there again on re-resolution")
 	cmd.Flags().StringVar(&localPort, "localport", "", "Local port")
 	cmd.Flags().StringVar(&remotePort, "remoteport", "", "Remote port")
+	cmd.Flags().Int32Var(&servicePort, "service-port", 0, "Service port whose named targetPort gives the remote port on each new pod")
+	cmd.Flags().StringSliceVar(&addresses, "address", defaultAddresses, "Local addresses to listen on")
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 10*time.Second, "How long to wait for the forward to become ready")
+	cmd.Flags().StringVar(&readyFile, "ready-file", "", "File to write the local port to once the forward is ready")
+	cmd.Flags().StringVar(&tlsServerName, "tls-server-name", "", "Server name to verify the API server certificate against")
+	cmd.Flags().BoolVar(&insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Skip verification of the API server certificate")
+	cmd.Flags().BoolVar(&annotate, "annotate-pod", false, "Annotate the forwarded pod while the tunnel is open")
+	cmd.Flags().StringVar(&healthCmd, "health-cmd", "", "Command template run periodically to check tunnel health")
+	cmd.Flags().StringVar(&podSelection, "pod-selection", "", "Strategy for picking a pod when re-resolving the service")
+	cmd.Flags().StringVar(&owner, "owner", "", "Only pick pods of this workload (kind/name) when re-resolving the service")
+	cmd.Flags().StringVar(&expiresAt, "expires-at", "", "Time (RFC 3339) at which to stop and remove the connection")
+	cmd.Flags().IntVar(&breaker.failures, "breaker-failures", defaultBreakerFailures, "Pause reconnecting after this many consecutive failed attempts within --breaker-window (0 never pauses)")
+	cmd.Flags().DurationVar(&breaker.window, "breaker-window", defaultBreakerWindow, "The window in which --breaker-failures failed reconnects open the circuit breaker")
+	cmd.Flags().DurationVar(&breaker.cooldown, "breaker-cooldown", defaultBreakerCooldown, "How long reconnecting pauses once the circuit breaker opened")
+	cmd.Flags().StringSliceVar(&mirrorValues, "mirror", nil, "Extra local ports and the pod each forwards to, as localport=pod pairs")
 
 	return cmd
 }
@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain lets the test binary stand in for the daemon: spawned through BUGX_DAEMON_BIN with
+// BUGX_TEST_FAKE_DAEMON set, it writes to stdout and stderr, records its arguments and waits
+// to be killed, like a daemon that started successfully. With BUGX_TEST_FAKE_DAEMON set to
+// "exit" it fails at once instead, like a daemon that could not start.
+func TestMain(m *testing.M) {
+	if os.Getenv("BUGX_TEST_FAKE_DAEMON") == "exit" {
+		os.Exit(1)
+	}
+	if os.Getenv("BUGX_TEST_FAKE_DAEMON") == "1" {
+		fmt.Fprintln(os.Stdout, "fake daemon stdout")
+		fmt.Fprintln(os.Stderr, "fake daemon stderr")
+		if path := os.Getenv("BUGX_TEST_DAEMON_ARGS"); path != "" {
+			os.WriteFile(path, []byte(strings.Join(os.Args[1:], "\n")), 0600)
+		}
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// useTempStore points the connections file, logs and history at a temporary directory
+func useTempStore(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previousFile, previousOutput := connectionsFile, output
+	connectionsFile = filepath.Join(dir, "connections")
+	output = io.Discard
+	t.Cleanup(func() { connectionsFile, output = previousFile, previousOutput })
+	return dir
+}
+
+// spawnFakeDaemon starts conn in the background with the test binary as the daemon and
+// returns the recorded connection; the fake daemon is killed when the test ends
+func spawnFakeDaemon(t *testing.T, conn ConnectionInfo) ConnectionInfo {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BUGX_DAEMON_BIN", exe)
+	t.Setenv("BUGX_TEST_FAKE_DAEMON", "1")
+
+	previousTimings := timings
+	timings.SpawnWait, timings.SpawnCheck = 200*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { timings = previousTimings })
+
+	if err := createBackgroundPortForward(conn, backgroundOptions{hook: &execHook{}, readyTimeout: time.Second}); err != nil {
+		t.Fatalf("createBackgroundPortForward failed: %v", err)
+	}
+	recorded, err := findConnection(conn.Context, conn.ServiceName, conn.Namespace)
+	if err != nil {
+		t.Fatalf("connection was not recorded: %v", err)
+	}
+	t.Cleanup(func() {
+		if proc, err := os.FindProcess(recorded.PID); err == nil {
+			proc.Kill()
+		}
+	})
+	return *recorded
+}
+
+// waitForFile returns the content of path once it contains want, failing after a few seconds
+func waitForFile(t *testing.T, path, want string) string {
+	t.Helper()
+	var content []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		content, _ = os.ReadFile(path)
+		if strings.Contains(string(content), want) {
+			return string(content)
+		}
+	}
+	t.Fatalf("%s does not contain %q: %q", path, want, content)
+	return ""
+}
+
+func TestBackgroundDaemonOutputGoesToLogFile(t *testing.T) {
+	useTempStore(t)
+	conn := spawnFakeDaemon(t, ConnectionInfo{
+		ServiceName: "web", Namespace: "app", Context: "dev", LocalPort: "8081", RemotePort: 8080, PodName: "web-0", Kubeconfig: "/dev/null",
+	})
+
+	want := getLogFile("dev", "app", "web")
+	if conn.LogFile != want {
+		t.Fatalf("recorded log file = %q, want %q", conn.LogFile, want)
+	}
+	content := waitForFile(t, conn.LogFile, "fake daemon stderr")
+	if !strings.Contains(content, "fake daemon stdout") {
+		t.Errorf("log file is missing the daemon's stdout: %q", content)
+	}
+}
+
+func TestBackgroundDaemonSpawnArguments(t *testing.T) {
+	dir := useTempStore(t)
+	argsFile := filepath.Join(dir, "args")
+	t.Setenv("BUGX_TEST_DAEMON_ARGS", argsFile)
+
+	spawnFakeDaemon(t, ConnectionInfo{
+		ServiceName:  "db",
+		Namespace:    "app",
+		Context:      "prod",
+		LocalPort:    "5433",
+		RemotePort:   5432,
+		PodName:      "db-0",
+		PodNamespace: "data",
+		Address:      "127.0.0.1",
+		Kubeconfig:   "/home/me/.kube/config",
+		Owner:        "statefulset/db",
+		Transport:    "spdy",
+		Breaker:      &BreakerSettings{Failures: 3, Window: 30 * time.Second, Cooldown: 2 * time.Minute},
+
+		PodFromEndpoints: true,
+	})
+
+	args := strings.Split(waitForFile(t, argsFile, "portforward"), "\n")
+	if len(args) < 2 || args[0] != "daemon" || args[1] != "portforward" {
+		t.Fatalf("daemon was spawned as %q, want daemon portforward ...", args)
+	}
+	flags := make(map[string]string)
+	for i := 2; i < len(args); i++ {
+		name, value, inline := strings.Cut(args[i], "=")
+		if !inline && i+1 < len(args) {
+			value = args[i+1]
+			i++
+		}
+		flags[name] = value
+	}
+
+	want := map[string]string{
+		"--kubeconfig":         "/home/me/.kube/config",
+		"--context":            "prod",
+		"--namespace":          "app",
+		"--service":            "db",
+		"--pod":                "db-0",
+		"--pod-namespace":      "data",
+		"--pod-from-endpoints": "true",
+		"--localport":          "5433",
+		"--remoteport":         "5432",
+		"--address":            "127.0.0.1",
+		"--transport":          "spdy",
+		"--owner":              "statefulset/db",
+		"--expires-at":         "",
+		"--breaker-failures":   "3",
+		"--breaker-window":     "30s",
+		"--breaker-cooldown":   "2m0s",
+	}
+	for name, value := range want {
+		got, ok := flags[name]
+		if !ok {
+			t.Errorf("daemon was not passed %s", name)
+		} else if got != value {
+			t.Errorf("daemon got %s %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestConnectionCircuitState(t *testing.T) {
+	useTempStore(t)
+	conn := ConnectionInfo{ServiceName: "web", Namespace: "app", Context: "dev", LocalPort: "8081", RemotePort: 8080, Status: "active"}
+	if err := addConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := conn.breakerSettings(); got != (BreakerSettings{Failures: 5, Window: time.Minute, Cooldown: 5 * time.Minute}) {
+		t.Errorf("breakerSettings() without settings = %+v, want the defaults", got)
+	}
+
+	openUntil := time.Date(2026, 10, 16, 14, 5, 0, 0, time.Local)
+	if err := updateConnectionCircuit("dev", "web", "app", openUntil); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := findConnection("dev", "web", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Status != "circuit-open" || !recorded.CircuitOpenUntil.Equal(openUntil) {
+		t.Errorf("after the breaker opened: status %q, open until %s", recorded.Status, recorded.CircuitOpenUntil)
+	}
+	var listed strings.Builder
+	output = &listed
+	displayConnection(1, *recorded, "app/web", "", false)
+	if !strings.Contains(listed.String(), "Circuit:  open, next reconnect at 14:05:00") {
+		t.Errorf("connect list does not show the open circuit:\n%s", listed.String())
+	}
+
+	if err := updateConnectionCircuit("dev", "web", "app", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if recorded, _ = findConnection("dev", "web", "app"); recorded.Status != "active" || !recorded.CircuitOpenUntil.IsZero() {
+		t.Errorf("after the breaker closed: status %q, open until %s", recorded.Status, recorded.CircuitOpenUntil)
+	}
+}
+
+func TestConnectionRestartsCountedOnSamePod(t *testing.T) {
+	useTempStore(t)
+	conn := ConnectionInfo{ServiceName: "web", Namespace: "app", Context: "dev", LocalPort: "8081", RemotePort: 8080, PodName: "web-1", Status: "active"}
+	if err := addConnection(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	// A keepalive reconnect to the same pod is still a restart
+	for i := 0; i < 2; i++ {
+		if err := updateConnectionPod("dev", "web", "app", "app", "web-1", 8080); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A pod picked again while retrying that reconnect is not another one
+	if err := updateConnectionTarget("dev", "web", "app", "app", "web-2", 9090); err != nil {
+		t.Fatal(err)
+	}
+
+	recorded, err := findConnection("dev", "web", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Restarts != 2 || recorded.PodName != "web-2" || recorded.RemotePort != 9090 {
+		t.Errorf("record after two restarts and a retarget: restarts %d, pod %s:%d, want 2, web-2:9090", recorded.Restarts, recorded.PodName, recorded.RemotePort)
+	}
+}
+
+func TestBackgroundConnectionRefusedWithoutStore(t *testing.T) {
+	useTempStore(t)
+	previous := memoryStore
+	memoryStore.enabled = true
+	t.Cleanup(func() { memoryStore = previous })
+
+	conn := ConnectionInfo{ServiceName: "web", Namespace: "app", LocalPort: "8081", RemotePort: 8080, PodName: "web-1"}
+	err := createBackgroundPortForward(conn, backgroundOptions{})
+	if err == nil || !strings.Contains(err.Error(), "--background=false") {
+		t.Fatalf("createBackgroundPortForward() with an unwritable store: err = %v, want a refusal", err)
+	}
+	if connections, _ := loadConnections(); len(connections) != 0 {
+		t.Errorf("connections = %+v, want none recorded", connections)
+	}
+}
+
+func TestCheckConnectionLimit(t *testing.T) {
+	useTempStore(t)
+	if err := addConnection(ConnectionInfo{ServiceName: "web", Namespace: "app", LocalPort: "8081", PID: os.Getpid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkConnectionLimit(2); err != nil {
+		t.Errorf("checkConnectionLimit(2) with one running = %v, want nil", err)
+	}
+	if err := checkConnectionLimit(1); ExitCode(err) != ExitLimitReached {
+		t.Errorf("checkConnectionLimit(1) with one running = %v, want exit code %d", err, ExitLimitReached)
+	}
+
+	// A connections file that cannot be read does not turn the limit off
+	if err := os.WriteFile(getConnectionsFile(), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkConnectionLimit(2); err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("checkConnectionLimit() with an unreadable store = %v, want an error", err)
+	}
+}
+
+func TestFailedDaemonHintHasSpawnArguments(t *testing.T) {
+	useTempStore(t)
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BUGX_DAEMON_BIN", exe)
+	t.Setenv("BUGX_TEST_FAKE_DAEMON", "exit")
+	previousTimings := timings
+	timings.SpawnWait, timings.SpawnCheck = 200*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { timings = previousTimings })
+
+	conn := ConnectionInfo{
+		ServiceName: "db", Namespace: "app", Context: "prod", LocalPort: "5433", RemotePort: 5432,
+		PodName: "db-0", PodNamespace: "data", Address: "::1", Kubeconfig: "/home/me/my kube", Transport: "spdy",
+	}
+	err = createBackgroundPortForward(conn, backgroundOptions{hook: &execHook{}, readyTimeout: time.Second})
+	if ExitCode(err) != ExitUnreachable {
+		t.Fatalf("createBackgroundPortForward() with a failing daemon = %v, want an unreachable error", err)
+	}
+	for _, want := range []string{
+		shellQuote(exe) + " daemon portforward",
+		"--kubeconfig '/home/me/my kube'",
+		"--context prod",
+		"--pod-namespace data",
+		"--address ::1",
+		"--transport spdy",
+		"--ready-timeout 1s",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("hint does not contain %q:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxDiagnosticEvents is how many of the pod's most recent events are shown
+const maxDiagnosticEvents = 10
+
+// diagnoseConnectFailure gathers the cluster-side state that commonly explains a failed
+// forward: the pod's phase and container states, its recent events, and the service's
+// endpoint readiness. Lookups that fail are reported inline rather than aborting.
+func diagnoseConnectFailure(clientset *kubernetes.Clientset, svc *corev1.Service, podName string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Pod %s/%s:\n", svc.Namespace, podName)
+	pod, err := clientset.CoreV1().Pods(svc.Namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		fmt.Fprintf(&b, "  could not get pod: %v\n", err)
+	} else {
+		fmt.Fprintf(&b, "  Phase: %s, Ready: %t\n", pod.Status.Phase, isPodReady(pod))
+		for _, status := range pod.Status.ContainerStatuses {
+			fmt.Fprintf(&b, "  Container %s: %s (restarts: %d)\n", status.Name, containerState(status.State), status.RestartCount)
+		}
+	}
+
+	fmt.Fprintf(&b, "Recent events:\n")
+	events, err := clientset.CoreV1().Events(svc.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": podName,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		fmt.Fprintf(&b, "  could not list events: %v\n", err)
+	} else if len(events.Items) == 0 {
+		fmt.Fprintf(&b, "  <none>\n")
+	} else {
+		items := events.Items
+		sort.Slice(items, func(i, j int) bool {
+			return eventTime(items[i]).Before(eventTime(items[j]))
+		})
+		if len(items) > maxDiagnosticEvents {
+			items = items[len(items)-maxDiagnosticEvents:]
+		}
+		for _, event := range items {
+			fmt.Fprintf(&b, "  %s  %-7s %s: %s\n", eventTime(event).Format("15:04:05"), event.Type, event.Reason, strings.TrimSpace(event.Message))
+		}
+	}
+
+	fmt.Fprintf(&b, "Service %s/%s endpoints:\n", svc.Namespace, svc.Name)
+	ready, notReady, err := countEndpoints(clientset, svc)
+	if err != nil {
+		fmt.Fprintf(&b, "  %v\n", err)
+	} else {
+		fmt.Fprintf(&b, "  %d ready, %d not ready\n", ready, notReady)
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// containerState describes a container state, including the reason it is waiting or terminated
+func containerState(state corev1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return "Waiting: " + state.Waiting.Reason
+	case state.Terminated != nil:
+		return fmt.Sprintf("Terminated: %s (exit code %d)", state.Terminated.Reason, state.Terminated.ExitCode)
+	case state.Running != nil:
+		return "Running"
+	default:
+		return "Unknown"
+	}
+}
+
+// eventTime returns the most recent time an event was observed
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if event.EventTime.IsZero() {
+		return event.FirstTimestamp.Time
+	}
+	return event.EventTime.Time
+}
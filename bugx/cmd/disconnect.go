@@ -1,74 +1,282 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 // NewDisconnectCmd creates the disconnect command
 func NewDisconnectCmd() *cobra.Command {
-	var namespace string
+	var (
+		namespace    string
+		orphans      bool
+		verifyPods   bool
+		stale        bool
+		drain        bool
+		drainTimeout time.Duration
+	)
 
 	cmd := &cobra.Command{
-		Use:   "disconnect [servicename]",
+		Use:   "disconnect [servicename|alias]",
 		Short: "Disconnect a port-forward connection",
-		Long:  `Disconnect an active port-forward connection by service name.`,
-		Args:  cobra.ExactArgs(1),
+		Long: `Disconnect an active port-forward connection by service name.
+
+Use --orphans to clean up entries whose daemon died with an error instead,
+or --stale to remove every entry whose daemon is no longer running. Neither
+touches live tunnels (unless --verify-pods is given with --orphans).
+
+With --drain the daemon first stops accepting new local connections and
+keeps the open ones (e.g. a database session) alive until they close or
+--drain-timeout elapses, after which it is stopped as usual.`,
+		Args: cobra.RangeArgs(0, 1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			servicename := args[0]
+			if orphans && stale {
+				return usageError("--orphans and --stale cannot be used together")
+			}
+			if drain && drainSignal == nil {
+				return fmt.Errorf("--drain is not supported on this platform")
+			}
+			if orphans {
+				return cleanupOrphans(verifyPods)
+			}
+			if stale {
+				return cleanupStale()
+			}
 
-			if namespace == "" {
-				namespace = "default"
+			if len(args) != 1 {
+				return usageError("requires a service name (or --orphans or --stale)")
 			}
 
-			// Find connection
-			conn, err := findConnection(servicename, namespace)
+			name := args[0]
+
+			namespace = resolveNamespace(namespace)
+
+			// Find connection, falling back to a unique prefix of a service name or alias
+			conn, err := findConnection(kubeContextFlag, name, namespace)
 			if err != nil {
-				return fmt.Errorf("connection not found: %s/%s", namespace, servicename)
+				if conn, err = findConnectionByPrefix(kubeContextFlag, name, namespace); err != nil {
+					return err
+				}
 			}
+			servicename := conn.ServiceName
 
 			// Check if process is running
 			if !isProcessRunning(conn.PID) {
 				// Process already stopped, just remove from list
-				removeConnection(servicename, namespace)
-				fmt.Printf("Connection to %s/%s was already stopped.\n", namespace, servicename)
+				removeConnection(conn.Context, servicename, namespace)
+				fmt.Fprintf(output, "Connection to %s/%s was already stopped.\n", namespace, servicename)
 				return nil
 			}
 
-			// Kill the process
-			process, err := os.FindProcess(conn.PID)
-			if err != nil {
-				return fmt.Errorf("failed to find process %d: %v", conn.PID, err)
-			}
-
-			if err := process.Signal(syscall.SIGTERM); err != nil {
-				// Try SIGKILL if SIGTERM fails
-				if err := process.Signal(syscall.SIGKILL); err != nil {
-					return fmt.Errorf("failed to kill process %d: %v", conn.PID, err)
+			// Stop the process, letting open connections finish first with --drain
+			if drain {
+				fmt.Fprintf(output, "Draining %s/%s (up to %s)...\n", namespace, servicename, drainTimeout)
+				if err := drainProcess(conn.PID, drainTimeout); err != nil {
+					recordHistory("disconnect", *conn, err)
+					return err
 				}
+			} else if err := terminateProcess(conn.PID); err != nil {
+				recordHistory("disconnect", *conn, err)
+				return err
 			}
 
+			recordHistory("disconnect", *conn, nil)
+
 			// Remove from connections list
-			if err := removeConnection(servicename, namespace); err != nil {
+			if err := removeConnection(conn.Context, servicename, namespace); err != nil {
 				return fmt.Errorf("failed to remove connection: %v", err)
 			}
 
-			fmt.Println()
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Printf("  Connection Disconnected\n")
-			fmt.Printf("  Service: %s/%s\n", namespace, servicename)
-			fmt.Printf("  PID:     %d\n", conn.PID)
-			fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-			fmt.Println()
+			fmt.Fprintln(output)
+			fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+			fmt.Fprintf(output, "  Connection Disconnected\n")
+			fmt.Fprintf(output, "  Service: %s/%s\n", namespace, servicename)
+			fmt.Fprintf(output, "  PID:     %d\n", conn.PID)
+			fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+			fmt.Fprintln(output)
 
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace of the service")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().BoolVar(&orphans, "orphans", false, "Remove entries whose daemon is dead and whose log shows an error")
+	cmd.Flags().BoolVar(&stale, "stale", false, "Remove every entry whose daemon is no longer running, leaving live tunnels alone")
+	cmd.Flags().BoolVar(&drain, "drain", false, "Stop accepting new local connections and let open ones finish before stopping the daemon")
+	cmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "With --drain, how long open connections may take to close before the daemon is stopped anyway")
+	cmd.Flags().BoolVar(&verifyPods, "verify-pods", false, "With --orphans, also stop live daemons whose target pod no longer exists")
+
+	cmd.ValidArgsFunction = completeConnectionNames
 
 	return cmd
 }
+
+// terminateProcess sends SIGTERM to a process and waits for it to exit,
+// escalating to SIGKILL if it is still running after the configured grace period
+func terminateProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %v", pid, err)
+	}
+
+	if err := process.Signal(syscall.SIGTERM); err == nil && waitForExit(pid, timings.TerminateGrace) {
+		return nil
+	}
+
+	// The process ignored SIGTERM or could not be signaled; force it
+	if err := process.Signal(syscall.SIGKILL); err != nil && isProcessRunning(pid) {
+		return fmt.Errorf("failed to kill process %d: %v", pid, err)
+	}
+	if !waitForExit(pid, 2*time.Second) {
+		return fmt.Errorf("process %d is still running after SIGKILL", pid)
+	}
+
+	return nil
+}
+
+// drainProcess asks a daemon to drain its local connections and waits for it to exit,
+// terminating it if connections are still open after timeout
+func drainProcess(pid int, timeout time.Duration) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %v", pid, err)
+	}
+
+	if err := process.Signal(drainSignal); err == nil && waitForExit(pid, timeout) {
+		return nil
+	}
+
+	warnf("connections still open after %s, stopping daemon", timeout)
+	return terminateProcess(pid)
+}
+
+// waitForExit polls until the process has exited or the timeout elapses.
+// It reports whether the process exited.
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := timeSource.Now().Add(timeout)
+	for isProcessRunning(pid) {
+		if timeSource.Now().After(deadline) {
+			return false
+		}
+		<-timeSource.After(100 * time.Millisecond)
+	}
+	return true
+}
+
+// cleanupOrphans removes connection entries whose daemon died with an error and,
+// when verifyPods is set, stops live daemons whose target pod has been deleted
+func cleanupOrphans(verifyPods bool) error {
+	connections, err := loadConnections()
+	if err != nil {
+		return fmt.Errorf("failed to load connections: %v", err)
+	}
+
+	removed := 0
+
+	for _, conn := range connections {
+		reason := ""
+		if !isProcessRunning(conn.PID) {
+			if conn.LogFile == "" || !logShowsError(conn.LogFile) {
+				continue
+			}
+			reason = "daemon exited with an error"
+		} else if verifyPods {
+			gone, err := podGone(conn)
+			if err != nil {
+				warnf("could not verify pod for %s/%s: %v", conn.Namespace, conn.ServiceName, err)
+				continue
+			}
+			if !gone {
+				continue
+			}
+			if err := terminateProcess(conn.PID); err != nil {
+				warnf("%v", err)
+				continue
+			}
+			reason = fmt.Sprintf("pod %s no longer exists", conn.PodName)
+		} else {
+			continue
+		}
+
+		if err := removeConnection(conn.Context, conn.ServiceName, conn.Namespace); err != nil {
+			return fmt.Errorf("failed to remove connection: %v", err)
+		}
+		fmt.Fprintf(output, "  Removed %s/%s (PID %d): %s\n", conn.Namespace, conn.ServiceName, conn.PID, reason)
+		removed++
+	}
+
+	fmt.Fprintf(output, "Removed %d orphaned connection(s).\n", removed)
+	return nil
+}
+
+// cleanupStale removes every connection entry whose daemon is no longer running
+func cleanupStale() error {
+	connections, err := loadConnections()
+	if err != nil {
+		return fmt.Errorf("failed to load connections: %v", err)
+	}
+
+	removed := 0
+	for _, conn := range connections {
+		if isProcessRunning(conn.PID) {
+			continue
+		}
+		if err := removeConnection(conn.Context, conn.ServiceName, conn.Namespace); err != nil {
+			return fmt.Errorf("failed to remove connection: %v", err)
+		}
+		fmt.Fprintf(output, "  Removed %s/%s (PID %d)\n", conn.Namespace, conn.ServiceName, conn.PID)
+		removed++
+	}
+
+	fmt.Fprintf(output, "Removed %d stale connection(s).\n", removed)
+	return nil
+}
+
+// logShowsError reports whether a daemon log file contains an error line
+func logShowsError(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(scanner.Text())
+		if strings.Contains(line, "error") || strings.Contains(line, "failed") {
+			return true
+		}
+	}
+	return false
+}
+
+// podGone reports whether the pod a connection forwards to has been deleted
+func podGone(conn ConnectionInfo) (bool, error) {
+	_, clientset, err := getClients(conn.Kubeconfig, conn.Context)
+	if err != nil {
+		return false, err
+	}
+	return podDeleted(clientset, conn.TargetNamespace(), conn.PodName)
+}
+
+// podDeleted reports whether a pod no longer exists or is being deleted
+func podDeleted(clientset *kubernetes.Clientset, namespace, podName string) (bool, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return pod.DeletionTimestamp != nil, nil
+}
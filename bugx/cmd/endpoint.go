@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// schemeAnnotation lets service owners declare the protocol connect --print-endpoint uses,
+// e.g. postgresql or redis
+const schemeAnnotation = "bugx.io/scheme"
+
+// schemeAliases maps other common names of a protocol to the scheme printed
+var schemeAliases = map[string]string{
+	"postgres": "postgresql",
+	"mongo":    "mongodb",
+}
+
+// endpointFormats are the connection strings of well-known schemes, given the local host:port.
+// Other schemes are printed as scheme://host:port.
+var endpointFormats = map[string]string{
+	"postgresql": "postgresql://%s/",
+	"mysql":      "mysql://%s/",
+	"redis":      "redis://%s",
+	"mongodb":    "mongodb://%s/",
+	"amqp":       "amqp://%s/",
+	"http":       "http://%s/",
+	"https":      "https://%s/",
+}
+
+// portSchemes are the schemes of well-known port numbers, used when nothing else names one
+var portSchemes = map[int32]string{
+	5432:  "postgresql",
+	3306:  "mysql",
+	6379:  "redis",
+	27017: "mongodb",
+	5672:  "amqp",
+	80:    "http",
+	8080:  "http",
+	443:   "https",
+	8443:  "https",
+}
+
+// normalizeScheme lowercases a scheme given by a flag or annotation, drops a trailing ://
+// and resolves aliases such as postgres
+func normalizeScheme(scheme string) (string, error) {
+	scheme = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(scheme)), "://")
+	if scheme == "" || strings.Trim(scheme, "abcdefghijklmnopqrstuvwxyz0123456789+.-") != "" || scheme[0] < 'a' || scheme[0] > 'z' {
+		return "", fmt.Errorf("invalid scheme %q", scheme)
+	}
+	if alias, ok := schemeAliases[scheme]; ok {
+		scheme = alias
+	}
+	return scheme, nil
+}
+
+// knownScheme returns the well-known scheme a port name or appProtocol stands for, also
+// recognizing it as the first part of a name such as http-metrics
+func knownScheme(name string) string {
+	name = strings.ToLower(name)
+	if first, _, ok := strings.Cut(name, "-"); ok {
+		if scheme := knownScheme(first); scheme != "" {
+			return scheme
+		}
+	}
+	if alias, ok := schemeAliases[name]; ok {
+		return alias
+	}
+	if _, ok := endpointFormats[name]; ok {
+		return name
+	}
+	return ""
+}
+
+// endpointScheme returns the scheme of the connection string for a tunnel to remotePort of svc:
+// flagScheme if given, else the service's schemeAnnotation, else the one named by the service
+// port's appProtocol or name, else the one of a well-known port number
+func endpointScheme(svc *corev1.Service, remotePort int32, flagScheme string) (string, error) {
+	if flagScheme != "" {
+		scheme, err := normalizeScheme(flagScheme)
+		if err != nil {
+			return "", usageError("%v for --scheme", err)
+		}
+		return scheme, nil
+	}
+
+	if value, ok := svc.Annotations[schemeAnnotation]; ok {
+		scheme, err := normalizeScheme(value)
+		if err != nil {
+			return "", fmt.Errorf("service %s has invalid %s annotation: %v", svc.Name, schemeAnnotation, err)
+		}
+		return scheme, nil
+	}
+
+	for _, port := range svc.Spec.Ports {
+		if port.Port != remotePort && port.TargetPort.IntValue() != int(remotePort) {
+			continue
+		}
+		if port.AppProtocol != nil {
+			if scheme := knownScheme(*port.AppProtocol); scheme != "" {
+				return scheme, nil
+			}
+		}
+		if scheme := knownScheme(port.Name); scheme != "" {
+			return scheme, nil
+		}
+	}
+
+	if scheme, ok := portSchemes[remotePort]; ok {
+		return scheme, nil
+	}
+	return "", usageError("cannot tell the protocol of port %d of service %s for --print-endpoint; pass --scheme or annotate the service with %s", remotePort, svc.Name, schemeAnnotation)
+}
+
+// endpointURL returns the connection string for scheme to a tunnel's first local port.
+// A wildcard listen address is reached through localhost.
+func endpointURL(scheme string, addresses []string, localPort string) string {
+	host := "localhost"
+	if len(addresses) > 0 && addresses[0] != "0.0.0.0" && addresses[0] != "::" {
+		host = addresses[0]
+	}
+	port, _, _ := strings.Cut(localPort, ",")
+	hostPort := net.JoinHostPort(host, strings.TrimSpace(port))
+
+	if format, ok := endpointFormats[scheme]; ok {
+		return fmt.Sprintf(format, hostPort)
+	}
+	return scheme + "://" + hostPort
+}
+
+// printEndpointLine prints a connect --print-endpoint connection string on stdout, bypassing
+// --quiet so scripts can capture it; nothing is printed for an empty endpoint
+func printEndpointLine(endpoint string) {
+	if endpoint != "" {
+		fmt.Fprintln(os.Stdout, endpoint)
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes returned by bugx, so scripts can branch on the failure mode
+const (
+	ExitOK            = 0
+	ExitFailure       = 1 // any error not covered below
+	ExitUsage         = 2 // invalid arguments or flags
+	ExitNotFound      = 3 // service, connection or kubeconfig not found
+	ExitAlreadyExists = 4 // a connection with that name already exists
+	ExitUnreachable   = 5 // cluster, pod or service unreachable
+	ExitLimitReached  = 6 // the connection limit is reached
+)
+
+// exitError is an error carrying the exit code bugx should return for it
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// usageError reports invalid arguments or flags
+func usageError(format string, a ...interface{}) error {
+	return &exitError{code: ExitUsage, err: fmt.Errorf(format, a...)}
+}
+
+// notFoundError reports a missing service, connection or file
+func notFoundError(format string, a ...interface{}) error {
+	return &exitError{code: ExitNotFound, err: fmt.Errorf(format, a...)}
+}
+
+// alreadyExistsError reports a name that is already taken
+func alreadyExistsError(format string, a ...interface{}) error {
+	return &exitError{code: ExitAlreadyExists, err: fmt.Errorf(format, a...)}
+}
+
+// unreachableError reports a cluster, pod or service that could not be reached
+func unreachableError(format string, a ...interface{}) error {
+	return &exitError{code: ExitUnreachable, err: fmt.Errorf(format, a...)}
+}
+
+// limitError reports that the connection limit is reached
+func limitError(format string, a ...interface{}) error {
+	return &exitError{code: ExitLimitReached, err: fmt.Errorf(format, a...)}
+}
+
+// causedError is a message for a failure that keeps the error that caused it, so callers
+// can still inspect the cause with errors.As and the apierrors predicates
+type causedError struct {
+	message string
+	cause   error
+}
+
+func (e *causedError) Error() string { return e.message }
+func (e *causedError) Unwrap() error { return e.cause }
+
+// apiFailure formats a failed Kubernetes API call, choosing the exit code from the cause
+func apiFailure(cause error, format string, a ...interface{}) error {
+	err := error(&causedError{message: fmt.Sprintf(format, a...), cause: cause})
+
+	var netErr net.Error
+	switch {
+	case apierrors.IsNotFound(cause):
+		return &exitError{code: ExitNotFound, err: err}
+	case apierrors.IsAlreadyExists(cause):
+		return &exitError{code: ExitAlreadyExists, err: err}
+	case errors.As(cause, &netErr), apierrors.IsTimeout(cause), apierrors.IsServerTimeout(cause), apierrors.IsServiceUnavailable(cause):
+		return &exitError{code: ExitUnreachable, err: err}
+	default:
+		return err
+	}
+}
+
+// ExitCode returns the exit code for an error returned by the root command
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return ExitFailure
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// NewExecCmd creates the exec command
+func NewExecCmd() *cobra.Command {
+	var (
+		kubeconfig string
+		namespace  string
+		remotePort string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "exec [servicename]",
+		Short: "Bridge stdin/stdout to a service port",
+		Long: `Connect to a port on a pod behind the service and bridge stdin/stdout to it directly,
+without binding a local port. Useful for one-shot interactions in scripts:
+
+  bugx exec mydb < query.sql`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servicename := args[0]
+			namespace = resolveNamespace(namespace)
+
+			// Get kubeconfig path
+			kubeconfigPath := getKubeconfigPath(kubeconfig)
+			if kubeconfigPath == "" {
+				return fmt.Errorf("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
+			}
+
+			// Build config and clientset from kubeconfig
+			config, clientset, err := getClients(kubeconfigPath, kubeContextFlag)
+			if err != nil {
+				return err
+			}
+
+			resolved, err := ResolveService(clientset, namespace, servicename)
+			if err != nil {
+				return err
+			}
+			svc := resolved.Service
+
+			remotePortInt, err := resolveRemotePort(svc, remotePort)
+			if err != nil {
+				return err
+			}
+
+			selection, err := resolved.SelectPod(clientset, PodSelectOptions{})
+			if err != nil {
+				return err
+			}
+			pod := selection.Pod
+			if remotePortInt, err = resolvePodPort(svc, pod, remotePort, remotePortInt); err != nil {
+				return err
+			}
+
+			return streamPortForward(config, namespace, pod.Name, remotePortInt, os.Stdin, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file, or comma-separated files to merge (defaults to KUBECONFIG env var or ~/.kube/config)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().StringVarP(&remotePort, "remoteport", "r", "", "Remote port on the pod (defaults to first service port)")
+
+	cmd.ValidArgsFunction = completeServiceNames
+	cmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
+
+	return cmd
+}
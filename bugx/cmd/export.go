@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// NewExportCmd creates the export command
+func NewExportCmd() *cobra.Command {
+	var as string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the running connections as a kubectl port-forward script",
+		Long: `Write a shell script with the kubectl port-forward commands equivalent to the
+running connections, to recreate the tunnels without bugx. Each forward goes to
+the pod and port the connection resolved; mirrors get their own forward.
+
+  bugx export --as kubectl > tunnels.sh`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if as != "kubectl" {
+				return usageError("invalid --as %q (must be kubectl)", as)
+			}
+
+			connections, err := loadConnections()
+			if err != nil {
+				return fmt.Errorf("failed to load connections: %v", err)
+			}
+
+			var active []ConnectionInfo
+			for _, conn := range connections {
+				if isProcessRunning(conn.PID) {
+					active = append(active, conn)
+				}
+			}
+			if len(active) == 0 {
+				return notFoundError("no running connections to export")
+			}
+			sort.Slice(active, func(i, j int) bool {
+				if active[i].Namespace != active[j].Namespace {
+					return active[i].Namespace < active[j].Namespace
+				}
+				return active[i].ServiceName < active[j].ServiceName
+			})
+
+			writeKubectlScript(os.Stdout, active)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&as, "as", "kubectl", "Format of the export: kubectl (a shell script of kubectl port-forward commands)")
+
+	return cmd
+}
+
+// writeKubectlScript writes a shell script running a kubectl port-forward per connection and mirror
+// in the background, stopping them all on Ctrl+C
+func writeKubectlScript(w io.Writer, connections []ConnectionInfo) {
+	fmt.Fprintln(w, "#!/bin/sh")
+	fmt.Fprintln(w, "# kubectl port-forwards equivalent to the running bugx connections, written by bugx export.")
+	fmt.Fprintln(w, "# Pods were resolved when the connections were made; rerun bugx export if they were replaced.")
+	fmt.Fprintln(w, "trap 'kill 0' INT TERM")
+
+	for _, conn := range connections {
+		name := conn.Namespace + "/" + conn.ServiceName
+		if conn.Alias != "" {
+			name += " (" + conn.Alias + ")"
+		}
+		fmt.Fprintf(w, "\n# %s\n", name)
+		if conn.SSHJump != "" {
+			fmt.Fprintf(w, "# bugx reached the API server through ssh %s; kubectl needs it reachable directly\n", conn.SSHJump)
+		}
+		fmt.Fprintln(w, kubectlPortForward(conn, conn.PodName, conn.LocalPort, conn.RemotePort)+" &")
+		for _, mirror := range conn.Mirrors {
+			remotePort := conn.RemotePort
+			if mirror.RemotePort != 0 {
+				remotePort = mirror.RemotePort
+			}
+			fmt.Fprintln(w, kubectlPortForward(conn, mirror.PodName, mirror.LocalPort, remotePort)+" &")
+		}
+	}
+
+	fmt.Fprintln(w, "\nwait")
+}
+
+// kubectlPortForward returns the kubectl command forwarding the local ports of a connection to
+// remotePort of a pod, with every word quoted for the shell. It is also printed by connect
+// --print-kubectl and --dry-run.
+func kubectlPortForward(conn ConnectionInfo, pod, localPorts string, remotePort int32) string {
+	namespace := conn.Namespace
+	if conn.PodNamespace != "" {
+		namespace = conn.PodNamespace
+	}
+
+	// kubectl's --kubeconfig takes a single file; merged kubeconfigs are passed in KUBECONFIG
+	prefix := ""
+	words := []string{"kubectl"}
+	if len(kubeconfigFiles(conn.Kubeconfig)) > 1 {
+		prefix = "KUBECONFIG=" + shellQuote(conn.Kubeconfig) + " "
+	} else if conn.Kubeconfig != "" {
+		words = append(words, "--kubeconfig", conn.Kubeconfig)
+	}
+	if conn.Context != "" {
+		words = append(words, "--context", conn.Context)
+	}
+	words = append(words, "--namespace", namespace, "port-forward", "pod/"+pod)
+	if conn.Address != "" {
+		words = append(words, "--address", conn.Address)
+	}
+	for _, port := range strings.Split(localPorts, ",") {
+		words = append(words, strings.TrimSpace(port)+":"+strconv.Itoa(int(remotePort)))
+	}
+
+	return prefix + shellJoin(words)
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKubectlPortForward(t *testing.T) {
+	tests := []struct {
+		name       string
+		conn       ConnectionInfo
+		localPorts string
+		remotePort int32
+		want       string
+	}{
+		{
+			name:       "kubeconfig path with a space",
+			conn:       ConnectionInfo{Namespace: "app", Kubeconfig: "/home/me/my clusters/prod.yaml", Context: "prod"},
+			localPorts: "8081",
+			remotePort: 8080,
+			want:       "kubectl --kubeconfig '/home/me/my clusters/prod.yaml' --context prod --namespace app port-forward pod/web-0 8081:8080",
+		},
+		{
+			name:       "kubeconfig path with shell metacharacters",
+			conn:       ConnectionInfo{Namespace: "app", Kubeconfig: "/tmp/$(rm -rf ~);x.yaml"},
+			localPorts: "8081",
+			remotePort: 8080,
+			want:       "kubectl --kubeconfig '/tmp/$(rm -rf ~);x.yaml' --namespace app port-forward pod/web-0 8081:8080",
+		},
+		{
+			name:       "several local ports",
+			conn:       ConnectionInfo{Namespace: "app", Kubeconfig: "/k", Context: "dev", Address: "127.0.0.1,::1"},
+			localPorts: "8081, 8082",
+			remotePort: 80,
+			want:       "kubectl --kubeconfig /k --context dev --namespace app port-forward pod/web-0 --address 127.0.0.1,::1 8081:80 8082:80",
+		},
+		{
+			name:       "pod in another namespace",
+			conn:       ConnectionInfo{Namespace: "app", PodNamespace: "data", Kubeconfig: "/k"},
+			localPorts: "5433",
+			remotePort: 5432,
+			want:       "kubectl --kubeconfig /k --namespace data port-forward pod/web-0 5433:5432",
+		},
+		{
+			name:       "merged kubeconfigs",
+			conn:       ConnectionInfo{Namespace: "app", Kubeconfig: "/a:/b c", Context: "it's"},
+			localPorts: "8081",
+			remotePort: 8080,
+			want:       `KUBECONFIG='/a:/b c' kubectl --context 'it'\''s' --namespace app port-forward pod/web-0 8081:8080`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kubectlPortForward(tt.conn, "web-0", tt.localPorts, tt.remotePort); got != tt.want {
+				t.Errorf("kubectlPortForward() =\n  %s\nwant\n  %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteKubectlScriptMirrorPorts(t *testing.T) {
+	var script strings.Builder
+	writeKubectlScript(&script, []ConnectionInfo{{
+		ServiceName: "web", Namespace: "app", Kubeconfig: "/k", LocalPort: "8081", RemotePort: 8080, PodName: "web-0",
+		Mirrors: []MirrorInfo{{LocalPort: "8082", PodName: "web-1", RemotePort: 9090}},
+	}})
+	for _, want := range []string{
+		"kubectl --kubeconfig /k --namespace app port-forward pod/web-0 8081:8080 &\n",
+		"kubectl --kubeconfig /k --namespace app port-forward pod/web-1 8082:9090 &\n",
+	} {
+		if !strings.Contains(script.String(), want) {
+			t.Errorf("script does not contain %q:\n%s", want, script.String())
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// printFormatted writes data in the requested machine-readable format to stdout.
+// It returns false when no format was requested and the caller should print its
+// human-readable display instead. Formatted output is not affected by --quiet.
+func printFormatted(format, tmpl string, data interface{}) (bool, error) {
+	switch format {
+	case "":
+		return false, nil
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return true, encoder.Encode(data)
+	case "template", "go-template":
+		if tmpl == "" {
+			return true, fmt.Errorf("--template is required with -o %s", format)
+		}
+		t, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return true, fmt.Errorf("invalid template: %v", err)
+		}
+		if err := t.Execute(os.Stdout, data); err != nil {
+			return true, fmt.Errorf("failed to execute template: %v", err)
+		}
+		return true, nil
+	default:
+		return true, fmt.Errorf("unknown output format %q (must be json or template)", format)
+	}
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// defaultAddresses are the local addresses port-forwards listen on unless overridden
+var defaultAddresses = []string{"localhost"}
+
+// forwardTransport selects how port-forward streams reach the API server: "spdy",
+// "websocket", or "auto" (WebSocket, falling back to SPDY if the upgrade is refused)
+var forwardTransport = "auto"
+
+// validateTransport checks a --transport value
+func validateTransport(transport string) error {
+	switch transport {
+	case "auto", "websocket", "spdy":
+		return nil
+	default:
+		return usageError("invalid --transport value %q (must be auto, websocket or spdy)", transport)
+	}
+}
+
+// portForwardURL builds the portforward subresource URL of a pod from the API server host.
+// The host is parsed as a URL so bracketed IPv6 addresses keep their brackets, and a path in it
+// (an API server behind an ingress at https://host/k8s/) is kept as the prefix of the API path.
+func portForwardURL(config *rest.Config, namespace, podName string) (*url.URL, error) {
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server host %q: %v", config.Host, err)
+	}
+
+	return &url.URL{
+		Scheme: hostURL.Scheme,
+		Host:   hostURL.Host,
+		Path:   strings.TrimSuffix(hostURL.Path, "/") + fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName),
+	}, nil
+}
+
+// withTLSOverrides returns a copy of config with the TLS server name and verification overridden
+// for the forward connection. An empty serverName and false insecure leave the config unchanged.
+func withTLSOverrides(config *rest.Config, serverName string, insecure bool) *rest.Config {
+	if serverName == "" && !insecure {
+		return config
+	}
+
+	config = rest.CopyConfig(config)
+	if serverName != "" {
+		config.TLSClientConfig.ServerName = serverName
+	}
+	if insecure {
+		// client-go rejects a CA bundle combined with skipping verification
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+	return config
+}
+
+// newPortForwardDialer creates a dialer for the portforward subresource of a pod using forwardTransport.
+// Both transports dial through config.Proxy, which clientcmd sets from the cluster's proxy-url,
+// and fall back to HTTPS_PROXY/NO_PROXY when it is unset; the copy below must keep it.
+func newPortForwardDialer(config *rest.Config, namespace, podName string) (httpstream.Dialer, error) {
+	// The request timeout bounds setup calls only; the forward itself is long-lived
+	config = rest.CopyConfig(config)
+	config.Timeout = 0
+
+	serverURL, err := portForwardURL(config, namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+
+	var spdyDialer, websocketDialer httpstream.Dialer
+	if forwardTransport != "websocket" {
+		roundTripperFor := spdy.RoundTripperFor
+		if pingInterval > 0 {
+			roundTripperFor = keepaliveSPDYRoundTripper
+		}
+		transport, upgrader, err := roundTripperFor(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create round tripper: %v", err)
+		}
+		spdyDialer = spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
+	}
+	if forwardTransport != "spdy" {
+		// The WebSocket dialer issues a GET upgrade on the same URL
+		newWebsocketDialer := portforward.NewSPDYOverWebsocketDialer
+		if pingInterval > 0 {
+			newWebsocketDialer = newKeepaliveWebsocketDialer
+		}
+		websocketDialer, err = newWebsocketDialer(serverURL, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create websocket dialer: %v", err)
+		}
+	}
+
+	switch forwardTransport {
+	case "spdy":
+		return spdyDialer, nil
+	case "websocket":
+		return websocketDialer, nil
+	default:
+		// Fall back only when the server or a proxy refuses the WebSocket upgrade
+		return portforward.NewFallbackDialer(websocketDialer, spdyDialer, func(err error) bool {
+			return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+		}), nil
+	}
+}
+
+// newPortForwarder creates a port forwarder to a pod that listens on the given local addresses
+func newPortForwarder(config *rest.Config, namespace, podName string, addresses, ports []string, stopChan, readyChan chan struct{}, out, errOut io.Writer) (*portforward.PortForwarder, error) {
+	dialer, err := newPortForwardDialer(config, namespace, podName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addresses) == 0 {
+		addresses = defaultAddresses
+	}
+
+	pf, err := portforward.NewOnAddresses(dialer, addresses, ports, stopChan, readyChan, out, errOut)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create port-forward: %v", err)
+	}
+
+	return pf, nil
+}
+
+// streamPortForward bridges in and out to a single port on a pod without a local listener.
+// It speaks the port-forward protocol directly: one error stream and one data stream per request.
+func streamPortForward(config *rest.Config, namespace, podName string, port int32, in io.Reader, out io.Writer) error {
+	dialer, err := newPortForwardDialer(config, namespace, podName)
+	if err != nil {
+		return err
+	}
+
+	streamConn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to pod %s: %v", podName, err)
+	}
+	defer streamConn.Close()
+
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(int(port)))
+	headers.Set(corev1.PortForwardRequestIDHeader, "0")
+
+	errorStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("failed to create error stream: %v", err)
+	}
+	// We only read from the error stream
+	errorStream.Close()
+
+	errChan := make(chan error, 1)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errChan <- fmt.Errorf("failed to read error stream: %v", err)
+		case len(message) > 0:
+			errChan <- fmt.Errorf("port-forward to port %d failed: %s", port, message)
+		}
+		close(errChan)
+	}()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := streamConn.CreateStream(headers)
+	if err != nil {
+		return fmt.Errorf("failed to create data stream: %v", err)
+	}
+
+	go func() {
+		io.Copy(dataStream, in)
+		// Half-close so the remote side sees EOF once input is exhausted
+		dataStream.Close()
+	}()
+
+	if _, err := io.Copy(out, dataStream); err != nil {
+		return fmt.Errorf("failed to read from pod: %v", err)
+	}
+
+	return <-errChan
+}
+
+// localEndpoint formats the first local address and port for display
+func localEndpoint(addresses []string, localPort string) string {
+	if len(addresses) == 0 {
+		addresses = defaultAddresses
+	}
+	return net.JoinHostPort(addresses[0], localPort)
+}
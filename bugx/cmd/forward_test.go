@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	spdystream "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+)
+
+func TestPortForwardURL(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{"no path", "https://api.example.com:6443", "https://api.example.com:6443/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"path prefix", "https://host/k8s", "https://host/k8s/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"path prefix with trailing slash", "https://host/k8s/", "https://host/k8s/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"bracketed IPv6", "https://[fd00::1]:6443", "https://[fd00::1]:6443/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"bracketed IPv6 with path prefix", "https://[fd00::1]:6443/k8s/", "https://[fd00::1]:6443/k8s/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"IPv6 loopback without scheme", "[::1]:6443", "https://[::1]:6443/api/v1/namespaces/app/pods/web-0/portforward"},
+		{"IPv6 loopback", "https://[::1]:6443", "https://[::1]:6443/api/v1/namespaces/app/pods/web-0/portforward"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := portForwardURL(&rest.Config{Host: tt.host}, "app", "web-0")
+			if err != nil {
+				t.Fatalf("portForwardURL(%q) failed: %v", tt.host, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("portForwardURL(%q) = %s, want %s", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalEndpoint(t *testing.T) {
+	tests := []struct {
+		addresses []string
+		port      string
+		want      string
+	}{
+		{nil, "5433", "localhost:5433"},
+		{[]string{"127.0.0.1"}, "5433", "127.0.0.1:5433"},
+		{[]string{"::1"}, "5433", "[::1]:5433"},
+		{[]string{"::1", "127.0.0.1"}, "5433", "[::1]:5433"},
+		{[]string{"::"}, "8080", "[::]:8080"},
+	}
+	for _, tt := range tests {
+		if got := localEndpoint(tt.addresses, tt.port); got != tt.want {
+			t.Errorf("localEndpoint(%v, %s) = %s, want %s", tt.addresses, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestPortForwardDialersUseConfigProxy(t *testing.T) {
+	// The proxy refuses every tunnel, recording the targets it was asked for
+	var mu sync.Mutex
+	var targets []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		targets = append(targets, r.Method+" "+r.Host)
+		mu.Unlock()
+		http.Error(w, "tunnels refused", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	previousTransport, previousPing := forwardTransport, pingInterval
+	defer func() { forwardTransport, pingInterval = previousTransport, previousPing }()
+
+	for _, transport := range []string{"spdy", "websocket"} {
+		for _, ping := range []time.Duration{0, 30 * time.Second} {
+			t.Run(fmt.Sprintf("%s ping %s", transport, ping), func(t *testing.T) {
+				forwardTransport, pingInterval = transport, ping
+				mu.Lock()
+				targets = nil
+				mu.Unlock()
+
+				proxied := 0
+				config := &rest.Config{
+					Host: "https://api.cluster.invalid:6443",
+					Proxy: func(r *http.Request) (*url.URL, error) {
+						proxied++
+						return proxyURL, nil
+					},
+				}
+				dialer, err := newPortForwardDialer(config, "app", "web-0")
+				if err != nil {
+					t.Fatalf("newPortForwardDialer failed: %v", err)
+				}
+				if _, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name); err == nil {
+					t.Fatalf("Dial succeeded through a proxy that refuses tunnels")
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if proxied == 0 {
+					t.Errorf("config.Proxy was never consulted")
+				}
+				if len(targets) == 0 || targets[0] != "CONNECT api.cluster.invalid:6443" {
+					t.Errorf("proxy saw %v, want a CONNECT to api.cluster.invalid:6443", targets)
+				}
+			})
+		}
+	}
+}
+
+// newFakePortForwardServer serves the SPDY portforward subresource, echoing each data stream
+// back to the client
+func newFakePortForwardServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := httpstream.Handshake(r, w, []string{portforward.PortForwardProtocolV1Name}); err != nil {
+			return
+		}
+		streams := make(chan httpstream.Stream, 2)
+		conn := spdystream.NewResponseUpgrader().UpgradeResponse(w, r, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+			streams <- stream
+			return nil
+		})
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+
+		var errorStream, dataStream httpstream.Stream
+		for errorStream == nil || dataStream == nil {
+			stream := <-streams
+			if stream.Headers().Get(corev1.StreamType) == corev1.StreamTypeError {
+				errorStream = stream
+			} else {
+				dataStream = stream
+			}
+		}
+		io.Copy(dataStream, dataStream)
+		dataStream.Close()
+		errorStream.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRequestTimeoutDoesNotCutEstablishedForward(t *testing.T) {
+	previousTransport, previousPing := forwardTransport, pingInterval
+	defer func() { forwardTransport, pingInterval = previousTransport, previousPing }()
+	forwardTransport, pingInterval = "spdy", 0
+
+	server := newFakePortForwardServer(t)
+	// As built by buildConfig with --request-timeout 100ms
+	config := &rest.Config{Host: server.URL, Timeout: 100 * time.Millisecond}
+
+	stopChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	pf, err := newPortForwarder(config, "app", "web-0", []string{"127.0.0.1"}, []string{"0:5432"}, stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatalf("newPortForwarder failed: %v", err)
+	}
+	errChan := make(chan error, 1)
+	go func() { errChan <- pf.ForwardPorts() }()
+	defer func() {
+		close(stopChan)
+		<-errChan
+	}()
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		t.Fatalf("forward failed: %v", err)
+	}
+	ports, err := pf.GetPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", ports[0].Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// The tunnel stays idle for several request timeouts before any data flows
+	time.Sleep(500 * time.Millisecond)
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write to the forward failed: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	echoed := make([]byte, 4)
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatalf("forward returned no echo: %v", err)
+	}
+	if string(echoed) != "ping" {
+		t.Errorf("forward returned %q, want the echoed %q", echoed, "ping")
+	}
+	if config.Timeout != 100*time.Millisecond {
+		t.Errorf("the caller's config.Timeout was changed to %s", config.Timeout)
+	}
+}
+
+func TestSPDYForwardWatchdogClosesSilentStream(t *testing.T) {
+	previousTransport, previousPing := forwardTransport, pingInterval
+	defer func() { forwardTransport, pingInterval = previousTransport, previousPing }()
+	forwardTransport, pingInterval = "spdy", 30*time.Second
+	fake := useFakeClock(t)
+
+	// The server accepts the upgrade, then hears and says nothing, like a dropped NAT mapping
+	release := make(chan struct{})
+	defer close(release)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\n%s: %s\r\n%s: %s\r\n%s: %s\r\n\r\n",
+			httpstream.HeaderConnection, httpstream.HeaderUpgrade,
+			httpstream.HeaderUpgrade, spdystream.HeaderSpdy31,
+			httpstream.HeaderProtocolVersion, portforward.PortForwardProtocolV1Name)
+		<-release
+	}))
+	defer server.Close()
+
+	dialer, err := newPortForwardDialer(&rest.Config{Host: server.URL}, "app", "web-0")
+	if err != nil {
+		t.Fatalf("newPortForwardDialer failed: %v", err)
+	}
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	stale := staleForwards.Load()
+	advanceUntil(t, fake, pingInterval, conn.CloseChan())
+	if staleForwards.Load() != stale+1 {
+		t.Errorf("staleForwards went from %d to %d, want one stale forward", stale, staleForwards.Load())
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// healthCheckData is what a --health-cmd template can refer to, e.g. {{.LocalPort}}
+type healthCheckData struct {
+	LocalPort  string
+	RemotePort int32
+	Service    string
+	Namespace  string
+	Pod        string
+}
+
+// renderHealthCommand expands the template placeholders of a health command
+func renderHealthCommand(command string, data healthCheckData) (string, error) {
+	tmpl, err := template.New("health-cmd").Option("missingkey=error").Parse(command)
+	if err != nil {
+		return "", fmt.Errorf("invalid --health-cmd: %v", err)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid --health-cmd: %v", err)
+	}
+	return b.String(), nil
+}
+
+// runHealthCheck runs a rendered health command through the shell, killing it after timeout.
+// It returns nil when the command exits 0, else an error carrying the last line of its output.
+func runHealthCheck(command, localPort string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), "BUGX_LOCAL_PORT="+localPort)
+
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("%v: %s", err, last)
+	}
+	return err
+}
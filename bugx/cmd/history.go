@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// maxHistorySize is the size at which the history file is rotated to history.jsonl.1
+const maxHistorySize = 1 << 20
+
+// historyEvent is one line of the history file
+type historyEvent struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"` // "connect", "disconnect", "reconnect", "remap", "drop" or "expire"
+	Service    string    `json:"service"`
+	Namespace  string    `json:"namespace"`
+	LocalPort  string    `json:"local_port,omitempty"`
+	RemotePort int32     `json:"remote_port,omitempty"`
+	Pod        string    `json:"pod,omitempty"`
+	Outcome    string    `json:"outcome"` // "ok" or "failed"
+	Error      string    `json:"error,omitempty"`
+	Command    string    `json:"command,omitempty"` // the recorded invocation, see connect --record-command
+}
+
+// getHistoryFile returns the path of the history file
+func getHistoryFile() string {
+	return filepath.Join(filepath.Dir(getConnectionsFile()), "history.jsonl")
+}
+
+// recordHistory appends an event for a connection to the history file; err marks it failed.
+// History is best effort: failing to write it never fails the command.
+func recordHistory(event string, conn ConnectionInfo, err error) {
+	entry := historyEvent{
+		Time:       timeSource.Now(),
+		Event:      event,
+		Service:    conn.ServiceName,
+		Namespace:  conn.Namespace,
+		LocalPort:  conn.LocalPort,
+		RemotePort: conn.RemotePort,
+		Pod:        conn.PodName,
+		Command:    conn.Command,
+		Outcome:    "ok",
+	}
+	if err != nil {
+		entry.Outcome = "failed"
+		entry.Error = err.Error()
+	}
+
+	data, mErr := json.Marshal(entry)
+	if mErr != nil {
+		return
+	}
+
+	path := getHistoryFile()
+	if info, sErr := os.Stat(path); sErr == nil && info.Size() >= maxHistorySize {
+		os.Rename(path, path+".1")
+	}
+	if os.MkdirAll(filepath.Dir(path), 0700) != nil {
+		return
+	}
+	file, oErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if oErr != nil {
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
+
+// loadHistory reads the rotated and the current history file, oldest first.
+// Lines that cannot be parsed are skipped.
+func loadHistory() ([]historyEvent, error) {
+	var events []historyEvent
+	for _, path := range []string{getHistoryFile() + ".1", getHistoryFile()} {
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event historyEvent
+			if json.Unmarshal(scanner.Bytes(), &event) == nil {
+				events = append(events, event)
+			}
+		}
+		file.Close()
+	}
+	return events, nil
+}
+
+// NewHistoryCmd creates the history command
+func NewHistoryCmd() *cobra.Command {
+	var (
+		limit        int
+		namespace    string
+		failed       bool
+		since        time.Duration
+		outputFormat string
+		tmpl         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history [servicename]",
+		Short: "Show recent connection events",
+		Long: `Show recent connect, disconnect, reconnect, remap, drop and expire events of
+background connections, oldest first, with their outcome.
+
+Events are kept in ~/.bugx/history.jsonl, which is rotated to
+history.jsonl.1 when it reaches 1 MiB.`,
+		Args: cobra.RangeArgs(0, 1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			events, err := loadHistory()
+			if err != nil {
+				return fmt.Errorf("failed to read history: %v", err)
+			}
+
+			var matched []historyEvent
+			for _, event := range events {
+				if len(args) == 1 && event.Service != args[0] {
+					continue
+				}
+				if namespace != "" && event.Namespace != namespace {
+					continue
+				}
+				if failed && event.Outcome != "failed" {
+					continue
+				}
+				if since > 0 && timeSince(event.Time) > since {
+					continue
+				}
+				matched = append(matched, event)
+			}
+			if limit > 0 && len(matched) > limit {
+				matched = matched[len(matched)-limit:]
+			}
+
+			if ok, err := printFormatted(outputFormat, tmpl, matched); ok {
+				return err
+			}
+
+			if len(matched) == 0 {
+				fmt.Fprintln(output, "No matching events.")
+				return nil
+			}
+			for _, event := range matched {
+				ports := event.LocalPort
+				if event.RemotePort > 0 {
+					ports = fmt.Sprintf("%s->%d", event.LocalPort, event.RemotePort)
+				}
+				line := fmt.Sprintf("%s  %-10s %-30s %-12s %-6s", event.Time.Local().Format("2006-01-02 15:04:05"), event.Event, event.Namespace+"/"+event.Service, ports, event.Outcome)
+				if event.Pod != "" {
+					line += "  pod " + event.Pod
+				}
+				if event.Error != "" {
+					line += "  " + event.Error
+				}
+				fmt.Fprintln(output, line)
+				if event.Command != "" {
+					fmt.Fprintf(output, "    $ %s\n", event.Command)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 20, "Show at most this many of the most recent events (0 shows all)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only show events in this namespace")
+	cmd.Flags().BoolVar(&failed, "failed", false, "Only show failed events")
+	cmd.Flags().DurationVar(&since, "since", 0, "Only show events newer than this, e.g. 24h")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the event list with -o template")
+
+	return cmd
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// execHook is a command run once a port-forward is ready, along with the
+// extra environment it receives
+type execHook struct {
+	command string
+	env     []string
+	envKeys []string
+}
+
+// loadSecretEnv reads a Secret and adds its keys to the hook's environment
+func (h *execHook) loadSecretEnv(clientset *kubernetes.Clientset, namespace, secretName string) error {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %v", namespace, secretName, err)
+	}
+
+	var keys []string
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := envVarName(key)
+		h.env = append(h.env, fmt.Sprintf("%s=%s", name, secret.Data[key]))
+		h.envKeys = append(h.envKeys, name)
+	}
+
+	return nil
+}
+
+// printExports prints the hook's secret environment as export lines with redacted values
+func (h *execHook) printExports() {
+	if len(h.envKeys) == 0 {
+		return
+	}
+
+	fmt.Fprintln(output, "  Secret environment (values redacted):")
+	for _, name := range h.envKeys {
+		fmt.Fprintf(output, "    export %s=<redacted>\n", name)
+	}
+	fmt.Fprintln(output)
+}
+
+// hookProcess is a started hook command
+type hookProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed once the command has exited
+	err  error         // the command's result, set before done is closed
+}
+
+// run executes the hook command and waits for it to exit
+func (h *execHook) run(localPort string) error {
+	if h.command == "" {
+		return nil
+	}
+
+	proc, err := h.start(localPort)
+	if err != nil {
+		return err
+	}
+	<-proc.done
+	return proc.err
+}
+
+// start starts the hook command through the shell with the forward's local port
+// and any secret values added to its environment
+func (h *execHook) start(localPort string) (*hookProcess, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", h.command)
+	} else {
+		cmd = exec.Command("sh", "-c", h.command)
+	}
+
+	cmd.Env = append(os.Environ(), "BUGX_LOCAL_PORT="+localPort)
+	cmd.Env = append(cmd.Env, h.env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = hookSysProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec command failed: %v", err)
+	}
+
+	proc := &hookProcess{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			proc.err = fmt.Errorf("exec command failed: %v", err)
+		}
+		reclaimTerminal(cmd.SysProcAttr)
+		close(proc.done)
+	}()
+	return proc, nil
+}
+
+// stop asks the hook command and everything it started to exit with SIGTERM, and kills them
+// if the shell is still running after the terminate grace period (Windows cannot deliver
+// SIGTERM, so it is killed at once). On a terminal the hook's process group is the foreground
+// one, so Ctrl+C reaches the hook rather than bugx; stop is for a forward that ended and for
+// signals sent to bugx itself.
+func (p *hookProcess) stop() {
+	if err := signalHook(p.cmd.Process, syscall.SIGTERM); err == nil {
+		select {
+		case <-p.done:
+			return
+		case <-timeSource.After(timings.TerminateGrace):
+		}
+	}
+	signalHook(p.cmd.Process, syscall.SIGKILL)
+	<-p.done
+}
+
+// envVarName converts a secret key into an environment variable name (db.password -> DB_PASSWORD)
+func envVarName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
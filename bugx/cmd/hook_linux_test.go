@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// processGone reports whether pid has exited, counting a zombie nobody reaped yet as gone
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || strings.Contains(string(stat), ") Z ")
+}
+
+func TestHookStopEndsCommandsItStarted(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	hook := &execHook{command: `sleep 60 & echo $! > "$PID_FILE"; wait`, env: []string{"PID_FILE=" + pidFile}}
+
+	proc, err := hook.start("5433")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(waitForFile(t, pidFile, "\n")))
+	if pid == 0 || processGone(pid) {
+		t.Fatalf("hook did not start its background command")
+	}
+
+	proc.stop()
+	for deadline := time.Now().Add(5 * time.Second); !processGone(pid); {
+		if time.Now().After(deadline) {
+			t.Fatalf("background command %d of the hook still runs after stop", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
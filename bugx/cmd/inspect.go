@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NewInspectCmd creates the inspect command
+func NewInspectCmd() *cobra.Command {
+	var (
+		kubeconfig   string
+		namespace    string
+		outputFormat string
+		tmpl         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "inspect [servicename]",
+		Short: "Show a service, its endpoints and the health of its pods",
+		Long: `Show everything needed to decide whether and how to forward to a service:
+its type, ports and selector, its endpoint addresses and whether each is ready,
+and for every pod behind it the phase, readiness, restart count, node and
+owning workload. Nothing is changed in the cluster.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace = resolveNamespace(namespace)
+
+			kubeconfigPath := getKubeconfigPath(kubeconfig)
+			if kubeconfigPath == "" {
+				return fmt.Errorf("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
+			}
+			_, clientset, err := getClients(kubeconfigPath, kubeContextFlag)
+			if err != nil {
+				return err
+			}
+
+			report, err := newInspectReport(clientset, namespace, args[0])
+			if err != nil {
+				return err
+			}
+			if ok, err := printFormatted(outputFormat, tmpl, report); ok {
+				return err
+			}
+
+			return displayInspectReport(report)
+		},
+	}
+
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file, or comma-separated files to merge (defaults to KUBECONFIG env var or ~/.kube/config)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the report with -o template")
+
+	cmd.ValidArgsFunction = completeServiceNames
+	cmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
+
+	return cmd
+}
+
+// inspectReport is a service together with its endpoints and pods
+type inspectReport struct {
+	Service   inspectService    `json:"service"`
+	Endpoints []inspectEndpoint `json:"endpoints"`
+	Pods      []inspectPod      `json:"pods"`
+	Owners    []string          `json:"owners,omitempty"` // the workloads owning the pods, see connect --owner
+}
+
+// inspectService summarizes a service's spec
+type inspectService struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Type      string   `json:"type"`
+	ClusterIP string   `json:"clusterIP,omitempty"`
+	Ports     []string `json:"ports"` // port/protocol -> targetPort, with the port's name if it has one
+	Selector  string   `json:"selector,omitempty"`
+}
+
+// inspectEndpoint is one address of the service's Endpoints object
+type inspectEndpoint struct {
+	IP    string `json:"ip"`
+	Ready bool   `json:"ready"`
+	Pod   string `json:"pod,omitempty"`
+	Node  string `json:"node,omitempty"`
+}
+
+// inspectPod is the health of a pod behind the service
+type inspectPod struct {
+	Name     string `json:"name"`
+	Phase    string `json:"phase"`
+	Ready    bool   `json:"ready"`
+	Restarts int32  `json:"restarts"`
+	Node     string `json:"node,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Owner    string `json:"owner,omitempty"`
+}
+
+// newInspectReport looks up a service, its Endpoints object and the pods its selector matches.
+// A service without a selector has no pods listed; a missing Endpoints object has no addresses.
+func newInspectReport(clientset *kubernetes.Clientset, namespace, name string) (*inspectReport, error) {
+	resolved, err := ResolveService(clientset, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	svc := resolved.Service
+
+	report := &inspectReport{
+		Service: inspectService{
+			Name:      svc.Name,
+			Namespace: svc.Namespace,
+			Type:      string(svc.Spec.Type),
+			ClusterIP: svc.Spec.ClusterIP,
+		},
+		Endpoints: []inspectEndpoint{},
+		Pods:      []inspectPod{},
+	}
+	for _, port := range svc.Spec.Ports {
+		desc := fmt.Sprintf("%d/%s -> %s", port.Port, port.Protocol, port.TargetPort.String())
+		if port.Name != "" {
+			desc += " (" + port.Name + ")"
+		}
+		report.Service.Ports = append(report.Service.Ports, desc)
+	}
+	if resolved.Selector != nil {
+		report.Service.Selector = resolved.Selector.String()
+	}
+
+	endpoints, err := clientset.CoreV1().Endpoints(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, apiFailure(err, "failed to get endpoints: %v", err)
+	}
+	if err == nil {
+		for _, subset := range endpoints.Subsets {
+			for _, address := range subset.Addresses {
+				report.Endpoints = append(report.Endpoints, newInspectEndpoint(address, true))
+			}
+			for _, address := range subset.NotReadyAddresses {
+				report.Endpoints = append(report.Endpoints, newInspectEndpoint(address, false))
+			}
+		}
+	}
+
+	if resolved.Selector == nil {
+		return report, nil
+	}
+	pods, err := clientset.CoreV1().Pods(svc.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: resolved.Selector.String(),
+	})
+	if err != nil {
+		return nil, apiFailure(err, "failed to list pods: %v", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		report.Pods = append(report.Pods, inspectPod{
+			Name:     pod.Name,
+			Phase:    string(pod.Status.Phase),
+			Ready:    isPodReady(pod),
+			Restarts: podRestarts(pod),
+			Node:     pod.Spec.NodeName,
+			IP:       pod.Status.PodIP,
+			Owner:    podOwner(pod),
+		})
+	}
+	report.Owners = podOwners(pods.Items)
+
+	return report, nil
+}
+
+// newInspectEndpoint converts an endpoint address
+func newInspectEndpoint(address corev1.EndpointAddress, ready bool) inspectEndpoint {
+	endpoint := inspectEndpoint{IP: address.IP, Ready: ready}
+	if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+		endpoint.Pod = address.TargetRef.Name
+	}
+	if address.NodeName != nil {
+		endpoint.Node = *address.NodeName
+	}
+	return endpoint
+}
+
+// displayInspectReport prints an inspect report
+func displayInspectReport(report *inspectReport) error {
+	svc := report.Service
+	fmt.Fprintf(output, "Service:    %s/%s\n", svc.Namespace, svc.Name)
+	fmt.Fprintf(output, "Type:       %s", svc.Type)
+	if svc.ClusterIP != "" {
+		fmt.Fprintf(output, " (%s)", svc.ClusterIP)
+	}
+	fmt.Fprintln(output)
+	for i, port := range svc.Ports {
+		label := ""
+		if i == 0 {
+			label = "Ports:"
+		}
+		fmt.Fprintf(output, "%-12s%s\n", label, port)
+	}
+	selector := svc.Selector
+	if selector == "" {
+		selector = "<none>"
+	}
+	fmt.Fprintf(output, "Selector:   %s\n", selector)
+
+	ready := 0
+	for _, endpoint := range report.Endpoints {
+		if endpoint.Ready {
+			ready++
+		}
+	}
+	fmt.Fprintf(output, "\nEndpoints:  %d ready, %d not ready\n", ready, len(report.Endpoints)-ready)
+	if len(report.Endpoints) > 0 {
+		w := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "  IP\tREADY\tPOD\tNODE")
+		for _, endpoint := range report.Endpoints {
+			fmt.Fprintf(w, "  %s\t%t\t%s\t%s\n", endpoint.IP, endpoint.Ready, endpoint.Pod, endpoint.Node)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(output, "\nPods:       %d\n", len(report.Pods))
+	if len(report.Pods) > 0 {
+		w := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "  NAME\tPHASE\tREADY\tRESTARTS\tNODE\tOWNER")
+		for _, pod := range report.Pods {
+			fmt.Fprintf(w, "  %s\t%s\t%t\t%d\t%s\t%s\n", pod.Name, pod.Phase, pod.Ready, pod.Restarts, pod.Node, pod.Owner)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(report.Owners) > 1 {
+		fmt.Fprintf(output, "\nThe pods belong to %d workloads; pick one with connect --owner.\n", len(report.Owners))
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	httpspdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	constants "k8s.io/apimachinery/pkg/util/portforward"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/transport/websocket"
+)
+
+// pingInterval is how often forwards ping the API server, set by the global --ping-interval flag.
+// Zero keeps client-go's defaults (5s for SPDY, 10s for WebSocket) and no stale-stream watchdog.
+var pingInterval time.Duration
+
+// staleAfterPings is how many ping intervals a forward may go without hearing from the
+// API server before the watchdog closes it
+const staleAfterPings = 3
+
+// staleForwards counts forwards the keepalive watchdog closed, so the daemon can tell a
+// stale stream it should reconnect from a forward that ended on its own
+var staleForwards atomic.Int64
+
+// keepaliveConn closes the connection it wraps once nothing has been read from it for
+// timeout. Pings are answered by the API server, so a live connection is read at least
+// once per ping interval even when the tunnel is idle.
+type keepaliveConn struct {
+	net.Conn
+	lastRead atomic.Int64 // unix nanoseconds
+	closed   chan struct{}
+}
+
+// newKeepaliveConn wraps conn and starts its watchdog
+func newKeepaliveConn(conn net.Conn, timeout time.Duration) *keepaliveConn {
+	c := &keepaliveConn{Conn: conn, closed: make(chan struct{})}
+	c.lastRead.Store(timeSource.Now().UnixNano())
+
+	go func() {
+		ticker := timeSource.NewTicker(timeout / staleAfterPings)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.closed:
+				return
+			case <-ticker.C():
+			}
+			if timeSince(time.Unix(0, c.lastRead.Load())) > timeout {
+				staleForwards.Add(1)
+				c.Close()
+				return
+			}
+		}
+	}()
+	return c
+}
+
+func (c *keepaliveConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.lastRead.Store(timeSource.Now().UnixNano())
+	}
+	return n, err
+}
+
+func (c *keepaliveConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return c.Conn.Close()
+}
+
+// keepaliveWebsocketDialer is client-go's SPDY-over-WebSocket dialer with pingInterval
+// as the ping period and the tunneled connection watched by a keepaliveConn
+type keepaliveWebsocketDialer struct {
+	url       *url.URL
+	transport http.RoundTripper
+	holder    websocket.ConnectionHolder
+}
+
+// newKeepaliveWebsocketDialer creates a keepaliveWebsocketDialer for the portforward URL of a pod
+func newKeepaliveWebsocketDialer(serverURL *url.URL, config *rest.Config) (httpstream.Dialer, error) {
+	transport, holder, err := websocket.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+	return &keepaliveWebsocketDialer{url: serverURL, transport: transport, holder: holder}, nil
+}
+
+func (d *keepaliveWebsocketDialer) Dial(protocols ...string) (httpstream.Connection, string, error) {
+	req, err := http.NewRequest(http.MethodGet, d.url.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	tunnelingProtocols := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		tunnelingProtocols = append(tunnelingProtocols, constants.WebsocketsSPDYTunnelingPrefix+protocol)
+	}
+	conn, err := websocket.Negotiate(d.transport, d.holder, req, tunnelingProtocols...)
+	if err != nil {
+		return nil, "", err
+	}
+	if conn == nil {
+		return nil, "", fmt.Errorf("negotiated websocket connection is nil")
+	}
+	protocol := strings.TrimPrefix(conn.Subprotocol(), constants.WebsocketsSPDYTunnelingPrefix)
+
+	tunnel := newKeepaliveConn(portforward.NewTunnelingConnection("client", conn), staleAfterPings*pingInterval)
+	spdyConn, err := httpspdy.NewClientConnectionWithPings(tunnel, pingInterval)
+	return spdyConn, protocol, err
+}
+
+// keepaliveSPDYRoundTripper is spdy.RoundTripperFor with pingInterval as the ping period and
+// the upgraded connection watched by a keepaliveConn
+func keepaliveSPDYRoundTripper(config *rest.Config) (http.RoundTripper, spdy.Upgrader, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = config.Proxy
+	}
+
+	roundTripper, err := httpspdy.NewRoundTripperWithConfig(httpspdy.RoundTripperConfig{
+		TLS:        tlsConfig,
+		Proxier:    proxy,
+		PingPeriod: pingInterval,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	upgrader := &keepaliveSPDYUpgrader{SpdyRoundTripper: roundTripper}
+	wrapper, err := rest.HTTPWrappersForConfig(config, upgrader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapper, upgrader, nil
+}
+
+// keepaliveSPDYUpgrader is client-go's SPDY round tripper, which keeps the connection it
+// upgrades to itself, with the upgrade redone here so the connection can be watched. Dialing,
+// including TLS and proxies, is still done by the embedded round tripper.
+type keepaliveSPDYUpgrader struct {
+	*httpspdy.SpdyRoundTripper
+	conn *keepaliveConn
+}
+
+func (u *keepaliveSPDYUpgrader) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = utilnet.CloneRequest(req)
+	req.Header.Add(httpstream.HeaderConnection, httpstream.HeaderUpgrade)
+	req.Header.Add(httpstream.HeaderUpgrade, httpspdy.HeaderSpdy31)
+
+	conn, err := u.Dial(req)
+	if err != nil {
+		return nil, err
+	}
+	tunnel := newKeepaliveConn(conn, staleAfterPings*pingInterval)
+	resp, err := http.ReadResponse(bufio.NewReader(tunnel), nil)
+	if err != nil {
+		tunnel.Close()
+		return nil, err
+	}
+	u.conn = tunnel
+	return resp, nil
+}
+
+func (u *keepaliveSPDYUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	if u.conn == nil {
+		return nil, fmt.Errorf("no upgraded connection for the SPDY response")
+	}
+	if !isSPDYUpgrade(resp) {
+		// The embedded round tripper reports the server's error without touching its connection
+		u.conn.Close()
+		return u.SpdyRoundTripper.NewConnection(resp)
+	}
+	return httpspdy.NewClientConnectionWithPings(u.conn, pingInterval)
+}
+
+// isSPDYUpgrade reports whether resp accepted the upgrade to SPDY/3.1
+func isSPDYUpgrade(resp *http.Response) bool {
+	connection := strings.ToLower(resp.Header.Get(httpstream.HeaderConnection))
+	upgrade := strings.ToLower(resp.Header.Get(httpstream.HeaderUpgrade))
+	return resp.StatusCode == http.StatusSwitchingProtocols &&
+		strings.Contains(connection, strings.ToLower(httpstream.HeaderUpgrade)) &&
+		strings.Contains(upgrade, strings.ToLower(httpspdy.HeaderSpdy31))
+}
@@ -1,30 +1,235 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// requestTimeout bounds each API request; set by the global --request-timeout flag
+var requestTimeout time.Duration
+
+// kubeContextFlag is the global --context flag: the kubeconfig context to use, which also
+// selects among connections to the same service in different contexts
+var kubeContextFlag string
+
+// mergeKubeconfig is the global --merge-kubeconfig flag: the files of a --kubeconfig flag are
+// merged with those of KUBECONFIG, ahead of them, instead of replacing them
+var mergeKubeconfig bool
+
+// clientKey identifies a cached client by kubeconfig path, context and ssh bastion
+type clientKey struct {
+	kubeconfig string
+	context    string
+	sshJump    string
+}
+
+// cachedClient is a built rest.Config and its clientset
+type cachedClient struct {
+	config    *rest.Config
+	clientset *kubernetes.Clientset
+}
+
+var (
+	clientCacheMutex sync.Mutex
+	clientCache      = make(map[clientKey]cachedClient)
 )
 
-// getKubeconfigPath returns the kubeconfig path from flag, env var, or default location
+// getKubeconfigPath returns the kubeconfig path from flag, env var, or default location.
+// Several files to merge are returned as one list in KUBECONFIG syntax (see kubeconfigFiles),
+// which is how connections record them and daemons receive them.
 func getKubeconfigPath(flagPath string) string {
-	// Priority: flag > env var > default location
+	path, _ := kubeconfigPathSource(flagPath)
+	return path
+}
+
+// kubeconfigPathSource is getKubeconfigPath that also reports where the path came from
+func kubeconfigPathSource(flagPath string) (string, string) {
+	// Priority: flag > profile > env var > default location. The flag takes a comma-separated
+	// list of files; with --merge-kubeconfig the files of KUBECONFIG follow them.
 	if flagPath != "" {
-		if _, err := os.Stat(flagPath); err == nil {
-			return flagPath
+		if files := existingFiles(strings.Split(flagPath, ",")); len(files) > 0 {
+			if mergeKubeconfig {
+				if envFiles := existingFiles(filepath.SplitList(os.Getenv("KUBECONFIG"))); len(envFiles) > 0 {
+					return joinKubeconfigFiles(append(files, envFiles...)), sourceFlag + " + env KUBECONFIG"
+				}
+			}
+			return joinKubeconfigFiles(files), sourceFlag
 		}
 	}
 
-	if envPath := os.Getenv("KUBECONFIG"); envPath != "" {
-		if _, err := os.Stat(envPath); err == nil {
-			return envPath
+	if activeProfile != nil && activeProfile.Kubeconfig != "" {
+		if _, err := os.Stat(activeProfile.Kubeconfig); err == nil {
+			return activeProfile.Kubeconfig, profileSource()
 		}
 	}
 
+	if files := existingFiles(filepath.SplitList(os.Getenv("KUBECONFIG"))); len(files) > 0 {
+		return joinKubeconfigFiles(files), "env KUBECONFIG"
+	}
+
 	// Default location
 	defaultPath := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	if _, err := os.Stat(defaultPath); err == nil {
-		return defaultPath
+		return defaultPath, sourceDefault
 	}
 
+	return "", sourceNone
+}
+
+// existingFiles returns the paths that exist, in order and without duplicates or blanks
+func existingFiles(paths []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" || seen[path] {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// joinKubeconfigFiles joins kubeconfig files into a list in KUBECONFIG syntax
+func joinKubeconfigFiles(files []string) string {
+	return strings.Join(files, string(filepath.ListSeparator))
+}
+
+// kubeconfigFiles splits a kubeconfig path into its files. A path lists several files in
+// KUBECONFIG syntax (separated by ':', or ';' on Windows) when they are to be merged.
+func kubeconfigFiles(kubeconfigPath string) []string {
+	return filepath.SplitList(kubeconfigPath)
+}
+
+// kubeconfigLoadingRules returns the rules loading a kubeconfig path. Several files are merged
+// like kubectl merges KUBECONFIG: for each cluster, user and context, and for current-context,
+// the first file that sets it wins.
+func kubeconfigLoadingRules(kubeconfigPath string) *clientcmd.ClientConfigLoadingRules {
+	if files := kubeconfigFiles(kubeconfigPath); len(files) > 1 {
+		return &clientcmd.ClientConfigLoadingRules{Precedence: files}
+	}
+	return &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfigPath}
+}
+
+// resolveContextSource returns the context a command would use and where it came from:
+// the --context flag, else the kubeconfig's current context
+func resolveContextSource(flagContext, kubeconfigPath string) (string, string) {
+	if flagContext != "" {
+		return flagContext, sourceFlag
+	}
+	if kubeconfigPath == "" {
+		return "", sourceNone
+	}
+	if current := currentContext(kubeconfigPath); current != "" {
+		return current, "kubeconfig current-context"
+	}
+	return "", sourceNone
+}
+
+// currentContext returns the current context of a kubeconfig, or "" if it cannot be read
+func currentContext(kubeconfigPath string) string {
+	rawConfig, err := kubeconfigLoadingRules(kubeconfigPath).Load()
+	if err != nil {
+		return ""
+	}
+	return rawConfig.CurrentContext
+}
+
+// contextCluster returns the name of the cluster a kubeconfig context points at.
+// An empty context uses the kubeconfig's current context.
+func contextCluster(kubeconfigPath, kubeContext string) string {
+	rawConfig, err := kubeconfigLoadingRules(kubeconfigPath).Load()
+	if err != nil {
+		return ""
+	}
+	if kubeContext == "" {
+		kubeContext = rawConfig.CurrentContext
+	}
+	if ctx, ok := rawConfig.Contexts[kubeContext]; ok {
+		return ctx.Cluster
+	}
 	return ""
 }
+
+// buildConfig builds a rest.Config from a kubeconfig, applying the global request timeout.
+// An empty context uses the kubeconfig's current context.
+func buildConfig(kubeconfigPath, context string) (*rest.Config, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		kubeconfigLoadingRules(kubeconfigPath),
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config: %v", err)
+	}
+
+	config.Timeout = requestTimeout
+	return config, nil
+}
+
+// getClients returns the rest.Config and clientset for a kubeconfig, building them only once
+// per (kubeconfig, context) so commands touching many tunnels don't re-parse and re-auth.
+// The returned config is shared; copy it with rest.CopyConfig before modifying it.
+// The API server is reached through the global --ssh-jump bastion, if one is given.
+func getClients(kubeconfigPath, context string) (*rest.Config, *kubernetes.Clientset, error) {
+	return getClientsVia(kubeconfigPath, context, sshJump)
+}
+
+// getClientsVia is getClients through the given ssh bastion (empty connects directly),
+// for connections that recorded their own
+func getClientsVia(kubeconfigPath, context, jump string) (*rest.Config, *kubernetes.Clientset, error) {
+	clientCacheMutex.Lock()
+	defer clientCacheMutex.Unlock()
+
+	key := clientKey{kubeconfig: kubeconfigPath, context: context, sshJump: jump}
+	if cached, ok := clientCache[key]; ok {
+		return cached.config, cached.clientset, nil
+	}
+
+	config, err := buildConfig(kubeconfigPath, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnProfileCluster(kubeconfigPath, context)
+	if jump != "" {
+		if config, err = withSSHJump(config, jump); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	clientCache[key] = cachedClient{config: config, clientset: clientset}
+	return config, clientset, nil
+}
+
+// refreshClients drops the cached clients for a kubeconfig reached through jump and builds
+// new ones, re-reading the kubeconfig file and re-running any exec credential plugin it configures
+func refreshClients(kubeconfigPath, context, jump string) (*rest.Config, *kubernetes.Clientset, error) {
+	clientCacheMutex.Lock()
+	delete(clientCache, clientKey{kubeconfig: kubeconfigPath, context: context, sshJump: jump})
+	clientCacheMutex.Unlock()
+
+	return getClientsVia(kubeconfigPath, context, jump)
+}
+
+// isAuthError reports whether err means the cluster rejected the client's credentials with
+// 401 Unauthorized. This includes a refused port-forward upgrade, which client-go reports as the
+// Status the API server answered with.
+func isAuthError(err error) bool {
+	return err != nil && apierrors.IsUnauthorized(err)
+}
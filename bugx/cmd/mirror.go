@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// MirrorInfo is an extra local port of a --mirror connection and the pod it forwards to
+type MirrorInfo struct {
+	LocalPort  string `json:"local_port"`
+	PodName    string `json:"pod_name"`
+	RemotePort int32  `json:"remote_port,omitempty"` // set when the connection's named targetPort maps to a port of its own on this pod
+}
+
+// assignMirrors gives each mirror port a pod, round-robin over pods starting after the primary's pod,
+// so that with enough pods every listener reaches a different one
+func assignMirrors(pods []corev1.Pod, primary string, ports []string) []MirrorInfo {
+	start := 0
+	for i, pod := range pods {
+		if pod.Name == primary {
+			start = i
+			break
+		}
+	}
+
+	mirrors := make([]MirrorInfo, 0, len(ports))
+	for i, port := range ports {
+		pod := pods[(start+i+1)%len(pods)]
+		mirrors = append(mirrors, MirrorInfo{LocalPort: port, PodName: pod.Name})
+	}
+	return mirrors
+}
+
+// resolveMirrorPorts looks up the remote port of each mirror on its own pod when the connection
+// forwards a service port with a named targetPort (servicePort non-zero), since the name may map
+// to a different container port on each pod
+func resolveMirrorPorts(mirrors []MirrorInfo, pods []corev1.Pod, svc *corev1.Service, servicePort int32) error {
+	if servicePort == 0 {
+		return nil
+	}
+	for i := range mirrors {
+		for j := range pods {
+			if pods[j].Name != mirrors[i].PodName {
+				continue
+			}
+			port, err := podTargetPort(svc, &pods[j], servicePort)
+			if err != nil {
+				return err
+			}
+			mirrors[i].RemotePort = port
+		}
+	}
+	return nil
+}
+
+// formatMirrors encodes mirrors for the daemon's --mirror flag as localport=pod pairs,
+// followed by :remoteport for a mirror with a remote port of its own
+func formatMirrors(mirrors []MirrorInfo) string {
+	pairs := make([]string, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		pair := mirror.LocalPort + "=" + mirror.PodName
+		if mirror.RemotePort != 0 {
+			pair += ":" + strconv.Itoa(int(mirror.RemotePort))
+		}
+		pairs = append(pairs, pair)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseMirrors decodes the daemon's --mirror values
+func parseMirrors(values []string) ([]MirrorInfo, error) {
+	var mirrors []MirrorInfo
+	for _, value := range values {
+		port, pod, ok := strings.Cut(value, "=")
+		if !ok || pod == "" {
+			return nil, fmt.Errorf("invalid mirror %q: expected localport=pod[:remoteport]", value)
+		}
+		if _, err := parseLocalPorts(port); err != nil {
+			return nil, err
+		}
+		mirror := MirrorInfo{LocalPort: port, PodName: pod}
+		if pod, remotePort, ok := strings.Cut(pod, ":"); ok {
+			number, err := strconv.ParseInt(remotePort, 10, 32)
+			if err != nil || number < 1 || number > 65535 {
+				return nil, fmt.Errorf("invalid mirror %q: bad remote port %q", value, remotePort)
+			}
+			mirror.PodName, mirror.RemotePort = pod, int32(number)
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors, nil
+}
+
+// mirrorForward is a running mirror: its own listeners and its own forward to its pod
+type mirrorForward struct {
+	MirrorInfo
+	proxy    *forwardProxy
+	stopChan chan struct{}
+}
+
+// startMirror opens a mirror's listeners and forwards them to its pod, on the mirror's own
+// remote port if it has one, else on remotePort. If the forward later ends, the error is sent to errChan.
+func startMirror(config *rest.Config, namespace string, mirror MirrorInfo, remotePort int32, addresses []string, readyTimeout time.Duration, errChan chan<- error) (*mirrorForward, error) {
+	if mirror.RemotePort != 0 {
+		remotePort = mirror.RemotePort
+	}
+	proxy, err := newForwardProxy(addresses, mirror.LocalPort)
+	if err != nil {
+		return nil, err
+	}
+
+	stopChan := make(chan struct{}, 1)
+	readyChan := make(chan struct{})
+	pf, err := newDaemonPortForwarder(config, namespace, mirror.PodName, remotePort, stopChan, readyChan)
+	if err != nil {
+		proxy.close()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- pf.ForwardPorts()
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-done:
+		proxy.close()
+		if err == nil {
+			err = fmt.Errorf("port-forward exited before becoming ready")
+		}
+		return nil, fmt.Errorf("mirror %s to pod %s: %v", mirror.LocalPort, mirror.PodName, err)
+	case <-timeSource.After(readyTimeout):
+		close(stopChan)
+		proxy.close()
+		return nil, fmt.Errorf("mirror %s to pod %s was not ready after %s", mirror.LocalPort, mirror.PodName, readyTimeout)
+	}
+
+	ports, err := pf.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stopChan)
+		proxy.close()
+		return nil, fmt.Errorf("failed to get forwarded ports of mirror %s: %v", mirror.LocalPort, err)
+	}
+	proxy.setTarget(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local))))
+	proxy.serve()
+	fmt.Fprintf(output, "Mirror %s forwarding to pod %s\n", mirror.LocalPort, mirror.PodName)
+
+	go func() {
+		err := <-done
+		if err == nil {
+			err = fmt.Errorf("forward ended")
+		}
+		errChan <- fmt.Errorf("mirror %s to pod %s: %v", mirror.LocalPort, mirror.PodName, err)
+	}()
+
+	return &mirrorForward{MirrorInfo: mirror, proxy: proxy, stopChan: stopChan}, nil
+}
+
+// stop closes the mirror's listeners and its forward
+func (m *mirrorForward) stop() {
+	m.proxy.close()
+	close(m.stopChan)
+}
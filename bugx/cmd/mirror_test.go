@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// podListening returns a pod whose container names port name as containerPort
+func podListening(name, portName string, containerPort int32) corev1.Pod {
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Ports: []corev1.ContainerPort{{Name: portName, ContainerPort: containerPort}},
+		}}},
+	}
+}
+
+func TestNamedTargetPortResolvedPerPod(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+			{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt32(9091)},
+		}},
+	}
+	pods := []corev1.Pod{
+		podListening("web-old", "http", 8080),
+		podListening("web-new", "http", 8081),
+		podListening("web-next", "http", 8082),
+	}
+
+	if got := namedTargetPort(svc, "", 80); got != 80 {
+		t.Errorf("namedTargetPort(port 80) = %d, want 80", got)
+	}
+	if got := namedTargetPort(svc, "80", 80); got != 0 {
+		t.Errorf("namedTargetPort with --remoteport 80 = %d, want 0", got)
+	}
+	if got := namedTargetPort(svc, "metrics", 9090); got != 0 {
+		t.Errorf("namedTargetPort(numeric targetPort) = %d, want 0", got)
+	}
+
+	for i, want := range []int32{8080, 8081, 8082} {
+		got, err := podTargetPort(svc, &pods[i], 80)
+		if err != nil || got != want {
+			t.Errorf("podTargetPort(%s) = %d, %v, want %d", pods[i].Name, got, err, want)
+		}
+	}
+	if _, err := podTargetPort(svc, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "bare"}}, 80); err == nil {
+		t.Errorf("podTargetPort on a pod without the named port did not fail")
+	}
+
+	mirrors := assignMirrors(pods, "web-old", []string{"8091", "8092"})
+	if err := resolveMirrorPorts(mirrors, pods, svc, 80); err != nil {
+		t.Fatal(err)
+	}
+	want := []MirrorInfo{
+		{LocalPort: "8091", PodName: "web-new", RemotePort: 8081},
+		{LocalPort: "8092", PodName: "web-next", RemotePort: 8082},
+	}
+	if !reflect.DeepEqual(mirrors, want) {
+		t.Errorf("mirrors = %+v, want %+v", mirrors, want)
+	}
+}
+
+func TestMirrorFlagRoundTrip(t *testing.T) {
+	mirrors := []MirrorInfo{
+		{LocalPort: "8091", PodName: "web-1", RemotePort: 8081},
+		{LocalPort: "8092", PodName: "web-2"},
+	}
+	flag := formatMirrors(mirrors)
+	if flag != "8091=web-1:8081,8092=web-2" {
+		t.Errorf("formatMirrors() = %q", flag)
+	}
+	parsed, err := parseMirrors([]string{"8091=web-1:8081", "8092=web-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, mirrors) {
+		t.Errorf("parseMirrors() = %+v, want %+v", parsed, mirrors)
+	}
+	if _, err := parseMirrors([]string{"8091=web-1:http"}); err == nil {
+		t.Errorf("parseMirrors accepted a non-numeric remote port")
+	}
+}
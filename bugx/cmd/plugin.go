@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// pluginPrefix is prepended to an unknown subcommand to find the plugin executable on PATH
+const pluginPrefix = "bugx-"
+
+// findPlugin returns the executable that handles args when their first word is not a bugx
+// command, e.g. "bugx foo --bar" runs "bugx-foo --bar". Like kubectl, the plugin name must be
+// the first argument; global flags before it are not supported.
+func findPlugin(rootCmd *cobra.Command, args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	name := args[0]
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "__") || strings.ContainsAny(name, `/\`) {
+		return "", false
+	}
+
+	// help is only added when the command runs
+	rootCmd.InitDefaultHelpCmd()
+	if found, _, err := rootCmd.Find(args); err == nil && found != rootCmd {
+		return "", false
+	}
+
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// runPlugin runs a plugin with the remaining arguments and bugx's stdio and environment,
+// and returns its exit code. Interrupts reach the plugin directly, so bugx ignores them meanwhile.
+func runPlugin(path string, args []string) int {
+	plugin := exec.Command(path, args...)
+	plugin.Stdin = os.Stdin
+	plugin.Stdout = os.Stdout
+	plugin.Stderr = os.Stderr
+	plugin.Env = os.Environ()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+
+	err := plugin.Run()
+	if err == nil {
+		return ExitOK
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+	fmt.Fprintf(os.Stderr, "Error: failed to run plugin %s: %v\n", path, err)
+	return ExitFailure
+}
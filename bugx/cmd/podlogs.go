@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultContainerAnnotation names the container kubectl logs picks when none is given
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// NewConnectLogsCmd creates the connect logs command
+func NewConnectLogsCmd() *cobra.Command {
+	var (
+		namespace string
+		follow    bool
+		container string
+		tail      int64
+	)
+
+	cmd := &cobra.Command{
+		Use:   "logs [servicename|alias]",
+		Short: "Show the logs of the pod a connection forwards to",
+		Long: `Show the container logs of the pod a connection is forwarding to, using the
+kubeconfig and context the connection was started with. These are the
+application's logs, not the daemon's.
+
+Without --container, the pod's kubectl.kubernetes.io/default-container
+annotation or else its first container is used.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace = resolveNamespace(namespace)
+
+			conn, err := findConnection(kubeContextFlag, args[0], namespace)
+			if err != nil {
+				if conn, err = findConnectionByPrefix(kubeContextFlag, args[0], namespace); err != nil {
+					return err
+				}
+			}
+
+			_, clientset, err := getClients(conn.Kubeconfig, conn.Context)
+			if err != nil {
+				return err
+			}
+
+			podNamespace := conn.TargetNamespace()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			pod, err := clientset.CoreV1().Pods(podNamespace).Get(ctx, conn.PodName, metav1.GetOptions{})
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					return notFoundError("pod %s/%s of the connection no longer exists", podNamespace, conn.PodName)
+				}
+				return apiFailure(err, "failed to get pod %s/%s: %v", podNamespace, conn.PodName, err)
+			}
+			if container == "" {
+				container = defaultContainer(pod)
+			}
+
+			opts := &corev1.PodLogOptions{Container: container, Follow: follow}
+			if tail >= 0 {
+				opts.TailLines = &tail
+			}
+			stream, err := clientset.CoreV1().Pods(podNamespace).GetLogs(conn.PodName, opts).Stream(ctx)
+			if err != nil {
+				return apiFailure(err, "failed to get logs of pod %s/%s: %v", podNamespace, conn.PodName, err)
+			}
+			defer stream.Close()
+
+			// Logs are the command's data, so they are written even with --quiet
+			if _, err := io.Copy(os.Stdout, stream); err != nil && ctx.Err() == nil {
+				return fmt.Errorf("log stream ended: %v", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Keep streaming new log lines until interrupted")
+	cmd.Flags().StringVarP(&container, "container", "c", "", "Container to show logs of")
+	cmd.Flags().Int64Var(&tail, "tail", -1, "Number of most recent lines to show (-1 shows all)")
+
+	cmd.ValidArgsFunction = completeConnectionNames
+
+	return cmd
+}
+
+// defaultContainer picks the container to show logs of, like kubectl: the one named by the
+// default-container annotation, else the first. It notes the choice when there are several.
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" {
+		return name
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return ""
+	}
+
+	name := pod.Spec.Containers[0].Name
+	if len(pod.Spec.Containers) > 1 {
+		var names []string
+		for _, c := range pod.Spec.Containers {
+			names = append(names, c.Name)
+		}
+		warnf("defaulted container %q out of: %s", name, strings.Join(names, ", "))
+	}
+	return name
+}
@@ -3,92 +3,633 @@ package cmd
 import (
 	"fmt"
 	"io"
-	"net/http"
-	"net/url"
+	"net"
 	"os"
 	"os/signal"
-	"strings"
+	"strconv"
 	"syscall"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 )
 
+// daemonOptions holds the optional settings of a port-forward daemon
+type daemonOptions struct {
+	readyFile    string
+	readyTimeout time.Duration
+	annotatePod  bool // mark the forwarded pod with annotatePod while the tunnel is open
+	mirrors      []MirrorInfo
+
+	// refreshCredentials, if set, rebuilds the clients when the cluster rejects the current
+	// credentials, e.g. after a short-lived token expired during a long-running daemon
+	refreshCredentials func() (*rest.Config, *kubernetes.Clientset, error)
+
+	healthCmd string // template of a command run every timings.HealthInterval to judge tunnel health
+
+	// podNamespace, if set, is the namespace of a pod given explicitly with connect --pod,
+	// which may differ from the service's; such a pod is never re-resolved through the service
+	podNamespace string
+
+	// podFromEndpoints marks a pod found in the hand-managed endpoints of a service without a
+	// selector, which is looked up there again when the service is re-resolved
+	podFromEndpoints bool
+
+	// kubeContext is the context the daemon's connection record is keyed on
+	kubeContext string
+
+	// podSelect picks the pod again when the service is re-resolved (connect --pod-selection, --owner)
+	podSelect PodSelectOptions
+
+	// servicePort, if set, is the service port whose named targetPort gives the remote port,
+	// looked up again on each pod the service is re-resolved to
+	servicePort int32
+
+	// breaker paces the reconnects after the keepalive watchdog found the stream dead
+	// (connect --breaker-*); nil retries every timings.RetryInterval without pausing
+	breaker *circuitBreaker
+
+	// expiresAt, if set, is when the daemon stops and removes its connection (connect --ttl)
+	expiresAt time.Time
+}
+
 // runPortForwardDaemon runs a port-forward as a daemon process
-// This is called when the process is spawned in the background
-func runPortForwardDaemon(config *rest.Config, namespace, podName, localPort string, remotePort int32, serviceName string) error {
-	stopChan := make(chan struct{}, 1)
-	readyChan := make(chan struct{})
-	errChan := make(chan error, 1)
-
-	// Run port-forward in goroutine
-	go func() {
-		err := runPortForwardInGoroutineDaemon(config, namespace, podName, localPort, remotePort, stopChan, readyChan)
-		if err != nil {
-			errChan <- err
+// This is called when the process is spawned in the background.
+// On SIGHUP the backing pod is re-resolved and the forward restarted on the same local port,
+// unless connect remap changed the local port in the record, in which case the listeners move there.
+// Forwarded byte counts and the time the forward was last seen running are saved to
+// the connection record every timings.StatsInterval, and statusSignal makes the daemon write
+// its current state to stderr (its log file). On drainSignal the daemon stops accepting local
+// connections and exits once the open ones have closed. With --ping-interval, a WebSocket
+// stream the keepalive watchdog found dead is reconnected instead of ending the daemon; failed
+// reconnects are retried, paced by opts.breaker, whose open state is saved to the record.
+// With opts.expiresAt set, the daemon stops and removes its connection at that time,
+// whether or not the tunnel is in use.
+func runPortForwardDaemon(config *rest.Config, clientset *kubernetes.Clientset, namespace, podName, localPort string, remotePort int32, addresses []string, serviceName string, opts daemonOptions) error {
+	if opts.readyFile != "" {
+		defer os.Remove(opts.readyFile)
+	}
+	podNamespace := namespace
+	if opts.podNamespace != "" {
+		podNamespace = opts.podNamespace
+	}
+
+	// The proxy holds the local port for the daemon's lifetime and counts forwarded bytes
+	proxy, err := newForwardProxy(addresses, localPort)
+	if err != nil {
+		updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+		return err
+	}
+	// The proxy is replaced when the connection is remapped to another local port. A replaced
+	// proxy keeps relaying the connections it accepted, so a drain waits for those as well.
+	var retired []*forwardProxy
+	defer func() { proxy.close() }()
+	proxy.serve()
+
+	// Mirrors listen on further local ports, each forwarding to its own pod
+	mirrorErrs := make(chan error, len(opts.mirrors))
+	var mirrors []*mirrorForward
+	defer func() {
+		for _, mirror := range mirrors {
+			mirror.stop()
 		}
 	}()
+	for _, info := range opts.mirrors {
+		mirror, err := startMirror(config, namespace, info, remotePort, addresses, opts.readyTimeout, mirrorErrs)
+		if err != nil {
+			updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+			return err
+		}
+		mirrors = append(mirrors, mirror)
+	}
 
-	// Wait for ready
-	select {
-	case <-readyChan:
-		// Port-forward is ready
-		pid := os.Getpid()
-		fmt.Fprintf(os.Stderr, "Port-forward daemon started (PID: %d)\n", pid)
+	transferred := func() (int64, int64) {
+		in, out := proxy.bytesIn.Load(), proxy.bytesOut.Load()
+		for _, old := range retired {
+			in += old.bytesIn.Load()
+			out += old.bytesOut.Load()
+		}
+		for _, mirror := range mirrors {
+			in += mirror.proxy.bytesIn.Load()
+			out += mirror.proxy.bytesOut.Load()
+		}
+		return in, out
+	}
+	saveStats := func(lastHealthy time.Time) {
+		in, out := transferred()
+		if err := updateConnectionStats(opts.kubeContext, serviceName, namespace, in, out, lastHealthy); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to record transfer counts: %v\n", err)
+		}
+	}
+	statsTicker := timeSource.NewTicker(timings.StatsInterval)
+	defer statsTicker.Stop()
 
-		// Set up signal handlers
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	// Health checks run in the background so a slow command never delays signal handling
+	var healthTick <-chan time.Time
+	healthResults := make(chan error, 1)
+	healthRunning := false
+	checkHealth := func() {
+		if opts.healthCmd == "" || healthRunning {
+			return
+		}
+		command, err := renderHealthCommand(opts.healthCmd, healthCheckData{
+			LocalPort: localPort, RemotePort: remotePort, Service: serviceName, Namespace: namespace, Pod: podName,
+		})
+		if err != nil {
+			healthResults <- err
+			healthRunning = true
+			return
+		}
+		healthRunning = true
+		go func() {
+			healthResults <- runHealthCheck(command, localPort, timings.HealthInterval)
+		}()
+	}
+	if opts.healthCmd != "" {
+		healthTicker := timeSource.NewTicker(timings.HealthInterval)
+		defer healthTicker.Stop()
+		healthTick = healthTicker.C()
+	}
 
-		// Keep running until signal
+	startedAt := timeSource.Now()
+	restarts := 0
+	event := func(name string, err error) {
+		recordHistory(name, ConnectionInfo{
+			ServiceName: serviceName, Namespace: namespace, LocalPort: localPort, RemotePort: remotePort, PodName: podName,
+		}, err)
+	}
+	dumpStatus := func() {
+		fmt.Fprintf(os.Stderr, "Status at %s:\n", timeSource.Now().Format(time.RFC3339))
+		fmt.Fprintf(os.Stderr, "  Service:  %s/%s\n", namespace, serviceName)
+		fmt.Fprintf(os.Stderr, "  Pod:      %s\n", podName)
+		fmt.Fprintf(os.Stderr, "  Local:    %s\n", localEndpoint(addresses, localPort))
+		for _, mirror := range mirrors {
+			fmt.Fprintf(os.Stderr, "  Mirror:   %s -> %s\n", localEndpoint(addresses, mirror.LocalPort), mirror.PodName)
+		}
+		fmt.Fprintf(os.Stderr, "  Remote:   %d\n", remotePort)
+		fmt.Fprintf(os.Stderr, "  Restarts: %d\n", restarts)
+		in, out := transferred()
+		fmt.Fprintf(os.Stderr, "  In:       %s\n", formatBytes(in))
+		fmt.Fprintf(os.Stderr, "  Out:      %s\n", formatBytes(out))
+		fmt.Fprintf(os.Stderr, "  Uptime:   %s\n", timeSince(startedAt).Round(time.Second))
+	}
+
+	// Set up signal handlers
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	if statusSignal != nil {
+		signal.Notify(sigChan, statusSignal)
+	}
+	if drainSignal != nil {
+		signal.Notify(sigChan, drainSignal)
+	}
+
+	expired := ttlTimer(opts.expiresAt)
+
+	// drained is closed once a drain requested by disconnect --drain has finished
+	var drained <-chan struct{}
+
+	breaker := opts.breaker
+	if breaker == nil {
+		breaker = &circuitBreaker{}
+	}
+	// reconnecting is set while the forward is being re-established after the keepalive
+	// watchdog found it dead; failed attempts are then retried instead of ending the daemon
+	reconnecting := false
+	circuitOpen := false // the open circuit was saved to the record
+
+	// repick re-resolves the service's pod before a reconnect, unless the pod was given explicitly,
+	// and reports whether the pod changed
+	repick := func() bool {
+		if opts.podNamespace != "" && !opts.podFromEndpoints {
+			return false
+		}
+		newPod, newRemotePort, err := resolveServicePod(clientset, namespace, serviceName, opts.servicePort, opts.podSelect, opts.podFromEndpoints)
+		if err != nil || (newPod.Name == podName && newPod.Namespace == podNamespace) {
+			return false
+		}
+		podNamespace, podName = newPod.Namespace, newPod.Name
+		if newRemotePort != 0 {
+			remotePort = newRemotePort
+		}
+		return true
+	}
+
+	// retarget repicks the pod before retrying a failed reconnect, recording a new pod
+	// without counting another restart
+	retarget := func() {
+		if !repick() {
+			return
+		}
+		if err := updateConnectionTarget(opts.kubeContext, serviceName, namespace, podNamespace, podName, remotePort); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update connection record: %v\n", err)
+		}
+	}
+
+	// reconnectFailed counts a failed reconnect against the breaker, saving the open circuit
+	// when it trips, and waits before the next attempt. It reports false if the daemon was
+	// stopped or expired meanwhile, in which case its connection has been removed.
+	reconnectFailed := func(err error) bool {
+		fmt.Fprintf(os.Stderr, "Reconnect failed: %v\n", err)
+		event("reconnect", err)
+		if breaker.failure() {
+			fmt.Fprintf(os.Stderr, "Circuit open: %d reconnects failed within %s; pausing for %s\n", breaker.failures, breaker.window, breaker.cooldown)
+			circuitOpen = true
+			if err := updateConnectionCircuit(opts.kubeContext, serviceName, namespace, timeSource.Now().Add(breaker.wait())); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to record open circuit: %v\n", err)
+			}
+		}
+		resume := timeSource.After(max(timings.RetryInterval, breaker.wait()))
+		for {
+			select {
+			case <-resume:
+				retarget()
+				return true
+			case <-expired:
+				fmt.Fprintf(os.Stderr, "TTL reached at %s, port-forward daemon stopping...\n", opts.expiresAt.Format(time.RFC3339))
+				event("expire", nil)
+				removeConnection(opts.kubeContext, serviceName, namespace)
+				return false
+			case sig := <-sigChan:
+				if statusSignal != nil && sig == statusSignal {
+					dumpStatus()
+					continue
+				}
+				if sig == syscall.SIGHUP {
+					retarget()
+					return true
+				}
+				fmt.Fprintf(os.Stderr, "Port-forward daemon stopping...\n")
+				removeConnection(opts.kubeContext, serviceName, namespace)
+				return false
+			}
+		}
+	}
+
+	refresher := &credentialRefresher{reload: opts.refreshCredentials}
+	refresh := func(err error) bool {
+		newConfig, newClientset, ok := refresher.refresh(err)
+		if ok {
+			config, clientset = newConfig, newClientset
+		}
+		return ok
+	}
+
+	for {
+		stopChan := make(chan struct{}, 1)
+		readyChan := make(chan struct{})
+		errChan := make(chan error, 1)
+		staleBefore := staleForwards.Load()
+
+		pf, err := newDaemonPortForwarder(config, podNamespace, podName, remotePort, stopChan, readyChan)
+		if err != nil {
+			updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+			return fmt.Errorf("port-forward failed to start: %v", err)
+		}
+
+		// Run port-forward in goroutine
+		go func() {
+			errChan <- pf.ForwardPorts()
+		}()
+
+		// Wait for ready
 		select {
+		case <-readyChan:
+			// Port-forward is ready; point the proxy at its internal listener
+			ports, err := pf.GetPorts()
+			if err != nil || len(ports) == 0 {
+				close(stopChan)
+				updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+				return fmt.Errorf("failed to get forwarded ports: %v", err)
+			}
+			proxy.setTarget(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local))))
+			refresher.reset()
+			if reconnecting {
+				reconnecting = false
+				breaker.success()
+				if circuitOpen {
+					circuitOpen = false
+					if err := updateConnectionCircuit(opts.kubeContext, serviceName, namespace, time.Time{}); err != nil {
+						fmt.Fprintf(os.Stderr, "Failed to record closed circuit: %v\n", err)
+					}
+				}
+			}
+
+			fmt.Fprintf(os.Stderr, "Port-forward daemon started (PID: %d, pod: %s)\n", os.Getpid(), podName)
+			if opts.annotatePod {
+				annotatePod(clientset, podNamespace, podName)
+			}
+			if err := writeReadyFile(opts.readyFile, localPort); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write ready file: %v\n", err)
+			}
+			checkHealth()
 		case err := <-errChan:
-			if err != nil {
+			if refresh(err) {
+				continue
+			}
+			if err == nil {
+				err = fmt.Errorf("port-forward exited before becoming ready")
+			}
+			if reconnecting {
+				if reconnectFailed(err) {
+					continue
+				}
+				return nil
+			}
+			updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+			return fmt.Errorf("port-forward failed to start: %v", err)
+		case <-timeSource.After(opts.readyTimeout):
+			close(stopChan)
+			err := fmt.Errorf("port-forward was not ready after %s", opts.readyTimeout)
+			if reconnecting {
+				if reconnectFailed(err) {
+					continue
+				}
+				return nil
+			}
+			updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+			return err
+		}
+
+		// Keep running until signal
+		for restart := false; !restart; {
+			select {
+			case <-statsTicker.C():
+				saveStats(timeSource.Now())
+			case <-healthTick:
+				if drained == nil {
+					checkHealth()
+				}
+			case err := <-healthResults:
+				healthRunning = false
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+				}
+				if err := updateConnectionHealth(opts.kubeContext, serviceName, namespace, err, timeSource.Now()); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to record health check: %v\n", err)
+				}
+			case err := <-mirrorErrs:
 				fmt.Fprintf(os.Stderr, "Port-forward error: %v\n", err)
-				updateConnectionStatus(serviceName, namespace, "stopped")
+				event("drop", err)
+				saveStats(time.Time{})
+				close(stopChan)
+				if opts.annotatePod {
+					unannotatePod(clientset, podNamespace, podName)
+				}
+				updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
 				return err
+			case err := <-errChan:
+				saveStats(time.Time{})
+				if opts.annotatePod {
+					unannotatePod(clientset, podNamespace, podName)
+				}
+
+				// The keepalive watchdog closed a stream that stopped answering pings;
+				// the local listeners are still open, so reconnect behind them
+				if staleForwards.Load() != staleBefore && drained == nil {
+					fmt.Fprintf(os.Stderr, "No response from the API server for %s, reconnecting...\n", staleAfterPings*pingInterval)
+					// Every reconnect counts as a restart in the record, also when the pod is unchanged
+					repick()
+					restarts++
+					if err := updateConnectionPod(opts.kubeContext, serviceName, namespace, podNamespace, podName, remotePort); err != nil {
+						fmt.Fprintf(os.Stderr, "Failed to update connection record: %v\n", err)
+					}
+					restart = true
+					reconnecting = true
+					event("reconnect", nil)
+					continue
+				}
+
+				updateConnectionStatus(opts.kubeContext, serviceName, namespace, "stopped")
+				if err != nil {
+					event("drop", err)
+				} else {
+					event("drop", fmt.Errorf("port-forward ended"))
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Port-forward error: %v\n", err)
+					return err
+				}
+				return nil
+			case <-expired:
+				fmt.Fprintf(os.Stderr, "TTL reached at %s, port-forward daemon stopping...\n", opts.expiresAt.Format(time.RFC3339))
+				saveStats(time.Time{})
+				close(stopChan)
+				if opts.annotatePod {
+					unannotatePod(clientset, podNamespace, podName)
+				}
+				event("expire", nil)
+				removeConnection(opts.kubeContext, serviceName, namespace)
+				return nil
+			case <-drained:
+				fmt.Fprintf(os.Stderr, "All local connections closed, port-forward daemon stopping...\n")
+				saveStats(time.Time{})
+				close(stopChan)
+				if opts.annotatePod {
+					unannotatePod(clientset, podNamespace, podName)
+				}
+				removeConnection(opts.kubeContext, serviceName, namespace)
+				return nil
+			case sig := <-sigChan:
+				if statusSignal != nil && sig == statusSignal {
+					dumpStatus()
+					continue
+				}
+				if drainSignal != nil && sig == drainSignal {
+					if drained != nil {
+						continue
+					}
+					// Closing the listeners refuses new clients; the forward keeps
+					// serving the connections that are already open
+					waits := []<-chan struct{}{proxy.drain()}
+					for _, old := range retired {
+						waits = append(waits, old.drain())
+					}
+					for _, mirror := range mirrors {
+						waits = append(waits, mirror.proxy.drain())
+					}
+					done := make(chan struct{})
+					go func() {
+						for _, wait := range waits {
+							<-wait
+						}
+						close(done)
+					}()
+					drained = done
+					fmt.Fprintf(os.Stderr, "Draining: no longer accepting local connections\n")
+					updateConnectionStatus(opts.kubeContext, serviceName, namespace, "draining")
+					continue
+				}
+				if sig != syscall.SIGHUP {
+					fmt.Fprintf(os.Stderr, "Port-forward daemon stopping...\n")
+					close(stopChan)
+					if opts.annotatePod {
+						unannotatePod(clientset, podNamespace, podName)
+					}
+					removeConnection(opts.kubeContext, serviceName, namespace)
+					return nil
+				}
+
+				if drained != nil {
+					fmt.Fprintf(os.Stderr, "Ignoring SIGHUP while draining\n")
+					continue
+				}
+
+				// connect remap changes the local port in the record before signalling;
+				// the forward itself keeps running, only the proxy's listeners move
+				if conn, err := findConnection(opts.kubeContext, serviceName, namespace); err == nil && conn.LocalPort != localPort {
+					moved, err := newForwardProxy(addresses, conn.LocalPort)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Failed to move to local port %s, keeping %s: %v\n", conn.LocalPort, localPort, err)
+						event("remap", err)
+						modifyConnection(opts.kubeContext, serviceName, namespace, func(conn *ConnectionInfo) {
+							conn.LocalPort = localPort
+						})
+						continue
+					}
+					target, _ := proxy.target.Load().(string)
+					moved.setTarget(target)
+					moved.serve()
+					proxy.close()
+					retired = append(retired, proxy)
+					proxy = moved
+
+					fmt.Fprintf(os.Stderr, "Moved from local port %s to %s\n", localPort, conn.LocalPort)
+					localPort = conn.LocalPort
+					event("remap", nil)
+					continue
+				}
+
+				if opts.podNamespace != "" && !opts.podFromEndpoints {
+					fmt.Fprintf(os.Stderr, "Pod %s/%s was given explicitly, not re-resolving it through the service\n", podNamespace, podName)
+					continue
+				}
+
+				// Resolve the new pod before tearing down the current forward,
+				// so a failed lookup leaves the tunnel untouched
+				fmt.Fprintf(os.Stderr, "Received SIGHUP, re-resolving pod for %s/%s...\n", namespace, serviceName)
+				newPod, newRemotePort, err := resolveServicePod(clientset, namespace, serviceName, opts.servicePort, opts.podSelect, opts.podFromEndpoints)
+				if err != nil && refresh(err) {
+					newPod, newRemotePort, err = resolveServicePod(clientset, namespace, serviceName, opts.servicePort, opts.podSelect, opts.podFromEndpoints)
+				}
+				refresher.reset()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to re-resolve pod, keeping %s: %v\n", podName, err)
+					event("reconnect", err)
+					continue
+				}
+
+				close(stopChan)
+				<-errChan
+
+				if opts.annotatePod {
+					unannotatePod(clientset, podNamespace, podName)
+				}
+				podNamespace, podName = newPod.Namespace, newPod.Name
+				if newRemotePort != 0 {
+					remotePort = newRemotePort
+				}
+				if err := updateConnectionPod(opts.kubeContext, serviceName, namespace, podNamespace, podName, remotePort); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to update connection record: %v\n", err)
+				}
+				restarts++
+				restart = true
+				event("reconnect", nil)
 			}
-		case <-sigChan:
-			fmt.Fprintf(os.Stderr, "Port-forward daemon stopping...\n")
-			close(stopChan)
-			removeConnection(serviceName, namespace)
-			return nil
 		}
-	case err := <-errChan:
-		return fmt.Errorf("port-forward failed to start: %v", err)
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("port-forward timed out waiting for ready")
 	}
+}
 
-	return nil
+// ttlTimer returns a channel that receives once expiresAt is reached (connect --ttl),
+// or nil, which never receives, when the connection has no TTL
+func ttlTimer(expiresAt time.Time) <-chan time.Time {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	return timeSource.After(expiresAt.Sub(timeSource.Now()))
 }
 
-// runPortForwardInGoroutineDaemon runs port-forward in a goroutine (daemon version)
-func runPortForwardInGoroutineDaemon(config *rest.Config, namespace, podName, localPort string, remotePort int32, stopChan chan struct{}, readyChan chan struct{}) error {
-	transport, upgrader, err := spdy.RoundTripperFor(config)
-	if err != nil {
-		return fmt.Errorf("failed to create round tripper: %v", err)
+// credentialRefresher rebuilds a daemon's clients when the cluster rejects its credentials,
+// e.g. once a short-lived token expired. It reloads at most once per failing attempt, so
+// credentials that stay rejected end the attempt instead of looping.
+type credentialRefresher struct {
+	reload    func() (*rest.Config, *kubernetes.Clientset, error)
+	refreshed bool
+}
+
+// refresh reloads the clients if err is an auth error and no reload was tried since the last
+// reset, returning the new clients and whether they were reloaded
+func (r *credentialRefresher) refresh(err error) (*rest.Config, *kubernetes.Clientset, bool) {
+	if r.refreshed || r.reload == nil || !isAuthError(err) {
+		return nil, nil, false
+	}
+	r.refreshed = true
+	fmt.Fprintf(os.Stderr, "Credentials rejected (%v), reloading kubeconfig...\n", err)
+	config, clientset, rerr := r.reload()
+	if rerr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reload credentials: %v\n", rerr)
+		return nil, nil, false
 	}
+	return config, clientset, true
+}
 
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", namespace, podName)
-	hostIP := strings.TrimPrefix(config.Host, "https://")
-	hostIP = strings.TrimPrefix(hostIP, "http://")
+// reset allows another reload, once an attempt with the current credentials went through
+func (r *credentialRefresher) reset() {
+	r.refreshed = false
+}
 
-	serverURL := &url.URL{
-		Scheme: "https",
-		Path:   path,
-		Host:   hostIP,
+// writeReadyFile writes the local port to path once a forward is ready.
+// The file is written under a temporary name and renamed, so watchers never see partial content.
+func writeReadyFile(path, localPort string) error {
+	if path == "" {
+		return nil
 	}
 
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, serverURL)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(localPort+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
 
-	ports := []string{fmt.Sprintf("%s:%d", localPort, remotePort)}
-	pf, err := portforward.New(dialer, ports, stopChan, readyChan, io.Discard, io.Discard)
+// resolveServicePod looks up the service and selects a pod behind it according to opts or,
+// with fromEndpoints, takes the pod from the endpoints of a service without a selector.
+// With a servicePort, the remote port is also looked up for that pod through the port's named
+// targetPort; otherwise the returned remote port is 0 and the current one still applies.
+func resolveServicePod(clientset kubernetes.Interface, namespace, serviceName string, servicePort int32, opts PodSelectOptions, fromEndpoints bool) (*corev1.Pod, int32, error) {
+	resolved, err := ResolveService(clientset, namespace, serviceName)
 	if err != nil {
-		return fmt.Errorf("failed to create port-forward: %v", err)
+		return nil, 0, err
+	}
+	if fromEndpoints {
+		pod, ports, err := endpointPod(clientset, resolved.Service)
+		if err != nil {
+			return nil, 0, err
+		}
+		if servicePort == 0 {
+			return pod, 0, nil
+		}
+		return pod, endpointTargetPort(resolved.Service, ports, servicePort), nil
 	}
+	selection, err := resolved.SelectPod(clientset, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if servicePort == 0 {
+		return selection.Pod, 0, nil
+	}
+	remotePort, err := podTargetPort(resolved.Service, selection.Pod, servicePort)
+	if err != nil {
+		return nil, 0, err
+	}
+	return selection.Pod, remotePort, nil
+}
 
-	return pf.ForwardPorts()
+// newDaemonPortForwarder creates the daemon's port-forward on an ephemeral loopback port.
+// Local clients reach it through the daemon's forwardProxy rather than directly.
+func newDaemonPortForwarder(config *rest.Config, namespace, podName string, remotePort int32, stopChan chan struct{}, readyChan chan struct{}) (*portforward.PortForwarder, error) {
+	ports := []string{fmt.Sprintf("0:%d", remotePort)}
+	return newPortForwarder(config, namespace, podName, []string{"127.0.0.1"}, ports, stopChan, readyChan, io.Discard, io.Discard)
 }
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestIsAuthError(t *testing.T) {
+	expired := apierrors.NewUnauthorized("token has expired")
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unauthorized", expired, true},
+		{"wrapped by apiFailure", apiFailure(expired, "failed to get service: %v", expired), true},
+		{"wrapped with %w", fmt.Errorf("port-forward failed: %w", expired), true},
+		{"forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "web", errors.New("no")), false},
+		{"pod name containing 401", errors.New(`pods "api-4012" not found`), false},
+		{"message mentioning Unauthorized", errors.New("backend said Unauthorized"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isAuthError(tt.err); got != tt.want {
+				t.Errorf("isAuthError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialRefresherReloadsExpiredToken(t *testing.T) {
+	reloads := 0
+	refreshedConfig := &rest.Config{BearerToken: "fresh"}
+	refresher := &credentialRefresher{reload: func() (*rest.Config, *kubernetes.Clientset, error) {
+		reloads++
+		return refreshedConfig, nil, nil
+	}}
+	expired := apiFailure(apierrors.NewUnauthorized("token has expired"), "failed to get service")
+
+	config, _, ok := refresher.refresh(expired)
+	if !ok || config != refreshedConfig {
+		t.Fatalf("refresh(expired token) = %v, %v, want the reloaded config", config, ok)
+	}
+	// Still rejected with the reloaded credentials: give up instead of reloading again
+	if _, _, ok := refresher.refresh(expired); ok {
+		t.Errorf("refresh reloaded twice within one attempt")
+	}
+
+	// Once an attempt succeeds, a later expiry is refreshed again
+	refresher.reset()
+	if _, _, ok := refresher.refresh(expired); !ok {
+		t.Errorf("refresh after reset did not reload")
+	}
+	if reloads != 2 {
+		t.Errorf("reloads = %d, want 2", reloads)
+	}
+}
+
+func TestCredentialRefresherIgnoresOtherErrors(t *testing.T) {
+	reloads := 0
+	refresher := &credentialRefresher{reload: func() (*rest.Config, *kubernetes.Clientset, error) {
+		reloads++
+		return &rest.Config{}, nil, nil
+	}}
+
+	for _, err := range []error{
+		errors.New(`pods "api-4012" not found`),
+		apierrors.NewNotFound(schema.GroupResource{Resource: "services"}, "web"),
+		nil,
+	} {
+		if _, _, ok := refresher.refresh(err); ok {
+			t.Errorf("refresh(%v) reloaded credentials", err)
+		}
+	}
+	if reloads != 0 {
+		t.Errorf("reloads = %d, want 0", reloads)
+	}
+}
+
+func TestCredentialRefresherReloadFailure(t *testing.T) {
+	refresher := &credentialRefresher{reload: func() (*rest.Config, *kubernetes.Clientset, error) {
+		return nil, nil, errors.New("exec plugin failed")
+	}}
+	if _, _, ok := refresher.refresh(apierrors.NewUnauthorized("expired")); ok {
+		t.Errorf("refresh reported success although the reload failed")
+	}
+
+	// Without a reload function nothing is refreshed
+	if _, _, ok := (&credentialRefresher{}).refresh(apierrors.NewUnauthorized("expired")); ok {
+		t.Errorf("refresh without reload function reported success")
+	}
+}
+
+func TestTTLTimer(t *testing.T) {
+	fake := useFakeClock(t)
+
+	if ttlTimer(time.Time{}) != nil {
+		t.Fatalf("ttlTimer without TTL returned a channel")
+	}
+
+	conn := ConnectionInfo{ExpiresAt: fake.Now().Add(2 * time.Hour)}
+	expired := ttlTimer(conn.ExpiresAt)
+
+	fake.Advance(90 * time.Minute)
+	if received(expired) || conn.expired() {
+		t.Fatalf("TTL of 2h expired after 90m")
+	}
+	if got := conn.ttlRemaining(); got != "30m0s" {
+		t.Errorf("ttlRemaining() = %q after 90m of 2h, want 30m0s", got)
+	}
+
+	fake.Advance(30 * time.Minute)
+	if !received(expired) || !conn.expired() {
+		t.Fatalf("TTL of 2h did not expire after 2h")
+	}
+	if got := conn.ttlRemaining(); got != "expired" {
+		t.Errorf("ttlRemaining() = %q after the TTL, want expired", got)
+	}
+}
+
+func TestTTLTimerAlreadyPast(t *testing.T) {
+	fake := useFakeClock(t)
+	// A daemon restored after its deadline stops at once
+	if !received(ttlTimer(fake.Now().Add(-time.Minute))) {
+		t.Fatalf("ttlTimer for a past deadline did not fire at once")
+	}
+}
+
+func TestResolveServicePodFromEndpoints(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-db", Namespace: "app"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "sql", Port: 5432}}},
+	}
+	// The hand-managed endpoints now point at a pod in another namespace
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-db", Namespace: "app"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.8", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "db-2", Namespace: "data"}}},
+			Ports:     []corev1.EndpointPort{{Name: "sql", Port: 6432}},
+		}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-2", Namespace: "data"}}
+	clientset := fake.NewClientset(svc, endpoints, pod)
+
+	found, remotePort, err := resolveServicePod(clientset, "app", "legacy-db", 5432, PodSelectOptions{}, true)
+	if err != nil {
+		t.Fatalf("resolveServicePod failed: %v", err)
+	}
+	if found.Namespace != "data" || found.Name != "db-2" || remotePort != 6432 {
+		t.Errorf("resolveServicePod() = %s/%s:%d, want data/db-2:6432", found.Namespace, found.Name, remotePort)
+	}
+
+	// Without fromEndpoints the service is resolved through its selector, which it lacks
+	if _, _, err := resolveServicePod(clientset, "app", "legacy-db", 5432, PodSelectOptions{}, false); err == nil {
+		t.Errorf("resolveServicePod without fromEndpoints succeeded for a service without a selector")
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// portAllocation is a local port held by a recorded connection
+type portAllocation struct {
+	LocalPort string `json:"local_port"`
+	Service   string `json:"service"`
+	Namespace string `json:"namespace"`
+	Context   string `json:"context,omitempty"`
+	Mirror    bool   `json:"mirror,omitempty"` // an extra port of connect --mirror
+	PID       int    `json:"pid"`
+}
+
+// portRegistry is the ports file: the allocations derived from the connections file,
+// with the size and modification time of the connections file they were derived from
+type portRegistry struct {
+	SourceSize     int64            `json:"source_size"`
+	SourceModified time.Time        `json:"source_modified"`
+	Ports          []portAllocation `json:"ports"`
+}
+
+// getPortsFile returns the path of the port registry
+func getPortsFile() string {
+	return filepath.Join(filepath.Dir(getConnectionsFile()), "ports.json")
+}
+
+// newPortAllocations lists the local ports of connections, including their mirrors, by port number
+func newPortAllocations(connections []ConnectionInfo) []portAllocation {
+	var ports []portAllocation
+	for _, conn := range connections {
+		add := func(localPorts string, mirror bool) {
+			for _, port := range strings.Split(localPorts, ",") {
+				ports = append(ports, portAllocation{
+					LocalPort: strings.TrimSpace(port),
+					Service:   conn.ServiceName,
+					Namespace: conn.Namespace,
+					Context:   conn.Context,
+					Mirror:    mirror,
+					PID:       conn.PID,
+				})
+			}
+		}
+		add(conn.LocalPort, false)
+		for _, mirror := range conn.Mirrors {
+			add(mirror.LocalPort, true)
+		}
+	}
+
+	sort.SliceStable(ports, func(i, j int) bool {
+		a, _ := strconv.Atoi(ports[i].LocalPort)
+		b, _ := strconv.Atoi(ports[j].LocalPort)
+		return a < b
+	})
+	return ports
+}
+
+// allocatedPorts returns the local ports held by recorded connections. They are cached in the
+// ports file and only derived again when the connections file changed since.
+// The cache is best effort: failing to write it never fails the command.
+func allocatedPorts() ([]portAllocation, error) {
+	if memoryStore.enabled {
+		connections, err := loadConnections()
+		if err != nil {
+			return nil, err
+		}
+		return newPortAllocations(connections), nil
+	}
+
+	info, err := os.Stat(existingConnectionsFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connections file: %v", err)
+	}
+
+	var registry portRegistry
+	if data, err := os.ReadFile(getPortsFile()); err == nil && json.Unmarshal(data, &registry) == nil &&
+		registry.SourceSize == info.Size() && registry.SourceModified.Equal(info.ModTime()) {
+		return registry.Ports, nil
+	}
+
+	connections, err := loadConnections()
+	if err != nil {
+		return nil, err
+	}
+	registry = portRegistry{
+		SourceSize:     info.Size(),
+		SourceModified: info.ModTime(),
+		Ports:          newPortAllocations(connections),
+	}
+	if data, err := json.MarshalIndent(registry, "", "  "); err == nil {
+		tmpPath := getPortsFile() + ".tmp"
+		if err := os.WriteFile(tmpPath, data, 0600); err == nil {
+			os.Rename(tmpPath, getPortsFile())
+		} else {
+			os.Remove(tmpPath)
+		}
+	}
+	return registry.Ports, nil
+}
+
+// NewPortsCmd creates the ports command
+func NewPortsCmd() *cobra.Command {
+	var (
+		outputFormat string
+		tmpl         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ports",
+		Short: "List the local ports allocated to connections",
+		Long: `List the local ports held by recorded connections, including mirror ports,
+and the service each belongs to. Ports of stopped connections stay allocated
+until the connection is removed, so connect restore can bring it back on the
+same port; connect --local-port-range skips all of them.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ports, err := allocatedPorts()
+			if err != nil {
+				return fmt.Errorf("failed to load connections: %v", err)
+			}
+			if ports == nil {
+				ports = []portAllocation{}
+			}
+
+			if ok, err := printFormatted(outputFormat, tmpl, ports); ok {
+				return err
+			}
+
+			if len(ports) == 0 {
+				fmt.Fprintln(output, "No local ports allocated.")
+				return nil
+			}
+			w := tabwriter.NewWriter(output, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "PORT\tSERVICE\tNAMESPACE\tCONTEXT\tSTATUS")
+			for _, port := range ports {
+				service := port.Service
+				if port.Mirror {
+					service += " (mirror)"
+				}
+				status := "stopped"
+				if isProcessRunning(port.PID) {
+					status = "running"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", port.LocalPort, service, port.Namespace, port.Context, status)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the port list with -o template")
+
+	return cmd
+}
@@ -0,0 +1,74 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// isProcessRunning checks if a process is still running.
+// Signal 0 performs the existence and permission checks without delivering a signal;
+// EPERM means the process exists but belongs to another user.
+func isProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// daemonSysProcAttr returns the process attributes for a detached background daemon
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid: true, // Create new session (daemon)
+	}
+}
+
+// hookSysProcAttr starts an exec hook in a process group of its own, so that stopping it also
+// ends the commands its shell started. When bugx runs in the foreground of a terminal, the
+// hook's group takes that place, so the hook can read the terminal and Ctrl+C reaches all of
+// its processes.
+func hookSysProcAttr() *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true}
+	if pgrp, err := terminalForeground(); err == nil && pgrp == syscall.Getpgrp() {
+		attr.Foreground = true
+		attr.Ctty = int(os.Stdin.Fd())
+	}
+	return attr
+}
+
+// terminalForeground returns the foreground process group of the terminal on stdin,
+// failing if stdin is not a terminal
+func terminalForeground() (int, error) {
+	var pgrp int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp))); errno != 0 {
+		return 0, errno
+	}
+	return int(pgrp), nil
+}
+
+// signalHook sends sig to every process in the hook's process group
+func signalHook(process *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-process.Pid, sig)
+}
+
+// reclaimTerminal makes bugx's process group the terminal's foreground group again once a
+// hook started with attr in the foreground has exited. bugx is a background group until then,
+// so SIGTTOU is ignored while it takes the terminal back.
+func reclaimTerminal(attr *syscall.SysProcAttr) {
+	if attr == nil || !attr.Foreground {
+		return
+	}
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	pgrp := int32(syscall.Getpgrp())
+	syscall.Syscall(syscall.SYS_IOCTL, os.Stdin.Fd(), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgrp)))
+}
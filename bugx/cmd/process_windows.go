@@ -0,0 +1,67 @@
+//go:build windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	// processQueryLimitedInformation is enough to read the exit code, and is granted
+	// for more processes than PROCESS_QUERY_INFORMATION
+	processQueryLimitedInformation = 0x1000
+
+	// detachedProcess starts the daemon without a console, so closing the
+	// parent's console window does not terminate it (DETACHED_PROCESS)
+	detachedProcess = 0x00000008
+
+	// stillActive is the exit code Windows reports for a process that has not exited (STILL_ACTIVE)
+	stillActive = 259
+)
+
+// isProcessRunning checks if a process is still running.
+// os.FindProcess always succeeds on Windows, so the process is opened and its exit code queried instead.
+func isProcessRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return false
+	}
+	return exitCode == stillActive
+}
+
+// daemonSysProcAttr returns the process attributes for a detached background daemon.
+// A new process group keeps Ctrl+C in the parent's console from reaching the daemon.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+		HideWindow:    true,
+	}
+}
+
+// hookSysProcAttr leaves an exec hook in bugx's console process group, so Ctrl+C still
+// reaches it. Windows cannot signal a group the way Unix does, so stopping a hook ends its
+// cmd.exe but not commands it started in the background.
+func hookSysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// signalHook sends sig to the hook's shell; only SIGKILL can be delivered on Windows
+func signalHook(process *os.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return process.Kill()
+	}
+	return process.Signal(sig)
+}
+
+// reclaimTerminal does nothing on Windows, where a hook never takes over the console
+func reclaimTerminal(attr *syscall.SysProcAttr) {}
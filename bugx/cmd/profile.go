@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	"bugxcli/bugx/config"
+)
+
+// activeProfile holds the defaults of the selected profile, or nil when none is in use
+var activeProfile *config.Profile
+
+// loadActiveProfile selects the profile named by --profile, falling back to
+// the one saved with "bugx config use-profile"
+func loadActiveProfile(name string) error {
+	cfg := config.NewConfig()
+
+	if name == "" {
+		// A saved profile that has since been deleted must not break every command
+		saved, err := cfg.LoadActiveProfile()
+		if err != nil || saved == "" {
+			return nil
+		}
+		profile, err := cfg.LoadProfile(saved)
+		if err != nil {
+			warnf("ignoring active profile: %v", err)
+			return nil
+		}
+		activeProfile = profile
+		return nil
+	}
+
+	profile, err := cfg.LoadProfile(name)
+	if err != nil {
+		return err
+	}
+	activeProfile = profile
+	return nil
+}
+
+// warnProfileCluster warns when the active profile is for another cluster than the one the
+// kubeconfig context points at, e.g. a prod profile used with a staging context
+func warnProfileCluster(kubeconfigPath, kubeContext string) {
+	if activeProfile == nil || activeProfile.ClusterName == "" {
+		return
+	}
+	cluster := contextCluster(kubeconfigPath, kubeContext)
+	if cluster == "" || cluster == activeProfile.ClusterName {
+		return
+	}
+	if kubeContext == "" {
+		kubeContext = "the current context"
+	} else {
+		kubeContext = "context " + kubeContext
+	}
+	warnf("profile %q is for cluster %s, but %s uses cluster %s", activeProfile.Name, activeProfile.ClusterName, kubeContext, cluster)
+}
+
+// resolveNamespace returns the namespace flag value, the active profile's namespace, or "default"
+func resolveNamespace(namespace string) string {
+	resolved, _ := resolveNamespaceSource(namespace)
+	return resolved
+}
+
+// resolveNamespaceSource is resolveNamespace that also reports where the namespace came from
+func resolveNamespaceSource(namespace string) (string, string) {
+	if namespace != "" {
+		return namespace, sourceFlag
+	}
+	if activeProfile != nil && activeProfile.Namespace != "" {
+		return activeProfile.Namespace, profileSource()
+	}
+	return "default", sourceDefault
+}
+
+// Sources of a resolved setting, as shown by config effective
+const (
+	sourceFlag       = "flag"
+	sourceConfigFile = "config file"
+	sourceDefault    = "default"
+	sourceNone       = "not set"
+)
+
+// profileSource names the active profile as the source of a setting
+func profileSource() string {
+	return fmt.Sprintf("profile %q", activeProfile.Name)
+}
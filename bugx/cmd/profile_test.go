@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bugxcli/bugx/config"
+)
+
+func TestWarnProfileCluster(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	data := `apiVersion: v1
+kind: Config
+current-context: staging
+clusters:
+- name: staging-cluster
+  cluster: {server: https://staging.example.com}
+- name: prod-cluster
+  cluster: {server: https://prod.example.com}
+contexts:
+- name: staging
+  context: {cluster: staging-cluster, user: dev}
+- name: prod
+  context: {cluster: prod-cluster, user: dev}
+users:
+- name: dev
+  user: {token: abc}
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var printed strings.Builder
+	previousProfile, previousWarnings := activeProfile, warnings
+	activeProfile = &config.Profile{Name: "prod", ClusterName: "prod-cluster"}
+	warnings = &printed
+	t.Cleanup(func() { activeProfile, warnings = previousProfile, previousWarnings })
+
+	warnProfileCluster(kubeconfig, "prod")
+	if printed.Len() != 0 {
+		t.Errorf("warned for the profile's own cluster: %s", printed.String())
+	}
+
+	warnProfileCluster(kubeconfig, "")
+	want := `Warning: profile "prod" is for cluster prod-cluster, but the current context uses cluster staging-cluster`
+	if !strings.Contains(printed.String(), want) {
+		t.Errorf("warning = %q, want %q", printed.String(), want)
+	}
+}
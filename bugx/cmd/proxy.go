@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// forwardProxy owns the daemon's local listeners and relays each accepted connection
+// to the port-forward's internal listener, counting the bytes copied in each direction.
+// Because the proxy holds the local port, the forward underneath can be restarted
+// without the port ever being released.
+type forwardProxy struct {
+	listeners []net.Listener
+	target    atomic.Value // host:port of the internal port-forward listener
+
+	bytesIn  atomic.Int64 // from local clients to the pod
+	bytesOut atomic.Int64 // from the pod to local clients
+
+	// mu orders accepting a connection before closing, so no connection is added to wg
+	// once drain may be waiting on it
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// newForwardProxy listens on localPort for each of the given addresses.
+// Like kubectl, "localhost" binds both IPv4 and IPv6 loopback, tolerating one of them failing.
+func newForwardProxy(addresses []string, localPort string) (*forwardProxy, error) {
+	if len(addresses) == 0 {
+		addresses = defaultAddresses
+	}
+
+	proxy := &forwardProxy{}
+	for _, address := range addresses {
+		if address == "localhost" {
+			ipv4, err4 := net.Listen("tcp", net.JoinHostPort("127.0.0.1", localPort))
+			ipv6, err6 := net.Listen("tcp", net.JoinHostPort("::1", localPort))
+			if err4 != nil && err6 != nil {
+				proxy.close()
+				return nil, fmt.Errorf("failed to listen on localhost:%s: %v", localPort, err4)
+			}
+			for _, listener := range []net.Listener{ipv4, ipv6} {
+				if listener != nil {
+					proxy.listeners = append(proxy.listeners, listener)
+				}
+			}
+			continue
+		}
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, localPort))
+		if err != nil {
+			proxy.close()
+			return nil, fmt.Errorf("failed to listen on %s: %v", net.JoinHostPort(address, localPort), err)
+		}
+		proxy.listeners = append(proxy.listeners, listener)
+	}
+
+	return proxy, nil
+}
+
+// setTarget points new connections at the internal port-forward listener
+func (p *forwardProxy) setTarget(address string) {
+	p.target.Store(address)
+}
+
+// serve accepts connections on all listeners until the proxy is closed
+func (p *forwardProxy) serve() {
+	for _, listener := range p.listeners {
+		go func(listener net.Listener) {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				p.mu.Lock()
+				if p.closed {
+					p.mu.Unlock()
+					conn.Close()
+					return
+				}
+				p.wg.Add(1)
+				p.mu.Unlock()
+				go p.handle(conn)
+			}
+		}(listener)
+	}
+}
+
+// handle relays a single local connection to the current target
+func (p *forwardProxy) handle(conn net.Conn) {
+	defer p.wg.Done()
+	defer conn.Close()
+
+	target, _ := p.target.Load().(string)
+	if target == "" {
+		return
+	}
+
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{})
+	go func() {
+		io.Copy(countingWriter{w: upstream, count: &p.bytesIn}, conn)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		close(done)
+	}()
+
+	io.Copy(countingWriter{w: conn, count: &p.bytesOut}, upstream)
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+	}
+	<-done
+}
+
+// close stops accepting new connections; a connection accepted concurrently is refused
+func (p *forwardProxy) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	for _, listener := range p.listeners {
+		listener.Close()
+	}
+}
+
+// drain stops accepting new connections and returns a channel that is closed
+// once every connection already accepted has finished
+func (p *forwardProxy) drain() <-chan struct{} {
+	p.close()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// countingWriter adds the number of bytes written to a shared counter
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.count.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startEchoServer listens on loopback and echoes every connection until the test ends
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// startTestProxy starts a forwardProxy on a free loopback port relaying to target
+func startTestProxy(t *testing.T, target string) (*forwardProxy, string) {
+	t.Helper()
+	proxy, err := newForwardProxy([]string{"127.0.0.1"}, "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(proxy.close)
+	proxy.setTarget(target)
+	proxy.serve()
+	return proxy, proxy.listeners[0].Addr().String()
+}
+
+func TestForwardProxyDrainWaitsForOpenConnections(t *testing.T) {
+	proxy, address := startTestProxy(t, startEchoServer(t))
+
+	client, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The echo proves the connection was accepted before the drain starts
+	client.Write([]byte("ping"))
+	if _, err := io.ReadFull(client, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	drained := proxy.drain()
+	if _, err := net.DialTimeout("tcp", address, time.Second); err == nil {
+		t.Errorf("draining proxy still accepts connections")
+	}
+	select {
+	case <-drained:
+		t.Fatalf("drain finished while a connection was open")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	client.Close()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("drain did not finish after the last connection closed")
+	}
+	if proxy.bytesIn.Load() != 4 || proxy.bytesOut.Load() != 4 {
+		t.Errorf("bytes in/out = %d/%d, want 4/4", proxy.bytesIn.Load(), proxy.bytesOut.Load())
+	}
+}
+
+// TestForwardProxyDrainWhileAccepting drains while clients keep connecting; run with -race
+// to check that no connection is added once drain waits
+func TestForwardProxyDrainWhileAccepting(t *testing.T) {
+	for range 20 {
+		proxy, address := startTestProxy(t, startEchoServer(t))
+
+		var clients sync.WaitGroup
+		for range 8 {
+			clients.Add(1)
+			go func() {
+				defer clients.Done()
+				for range 10 {
+					if conn, err := net.Dial("tcp", address); err == nil {
+						conn.Close()
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		select {
+		case <-proxy.drain():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("drain did not finish")
+		}
+		clients.Wait()
+	}
+}
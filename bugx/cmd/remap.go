@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewConnectRemapCmd creates the connect remap command
+func NewConnectRemapCmd() *cobra.Command {
+	var (
+		namespace string
+		localPort string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remap [servicename|alias]",
+		Short: "Move a background connection to another local port",
+		Long: `Move a running background connection to another local port, e.g. to resolve a
+port conflict, without restarting it or losing its connection entry.
+
+The daemon is signalled to listen on the new port and close the old one. The
+forward to the pod is not restarted; connections already open on the old port
+are kept until they close.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if retargetSignal == nil {
+				return fmt.Errorf("remap is not supported on this platform")
+			}
+			if localPort == "" {
+				return usageError("--localport is required")
+			}
+			if _, err := parseLocalPorts(localPort); err != nil {
+				return err
+			}
+
+			namespace = resolveNamespace(namespace)
+
+			conn, err := findConnection(kubeContextFlag, args[0], namespace)
+			if err != nil {
+				if conn, err = findConnectionByPrefix(kubeContextFlag, args[0], namespace); err != nil {
+					return err
+				}
+			}
+			if !isProcessRunning(conn.PID) {
+				return fmt.Errorf("connection to %s/%s is not running; use connect restore or connect again", namespace, conn.ServiceName)
+			}
+			oldPort := conn.LocalPort
+			if localPort == oldPort {
+				fmt.Fprintf(output, "%s/%s already listens on %s\n", namespace, conn.ServiceName, localEndpoint(conn.Addresses(), oldPort))
+				return nil
+			}
+			if !portAvailable(localPort, conn.Addresses()) {
+				return alreadyExistsError("local port %s is already in use", localPort)
+			}
+
+			if err := modifyConnection(conn.Context, conn.ServiceName, namespace, func(conn *ConnectionInfo) {
+				conn.LocalPort = localPort
+			}); err != nil {
+				return fmt.Errorf("failed to update connection: %v", err)
+			}
+
+			process, err := os.FindProcess(conn.PID)
+			if err == nil {
+				err = process.Signal(retargetSignal)
+			}
+			if err != nil {
+				modifyConnection(conn.Context, conn.ServiceName, namespace, func(conn *ConnectionInfo) {
+					conn.LocalPort = oldPort
+				})
+				return fmt.Errorf("failed to signal daemon: %v", err)
+			}
+
+			// The daemon puts the old port back in the record if it cannot listen on the new one
+			endpoint := localEndpoint(conn.Addresses(), localPort)
+			deadline := timeSource.Now().Add(timings.RemapTimeout)
+			for timeSource.Now().Before(deadline) {
+				<-timeSource.After(100 * time.Millisecond)
+				if probeTCP(endpoint, statusProbeTimeout) {
+					fmt.Fprintf(output, "Moved %s/%s from %s to %s\n", namespace, conn.ServiceName, localEndpoint(conn.Addresses(), oldPort), endpoint)
+					return nil
+				}
+				if current, err := findConnection(conn.Context, conn.ServiceName, namespace); err == nil && current.LocalPort == oldPort {
+					return fmt.Errorf("daemon could not listen on port %s and kept %s; see %s", localPort, oldPort, conn.LogFile)
+				}
+			}
+			return fmt.Errorf("daemon did not move to port %s within %s; see %s", localPort, timings.RemapTimeout, conn.LogFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().StringVarP(&localPort, "localport", "l", "", "New local port")
+
+	cmd.ValidArgsFunction = completeConnectionNames
+
+	return cmd
+}
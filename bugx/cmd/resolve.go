@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResolvedService is a service looked up for forwarding, with the selector of its pods
+type ResolvedService struct {
+	Service  *corev1.Service
+	Selector labels.Selector // nil if the service has no selector (ExternalName, or endpoints managed by hand)
+}
+
+// ResolveService gets a service and builds the selector of the pods behind it
+func ResolveService(clientset kubernetes.Interface, namespace, name string) (*ResolvedService, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, apiFailure(err, "failed to get service: %v", err)
+	}
+	return newResolvedService(svc), nil
+}
+
+// newResolvedService wraps a service that was already fetched
+func newResolvedService(svc *corev1.Service) *ResolvedService {
+	resolved := &ResolvedService{Service: svc}
+	if len(svc.Spec.Selector) > 0 {
+		resolved.Selector = labels.SelectorFromSet(svc.Spec.Selector)
+	}
+	return resolved
+}
+
+// SelectPod picks a pod behind the service, see SelectPod
+func (r *ResolvedService) SelectPod(clientset kubernetes.Interface, opts PodSelectOptions) (*PodSelection, error) {
+	if r.Selector == nil {
+		return nil, fmt.Errorf("service %s has no selector", r.Service.Name)
+	}
+	selection, err := SelectPod(clientset, r.Service.Namespace, r.Selector, opts)
+	if err != nil {
+		return nil, fmt.Errorf("service %s: %w", r.Service.Name, err)
+	}
+	return selection, nil
+}
+
+// endpointPod returns the pod behind a service without a selector, whose Endpoints object is
+// managed by hand: the target of its first ready address that is a pod, else of its first
+// not-ready one. The target may be a pod in another namespace than the service's. The ports
+// of the subset the pod was found in are returned too, for endpointTargetPort.
+func endpointPod(clientset kubernetes.Interface, svc *corev1.Service) (*corev1.Pod, []corev1.EndpointPort, error) {
+	endpoints, err := clientset.CoreV1().Endpoints(svc.Namespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, apiFailure(err, "service %s has no selector, and its endpoints could not be read: %v", svc.Name, err)
+	}
+
+	var ref *corev1.ObjectReference
+	var ports []corev1.EndpointPort
+	for _, subset := range endpoints.Subsets {
+		for _, addresses := range [][]corev1.EndpointAddress{subset.Addresses, subset.NotReadyAddresses} {
+			for _, address := range addresses {
+				if ref == nil && address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+					ref = address.TargetRef
+				}
+			}
+		}
+		if ref != nil {
+			ports = subset.Ports
+			break
+		}
+	}
+	if ref == nil {
+		return nil, nil, notFoundError("service %s has no selector and none of its endpoints is a pod", svc.Name)
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = svc.Namespace
+	}
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, apiFailure(err, "failed to get pod %s/%s behind the endpoints of service %s: %v", namespace, ref.Name, svc.Name, err)
+	}
+	return pod, ports, nil
+}
+
+// endpointTargetPort returns the pod port that the endpoints of a service without a selector
+// give for service port port: the endpoint port of the same name, or the only one. The
+// targetPort of such a service is not used, so the pod's containers are not consulted.
+func endpointTargetPort(svc *corev1.Service, ports []corev1.EndpointPort, port int32) int32 {
+	for _, servicePort := range svc.Spec.Ports {
+		if servicePort.Port != port {
+			continue
+		}
+		for _, endpointPort := range ports {
+			if endpointPort.Name == servicePort.Name {
+				return endpointPort.Port
+			}
+		}
+		if len(ports) == 1 {
+			return ports[0].Port
+		}
+		break
+	}
+	return port
+}
+
+// Pod selection strategies, chosen with connect --pod-selection
+const (
+	podSelectionFirst         = "first"          // the first pod in list order
+	podSelectionRandom        = "random"         // a random Ready pod, or any pod if none is Ready
+	podSelectionLeastRestarts = "least-restarts" // the Ready pod whose containers restarted least
+)
+
+// validatePodSelection checks a --pod-selection strategy
+func validatePodSelection(strategy string) error {
+	switch strategy {
+	case "", podSelectionFirst, podSelectionRandom, podSelectionLeastRestarts:
+		return nil
+	}
+	return usageError("invalid --pod-selection %q (must be first, random or least-restarts)", strategy)
+}
+
+// PodSelectOptions controls which of the matching pods SelectPod picks.
+// The zero value picks the first pod in list order.
+type PodSelectOptions struct {
+	PreferReady bool // pick the first Ready pod, falling back to the first pod if none is Ready
+	UseOrdinal  bool // pick the StatefulSet pod with Ordinal, failing if there is none
+	Ordinal     int
+	Strategy    string // one of the pod selection strategies; empty is podSelectionFirst
+	Owner       string // only pick pods of this workload, as kind/name (see podOwner)
+}
+
+// PodSelection is the pod SelectPod picked and the candidates it picked from
+type PodSelection struct {
+	Pod    *corev1.Pod
+	Pods   []corev1.Pod // every pod matching the selector (and the owner, if given), in list order
+	Owners []string     // the workloads owning the pods matching the selector, sorted
+}
+
+// SelectPod lists the pods in namespace matching selector and picks one of them according to opts
+func SelectPod(clientset kubernetes.Interface, namespace string, selector labels.Selector, opts PodSelectOptions) (*PodSelection, error) {
+	if selector == nil || selector.Empty() {
+		return nil, fmt.Errorf("refusing to select from every pod in namespace %s with an empty selector", namespace)
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, apiFailure(err, "failed to list pods: %v", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, notFoundError("no pods found with selector %s", selector)
+	}
+
+	selection := &PodSelection{Pods: pods.Items, Owners: podOwners(pods.Items)}
+	if opts.Owner != "" {
+		selection.Pods = nil
+		for _, pod := range pods.Items {
+			if podOwner(&pod) == opts.Owner {
+				selection.Pods = append(selection.Pods, pod)
+			}
+		}
+		if len(selection.Pods) == 0 {
+			return nil, notFoundError("no pods of %s found with selector %s (owners: %s)", opts.Owner, selector, strings.Join(selection.Owners, ", "))
+		}
+	}
+	selection.Pod = &selection.Pods[0]
+	switch opts.Strategy {
+	case podSelectionRandom:
+		candidates := readyPods(selection.Pods)
+		selection.Pod = candidates[rand.IntN(len(candidates))]
+	case podSelectionLeastRestarts:
+		selection.Pod = leastRestartsPod(readyPods(selection.Pods))
+	default:
+		if opts.PreferReady {
+			selection.Pod = preferReadyPod(selection.Pods)
+		}
+	}
+	if opts.UseOrdinal {
+		if selection.Pod, err = selectPodByOrdinal(selection.Pods, opts.Ordinal); err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+// readyPods returns the Ready pods, or every pod if none is Ready
+func readyPods(pods []corev1.Pod) []*corev1.Pod {
+	var ready, all []*corev1.Pod
+	for i := range pods {
+		all = append(all, &pods[i])
+		if isPodReady(&pods[i]) {
+			ready = append(ready, &pods[i])
+		}
+	}
+	if len(ready) == 0 {
+		return all
+	}
+	return ready
+}
+
+// leastRestartsPod returns the pod with the fewest container restarts, the earliest on a tie
+func leastRestartsPod(pods []*corev1.Pod) *corev1.Pod {
+	best := pods[0]
+	for _, pod := range pods[1:] {
+		if podRestarts(pod) < podRestarts(best) {
+			best = pod
+		}
+	}
+	return best
+}
+
+// podRestarts sums the restart counts of a pod's containers
+func podRestarts(pod *corev1.Pod) int32 {
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+	}
+	return restarts
+}
+
+// podOwner returns the workload controlling a pod as kind/name, e.g. deployment/web-green, or
+// an empty string for a bare pod. A Deployment's ReplicaSet is named after it plus the pod's
+// pod-template-hash label, so the Deployment is read from the pod without fetching the ReplicaSet.
+func podOwner(pod *corev1.Pod) string {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return ""
+	}
+	if hash := pod.Labels["pod-template-hash"]; owner.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+		return "deployment/" + strings.TrimSuffix(owner.Name, "-"+hash)
+	}
+	return strings.ToLower(owner.Kind) + "/" + owner.Name
+}
+
+// podOwners returns the distinct workloads owning pods, sorted; bare pods are left out
+func podOwners(pods []corev1.Pod) []string {
+	seen := make(map[string]bool)
+	var owners []string
+	for i := range pods {
+		if owner := podOwner(&pods[i]); owner != "" && !seen[owner] {
+			seen[owner] = true
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// ownerKinds maps the short names kubectl accepts to workload kinds
+var ownerKinds = map[string]string{
+	"deploy": "deployment",
+	"sts":    "statefulset",
+	"ds":     "daemonset",
+	"rs":     "replicaset",
+}
+
+// parseOwner normalizes an --owner value of the form kind/name, e.g. deploy/web to deployment/web
+func parseOwner(value string) (string, error) {
+	kind, name, ok := strings.Cut(value, "/")
+	if !ok || kind == "" || name == "" {
+		return "", usageError("invalid --owner %q: expected kind/name, e.g. deployment/web-green", value)
+	}
+	kind = strings.ToLower(kind)
+	if full, ok := ownerKinds[kind]; ok {
+		kind = full
+	}
+	return kind + "/" + name, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEndpointPodAndPort(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-db", Namespace: "app"},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			// targetPort is ignored for a service without a selector
+			{Name: "sql", Port: 5432, TargetPort: intstr.FromInt32(9999)},
+			{Name: "metrics", Port: 9187},
+		}},
+	}
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy-db", Namespace: "app"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{{IP: "10.0.0.7", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "db-1", Namespace: "data"}}},
+			Ports:     []corev1.EndpointPort{{Name: "metrics", Port: 9100}, {Name: "sql", Port: 6432}},
+		}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "data"}}
+	clientset := fake.NewClientset(svc, endpoints, pod)
+
+	found, ports, err := endpointPod(clientset, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "db-1" || found.Namespace != "data" {
+		t.Errorf("endpointPod() = %s/%s, want data/db-1", found.Namespace, found.Name)
+	}
+	if got := endpointTargetPort(svc, ports, 5432); got != 6432 {
+		t.Errorf("endpointTargetPort(5432) = %d, want the endpoint port 6432", got)
+	}
+	if got := endpointTargetPort(svc, ports, 9187); got != 9100 {
+		t.Errorf("endpointTargetPort(9187) = %d, want 9100", got)
+	}
+	if got := endpointTargetPort(svc, ports, 1234); got != 1234 {
+		t.Errorf("endpointTargetPort(port not in the service) = %d, want it unchanged", got)
+	}
+	if got := endpointTargetPort(svc, []corev1.EndpointPort{{Port: 7000}}, 5432); got != 7000 {
+		t.Errorf("endpointTargetPort with a single unnamed endpoint port = %d, want 7000", got)
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NewConnectRestoreCmd creates the connect restore command
+func NewConnectRestoreCmd() *cobra.Command {
+	var readyTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Re-establish recorded connections whose daemon is no longer running",
+		Long: `Re-establish every recorded connection whose daemon is no longer running,
+e.g. after a reboot.
+
+Each dead entry is replaced by a fresh background daemon using its stored
+service, namespace, ports, addresses, kubeconfig and context. The pod is
+resolved again, since the one recorded may no longer exist.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			connections, err := loadConnections()
+			if err != nil {
+				return fmt.Errorf("failed to load connections: %v", err)
+			}
+
+			restored, failed := 0, 0
+			for _, conn := range connections {
+				if isProcessRunning(conn.PID) {
+					continue
+				}
+				// A connection whose --ttl ran out while it was down is not brought back
+				if conn.expired() {
+					if err := removeConnection(conn.Context, conn.ServiceName, conn.Namespace); err != nil {
+						warnf("failed to remove expired %s/%s: %v", conn.Namespace, conn.ServiceName, err)
+					}
+					fmt.Fprintf(output, "  Expired  %s/%s, removed\n", conn.Namespace, conn.ServiceName)
+					continue
+				}
+
+				if err := restoreConnection(conn, readyTimeout); err != nil {
+					fmt.Fprintf(os.Stderr, "  Failed   %s/%s: %v\n", conn.Namespace, conn.ServiceName, err)
+					failed++
+					continue
+				}
+				restored++
+			}
+
+			fmt.Fprintf(output, "Restored %d connection(s), %d failed.\n", restored, failed)
+			if failed > 0 {
+				return fmt.Errorf("%d connection(s) could not be restored", failed)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 10*time.Second, "How long to wait for each forward to become ready")
+
+	return cmd
+}
+
+// restoreConnection replaces a dead connection entry with a freshly started daemon
+func restoreConnection(conn ConnectionInfo, readyTimeout time.Duration) error {
+	config, clientset, err := getClientsVia(conn.Kubeconfig, conn.Context, conn.SSHJump)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := ResolveService(clientset, conn.Namespace, conn.ServiceName)
+	if err != nil {
+		return err
+	}
+	// A pod given explicitly with connect --pod is kept rather than re-resolved, while the pod
+	// of a service without a selector is looked up in its hand-managed endpoints again
+	podName, podNamespace, remotePort := conn.PodName, conn.PodNamespace, conn.RemotePort
+	var candidates []corev1.Pod
+	if conn.PodFromEndpoints {
+		pod, ports, err := endpointPod(clientset, resolved.Service)
+		if err != nil {
+			return err
+		}
+		podName, podNamespace = pod.Name, pod.Namespace
+		if conn.ServicePort != 0 {
+			remotePort = endpointTargetPort(resolved.Service, ports, conn.ServicePort)
+		}
+	} else if conn.PodNamespace == "" {
+		selection, err := resolved.SelectPod(clientset, PodSelectOptions{Strategy: conn.PodSelection, Owner: conn.Owner})
+		if err != nil {
+			return err
+		}
+		podName, candidates = selection.Pod.Name, selection.Pods
+		// A named targetPort may map to another container port on the new pod
+		if conn.ServicePort != 0 {
+			if remotePort, err = podTargetPort(resolved.Service, selection.Pod, conn.ServicePort); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := removeConnection(conn.Context, conn.ServiceName, conn.Namespace); err != nil {
+		return fmt.Errorf("failed to remove stale entry: %v", err)
+	}
+
+	fresh := ConnectionInfo{
+		ServiceName:  conn.ServiceName,
+		Alias:        conn.Alias,
+		Namespace:    conn.Namespace,
+		LocalPort:    conn.LocalPort,
+		RemotePort:   remotePort,
+		ServicePort:  conn.ServicePort,
+		PodName:      podName,
+		PodNamespace: podNamespace,
+		PodSelection: conn.PodSelection,
+		Owner:        conn.Owner,
+		Address:      conn.Address,
+		Kubeconfig:   conn.Kubeconfig,
+		Context:      conn.Context,
+		Cluster:      conn.Cluster,
+		Server:       apiServer(config),
+		Labels:       conn.Labels,
+
+		Transport:             conn.Transport,
+		PingInterval:          conn.PingInterval,
+		SSHJump:               conn.SSHJump,
+		Command:               conn.Command,
+		TLSServerName:         conn.TLSServerName,
+		InsecureSkipTLSVerify: conn.InsecureSkipTLSVerify,
+		AnnotatePod:           conn.AnnotatePod,
+		HealthCmd:             conn.HealthCmd,
+		ExpiresAt:             conn.ExpiresAt,
+		Breaker:               conn.Breaker,
+		PodFromEndpoints:      conn.PodFromEndpoints,
+	}
+	if len(conn.Mirrors) > 0 {
+		// The old pods may be gone, so spread the mirrors over the current ones
+		// (mirrors cannot be combined with --pod, so the pod was just selected)
+		var ports []string
+		for _, mirror := range conn.Mirrors {
+			ports = append(ports, mirror.LocalPort)
+		}
+		fresh.Mirrors = assignMirrors(candidates, podName, ports)
+		if err := resolveMirrorPorts(fresh.Mirrors, candidates, resolved.Service, conn.ServicePort); err != nil {
+			return err
+		}
+	}
+	if err := createBackgroundPortForward(fresh, backgroundOptions{
+		sinceLog:     5,
+		hook:         &execHook{},
+		readyTimeout: readyTimeout,
+		noBanner:     true,
+	}); err != nil {
+		// Keep the definition so a later restore can retry it
+		conn.Status = "stopped"
+		if err := addConnection(conn); err != nil {
+			warnf("failed to keep %s/%s: %v", conn.Namespace, conn.ServiceName, err)
+		}
+		return err
+	}
+
+	fmt.Fprintf(output, "  Restored %s/%s on %s (pod %s)\n", conn.Namespace, conn.ServiceName, localEndpoint(fresh.Addresses(), fresh.LocalPort), podName)
+	return nil
+}
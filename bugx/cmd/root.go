@@ -1,22 +1,153 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
+// output receives banners and informational messages; --quiet replaces it with io.Discard
+var output io.Writer = os.Stdout
+
+// warnings receives the messages printed by warnf; --quiet replaces it with io.Discard too
+var warnings io.Writer = os.Stderr
+
+// warnf prints a warning on stderr, unless --quiet was given
+func warnf(format string, a ...interface{}) {
+	fmt.Fprintf(warnings, "Warning: "+format+"\n", a...)
+}
+
+// logFormat is "text" or "json"; json replaces the error message printed on exit with a result object
+var logFormat = "text"
+
+// commandResult is the final result object written to stderr with --log-format json
+type commandResult struct {
+	Command  string `json:"command"`
+	Success  bool   `json:"success"`
+	ExitCode int    `json:"exitCode"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Execute runs the bugx command line and returns the process exit code
+func Execute() int {
+	rootCmd := NewRootCmd()
+
+	// Unknown subcommands are handed to a bugx-<name> executable on PATH, if there is one
+	if path, ok := findPlugin(rootCmd, os.Args[1:]); ok {
+		return runPlugin(path, os.Args[2:])
+	}
+
+	// Errors are printed below rather than by cobra, so that with --log-format json even a
+	// flag parsing error, which fails before any hook runs, is reported only as a result object
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+	cmd, err := rootCmd.ExecuteC()
+	closeSSHJumps()
+	code := ExitCode(err)
+
+	if logFormat == "json" {
+		result := commandResult{Command: cmd.CommandPath(), Success: err == nil, ExitCode: code}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		data, _ := json.Marshal(result)
+		fmt.Fprintln(os.Stderr, string(data))
+	} else if err != nil {
+		cmd.PrintErrln(cmd.ErrPrefix(), err.Error())
+		cmd.PrintErrln(cmd.UsageString())
+	}
+	return code
+}
+
 // NewRootCmd creates the root command
 func NewRootCmd() *cobra.Command {
+	var (
+		quiet   bool
+		profile string
+	)
+
 	rootCmd := &cobra.Command{
-		Use:   "bugx",
-		Short: "BugX CLI - Manage service tunnels",
-		Long:  `BugX CLI is a command-line tool for managing creating service tunnels.`,
+		Use:     "bugx",
+		Version: Version,
+		Short:   "BugX CLI - Manage service tunnels",
+		Long:    `BugX CLI is a command-line tool for managing creating service tunnels.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if quiet {
+				output = io.Discard
+				warnings = io.Discard
+			}
+			switch logFormat {
+			case "text":
+			case "json":
+			default:
+				return usageError("invalid --log-format %q (must be text or json)", logFormat)
+			}
+			if err := validateTransport(forwardTransport); err != nil {
+				return err
+			}
+			if pingInterval != 0 && pingInterval < time.Second {
+				return usageError("invalid --ping-interval %s (must be at least 1s, or 0 for the defaults)", pingInterval)
+			}
+			if err := validateSSHJump(sshJump); err != nil {
+				return err
+			}
+			loadTimings(cmd)
+			loadStoreFormat()
+			return loadActiveProfile(profile)
+		},
 	}
 
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress all non-error output")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of the final result on stderr: text or json (a result object with the exit code, for CI)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Configuration profile whose defaults apply (overrides bugx config use-profile)")
+	rootCmd.PersistentFlags().StringVar(&kubeContextFlag, "context", "", "Kubeconfig context to use (defaults to the current context); also picks between connections to the same service in different contexts")
+	rootCmd.PersistentFlags().BoolVar(&mergeKubeconfig, "merge-kubeconfig", false, "Merge the files of a --kubeconfig flag with those in KUBECONFIG (the flag's files take precedence) instead of ignoring KUBECONFIG")
+	rootCmd.PersistentFlags().StringVar(&sshJump, "ssh-jump", "", "Reach the API server through an ssh local port-forward via this bastion, e.g. ops@bastion.example.com (needs ssh on PATH)")
+	rootCmd.PersistentFlags().StringVar(&forwardTransport, "transport", "auto", "Port-forward transport: auto (WebSocket, falling back to SPDY), websocket or spdy")
+	rootCmd.PersistentFlags().DurationVar(&pingInterval, "ping-interval", 0, "How often port-forward streams ping the API server, e.g. 30s; a stream silent for three intervals is treated as dead (0 keeps client-go's defaults)")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "request-timeout", 0, "Timeout for each Kubernetes API request, e.g. 10s (0 means no timeout); established tunnels are not affected")
+
 	// Add subcommands
 	rootCmd.AddCommand(NewConnectCmd())
 	rootCmd.AddCommand(NewServicesCmd())
 	rootCmd.AddCommand(NewDisconnectCmd())
+	rootCmd.AddCommand(NewExecCmd())
+	rootCmd.AddCommand(NewInspectCmd())
+	rootCmd.AddCommand(NewStatusCmd())
+	rootCmd.AddCommand(NewStatsCmd())
+	rootCmd.AddCommand(NewHistoryCmd())
+	rootCmd.AddCommand(NewConfigCmd())
+	rootCmd.AddCommand(NewUpCmd())
+	rootCmd.AddCommand(NewPortsCmd())
+	rootCmd.AddCommand(NewExportCmd())
+	rootCmd.AddCommand(NewCompletionCmd())
+	rootCmd.AddCommand(NewUpdateCmd())
 	rootCmd.AddCommand(NewDaemonCmd())
 
+	// Report flag and argument errors with ExitUsage
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &exitError{code: ExitUsage, err: err}
+	})
+	markUsageErrors(rootCmd)
+
 	return rootCmd
 }
+
+// markUsageErrors wraps the argument validators of cmd and its subcommands so their errors exit with ExitUsage
+func markUsageErrors(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return &exitError{code: ExitUsage, err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
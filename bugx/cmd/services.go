@@ -1,14 +1,27 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 
 	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // NewServicesCmd creates the services command
@@ -27,8 +40,16 @@ func NewServicesCmd() *cobra.Command {
 // NewServicesListCmd creates the services list command
 func NewServicesListCmd() *cobra.Command {
 	var (
-		kubeconfig string
-		namespace  string
+		kubeconfig   string
+		namespace    string
+		watchChanges bool
+		outputFormat string
+		tmpl         string
+		selector     string
+		serviceType  string
+		sortBy       string
+		withSelector bool
+		noSelector   bool
 	)
 
 	cmd := &cobra.Command{
@@ -36,80 +57,284 @@ func NewServicesListCmd() *cobra.Command {
 		Short: "List all services in a namespace",
 		Long:  `List all Kubernetes services in the specified namespace.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace = resolveNamespace(namespace)
+
+			// Validate the selector before making any API calls
+			if selector != "" {
+				if _, err := labels.Parse(selector); err != nil {
+					return usageError("invalid --selector %q: %v", selector, err)
+				}
+			}
+
+			if sortBy != "" && sortBy != "name" && sortBy != "type" && sortBy != "port" {
+				return usageError("invalid --sort %q (must be name, type or port)", sortBy)
+			}
+
+			if withSelector && noSelector {
+				return usageError("--with-selector and --no-selector cannot be used together")
+			}
+			selectorFilter := ""
+			if withSelector {
+				selectorFilter = "with"
+			} else if noSelector {
+				selectorFilter = "without"
+			}
+
+			if serviceType != "" {
+				var err error
+				if serviceType, err = normalizeServiceType(serviceType); err != nil {
+					return err
+				}
+			}
+
 			// Get kubeconfig path
 			kubeconfigPath := getKubeconfigPath(kubeconfig)
 			if kubeconfigPath == "" {
-				return fmt.Errorf("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
+				return notFoundError("kubeconfig not found. Use --kubeconfig flag or set KUBECONFIG env var")
 			}
 
-			// Build config from kubeconfig
-			config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+			// Build config and clientset from kubeconfig
+			_, clientset, err := getClients(kubeconfigPath, kubeContextFlag)
 			if err != nil {
-				return fmt.Errorf("failed to build config: %v", err)
+				return err
 			}
 
-			// Create clientset
-			clientset, err := kubernetes.NewForConfig(config)
+			// List services
+			services, resourceVersion, err := listServicesAt(clientset, namespace, selector, serviceType, selectorFilter)
 			if err != nil {
-				return fmt.Errorf("failed to create clientset: %v", err)
+				return apiFailure(err, "failed to list services: %v", err)
 			}
+			sortServices(services, sortBy)
 
-			// List services
-			services, err := listServices(clientset, namespace)
-			if err != nil {
-				return fmt.Errorf("failed to connect to Kubernetes cluster: %v\n\nMake sure your cluster is running and accessible. Check your kubeconfig with: kubectl cluster-info", err)
+			if !watchChanges {
+				if ok, err := printFormatted(outputFormat, tmpl, services); ok {
+					return err
+				}
+				displayServices(services, namespace)
+				return nil
 			}
 
-			// Display services
-			displayServices(services, namespace)
+			// With --watch and an output format, stdout is a stream of events in that format,
+			// starting with an ADDED event for each listed service
+			emit, err := serviceEventWriter(outputFormat, tmpl)
+			if err != nil {
+				return err
+			}
+			if outputFormat == "" {
+				displayServices(services, namespace)
+			} else {
+				for _, svc := range services {
+					if err := emit(string(watch.Added), svc); err != nil {
+						return err
+					}
+				}
+			}
 
-			return nil
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			watched := serviceWatch{namespace: namespace, selector: selector, serviceType: serviceType, selectorFilter: selectorFilter, emit: emit, statusToStderr: outputFormat != ""}
+			return watched.run(ctx, clientset, services, resourceVersion)
 		},
 	}
 
-	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file (defaults to KUBECONFIG env var or ~/.kube/config)")
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "Namespace to list services from")
+	cmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "k", "", "Path to kubeconfig file, or comma-separated files to merge (defaults to KUBECONFIG env var or ~/.kube/config)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace to list services from (defaults to the profile's namespace, then default)")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Only list services whose own labels match this selector, e.g. app=web")
+	cmd.Flags().StringVar(&serviceType, "type", "", "Only list services of this type: ClusterIP, NodePort, LoadBalancer or ExternalName")
+	cmd.Flags().BoolVar(&withSelector, "with-selector", false, "Only list services with a pod selector, which can be port-forwarded to")
+	cmd.Flags().BoolVar(&noSelector, "no-selector", false, "Only list services without a pod selector (ExternalName, headless or with manually managed endpoints)")
+	cmd.Flags().StringVar(&sortBy, "sort", "", "Sort services by name, type or port (the first port's number); default is the API's order")
+	cmd.Flags().BoolVarP(&watchChanges, "watch", "w", false, "After listing, watch for service changes until interrupted")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the service list with -o template, or to each event (.Type and .Service) with --watch")
+
+	cmd.RegisterFlagCompletionFunc("namespace", completeNamespaces)
 
 	return cmd
 }
 
-// listServices lists all services in a namespace
-func listServices(clientset *kubernetes.Clientset, namespace string) ([]ServiceInfo, error) {
-	services, err := clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{})
+// listServices lists all services in a namespace, optionally filtered by a label selector,
+// by service type if serviceType is not empty, and by whether they have a pod selector
+// if selectorFilter is "with" or "without"
+func listServices(clientset kubernetes.Interface, namespace, selector, serviceType, selectorFilter string) ([]ServiceInfo, error) {
+	serviceList, _, err := listServicesAt(clientset, namespace, selector, serviceType, selectorFilter)
+	return serviceList, err
+}
+
+// listServicesAt is listServices that also returns the resourceVersion of the list,
+// from which services --watch picks up changes
+func listServicesAt(clientset kubernetes.Interface, namespace, selector, serviceType, selectorFilter string) ([]ServiceInfo, string, error) {
+	services, err := clientset.CoreV1().Services(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	var serviceList []ServiceInfo
+	serviceList := []ServiceInfo{}
 	for _, svc := range services.Items {
-		var ports []string
-		for _, port := range svc.Spec.Ports {
-			portStr := fmt.Sprintf("%d/%s", port.Port, port.Protocol)
-			if port.NodePort > 0 {
-				portStr += fmt.Sprintf(" (NodePort: %d)", port.NodePort)
+		if serviceType != "" && string(svc.Spec.Type) != serviceType {
+			continue
+		}
+		if !matchesSelectorFilter(svc.Spec.Selector, selectorFilter) {
+			continue
+		}
+
+		serviceList = append(serviceList, newServiceInfo(&svc))
+	}
+
+	return serviceList, services.ResourceVersion, nil
+}
+
+// newServiceInfo summarizes a service for display
+func newServiceInfo(svc *corev1.Service) ServiceInfo {
+	var ports []string
+	for _, port := range svc.Spec.Ports {
+		portStr := fmt.Sprintf("%d/%s", port.Port, port.Protocol)
+		if port.NodePort > 0 {
+			portStr += fmt.Sprintf(" (NodePort: %d)", port.NodePort)
+		}
+		ports = append(ports, portStr)
+	}
+
+	return ServiceInfo{
+		Name:      svc.Name,
+		Namespace: svc.Namespace,
+		Type:      string(svc.Spec.Type),
+		Ports:     ports,
+		Selector:  formatSelector(svc.Spec.Selector),
+
+		resourceVersion: svc.ResourceVersion,
+	}
+}
+
+// sortServices orders services by name, type or first port number, breaking ties by name.
+// Services without ports sort after those with ports. An empty key keeps the API's order.
+func sortServices(services []ServiceInfo, by string) {
+	var less func(a, b ServiceInfo) bool
+	switch by {
+	case "name":
+		less = func(a, b ServiceInfo) bool { return a.Name < b.Name }
+	case "type":
+		less = func(a, b ServiceInfo) bool {
+			if a.Type != b.Type {
+				return a.Type < b.Type
 			}
-			ports = append(ports, portStr)
+			return a.Name < b.Name
 		}
+	case "port":
+		less = func(a, b ServiceInfo) bool {
+			pa, pb := firstPortNumber(a), firstPortNumber(b)
+			if pa != pb {
+				return pa < pb
+			}
+			return a.Name < b.Name
+		}
+	default:
+		return
+	}
 
-		serviceList = append(serviceList, ServiceInfo{
-			Name:      svc.Name,
-			Namespace: svc.Namespace,
-			Type:      string(svc.Spec.Type),
-			Ports:     ports,
-			Selector:  formatSelector(svc.Spec.Selector),
-		})
+	sort.SliceStable(services, func(i, j int) bool {
+		return less(services[i], services[j])
+	})
+}
+
+// firstPortNumber returns the number of a service's first port, or math.MaxInt if it has none
+func firstPortNumber(svc ServiceInfo) int {
+	if len(svc.Ports) == 0 {
+		return math.MaxInt
+	}
+	number, _, _ := strings.Cut(svc.Ports[0], "/")
+	port, err := strconv.Atoi(number)
+	if err != nil {
+		return math.MaxInt
 	}
+	return port
+}
 
-	return serviceList, nil
+// normalizeServiceType validates a --type value, accepting any capitalization
+func normalizeServiceType(serviceType string) (string, error) {
+	for _, known := range []corev1.ServiceType{
+		corev1.ServiceTypeClusterIP,
+		corev1.ServiceTypeNodePort,
+		corev1.ServiceTypeLoadBalancer,
+		corev1.ServiceTypeExternalName,
+	} {
+		if strings.EqualFold(serviceType, string(known)) {
+			return string(known), nil
+		}
+	}
+	return "", usageError("invalid --type %q (must be ClusterIP, NodePort, LoadBalancer or ExternalName)", serviceType)
 }
 
 // ServiceInfo represents service information
 type ServiceInfo struct {
-	Name      string
-	Namespace string
-	Type      string
-	Ports     []string
-	Selector  string
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Type      string   `json:"type"`
+	Ports     []string `json:"ports"`
+	Selector  string   `json:"selector"`
+
+	resourceVersion string // tells services --watch whether a service changed while its watch was down
+}
+
+// serviceEvent is one event of services --watch with an output format: a line of
+// newline-delimited JSON with -o json, or the data of the template with -o template
+type serviceEvent struct {
+	Type    string      `json:"type"`
+	Service ServiceInfo `json:"service"`
+}
+
+// serviceEventWriter returns the function services --watch writes each event with: a JSON
+// object per line with -o json, the template executed per event (ending in a newline) with
+// -o template, and an aligned text line without a format
+func serviceEventWriter(format, tmpl string) (func(eventType string, svc ServiceInfo) error, error) {
+	switch format {
+	case "":
+		return func(eventType string, svc ServiceInfo) error {
+			fmt.Fprintf(output, "  %-9s %s (%s)\n", eventType, svc.Name, svc.Type)
+			return nil
+		}, nil
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		return func(eventType string, svc ServiceInfo) error {
+			return encoder.Encode(serviceEvent{Type: eventType, Service: svc})
+		}, nil
+	case "template", "go-template":
+		if tmpl == "" {
+			return nil, fmt.Errorf("--template is required with -o %s", format)
+		}
+		t, err := template.New("output").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v", err)
+		}
+		return func(eventType string, svc ServiceInfo) error {
+			var line bytes.Buffer
+			if err := t.Execute(&line, serviceEvent{Type: eventType, Service: svc}); err != nil {
+				return fmt.Errorf("failed to execute template: %v", err)
+			}
+			if !bytes.HasSuffix(line.Bytes(), []byte("\n")) {
+				line.WriteByte('\n')
+			}
+			_, err := os.Stdout.Write(line.Bytes())
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q (must be json or template)", format)
+	}
+}
+
+// matchesSelectorFilter reports whether a service's pod selector passes a --with-selector
+// ("with") or --no-selector ("without") filter. An empty filter matches every service.
+func matchesSelectorFilter(selector map[string]string, filter string) bool {
+	switch filter {
+	case "with":
+		return len(selector) > 0
+	case "without":
+		return len(selector) == 0
+	default:
+		return true
+	}
 }
 
 // formatSelector formats the service selector as a string
@@ -127,28 +352,180 @@ func formatSelector(selector map[string]string) string {
 
 // displayServices displays services in a user-friendly format
 func displayServices(services []ServiceInfo, namespace string) {
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Printf("  Services in namespace: %s (%d total)\n", namespace, len(services))
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	fmt.Println()
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintf(output, "  Services in namespace: %s (%d total)\n", namespace, len(services))
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(output)
 
 	if len(services) == 0 {
-		fmt.Println("  No services found.")
-		fmt.Println()
+		fmt.Fprintln(output, "  No services found.")
+		fmt.Fprintln(output)
 		return
 	}
 
 	for i, svc := range services {
-		fmt.Printf("  [%d] %s\n", i+1, svc.Name)
-		fmt.Printf("      Type:     %s\n", svc.Type)
-		fmt.Printf("      Ports:     %s\n", strings.Join(svc.Ports, ", "))
-		fmt.Printf("      Selector:  %s\n", svc.Selector)
+		fmt.Fprintf(output, "  [%d] %s\n", i+1, svc.Name)
+		fmt.Fprintf(output, "      Type:     %s\n", svc.Type)
+		fmt.Fprintf(output, "      Ports:     %s\n", strings.Join(svc.Ports, ", "))
+		fmt.Fprintf(output, "      Selector:  %s\n", svc.Selector)
 		if i < len(services)-1 {
-			fmt.Println()
+			fmt.Fprintln(output)
+		}
+	}
+
+	fmt.Fprintln(output)
+	fmt.Fprintln(output, "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+}
+
+// serviceWatch is a services --watch: the services it follows and how it reports their events
+type serviceWatch struct {
+	namespace, selector, serviceType, selectorFilter string
+
+	emit           func(eventType string, svc ServiceInfo) error // see serviceEventWriter
+	statusToStderr bool                                          // keep stdout for the events of an output format
+}
+
+// matches reports whether a service passes the watch's --type and selector filters
+func (w *serviceWatch) matches(svc *corev1.Service) bool {
+	return (w.serviceType == "" || string(svc.Spec.Type) == w.serviceType) && matchesSelectorFilter(svc.Spec.Selector, w.selectorFilter)
+}
+
+// run streams service add/update/delete events until ctx is done (Ctrl+C). The first watch
+// starts at resourceVersion, the version of the listed services, so no change in between is
+// missed. When the watch expires it is re-established from the last seen resourceVersion; if
+// that version is too old, the services are listed again and the changes since the last known
+// set are reported as events, so nothing that happened while the watch was down is lost.
+func (w *serviceWatch) run(ctx context.Context, clientset kubernetes.Interface, listed []ServiceInfo, resourceVersion string) error {
+	status := output
+	if w.statusToStderr && output != io.Discard {
+		status = os.Stderr
+	}
+
+	// known holds the services that pass the filters, as last reported
+	known := make(map[string]ServiceInfo, len(listed))
+	for _, svc := range listed {
+		known[svc.Name] = svc
+	}
+
+	fmt.Fprintf(status, "  Watching services in namespace: %s (Ctrl+C to stop)\n", w.namespace)
+	fmt.Fprintln(status)
+
+	for {
+		watcher, err := clientset.CoreV1().Services(w.namespace).Watch(ctx, metav1.ListOptions{
+			LabelSelector:       w.selector,
+			ResourceVersion:     resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to watch services: %v", err)
+		}
+
+		expired := false
+		for event := range watcher.ResultChan() {
+			switch event.Type {
+			case watch.Added, watch.Modified, watch.Deleted:
+				svc, ok := event.Object.(*corev1.Service)
+				if !ok {
+					continue
+				}
+				resourceVersion = svc.ResourceVersion
+				if err := w.apply(known, string(event.Type), svc); err != nil {
+					watcher.Stop()
+					return err
+				}
+			case watch.Bookmark:
+				if svc, ok := event.Object.(*corev1.Service); ok {
+					resourceVersion = svc.ResourceVersion
+				}
+			case watch.Error:
+				statusErr := apierrors.FromObject(event.Object)
+				if apierrors.IsResourceExpired(statusErr) || apierrors.IsGone(statusErr) {
+					expired = true
+				} else {
+					fmt.Fprintf(os.Stderr, "Watch error: %v\n", statusErr)
+				}
+			}
+		}
+		watcher.Stop()
+
+		if ctx.Err() != nil {
+			fmt.Fprintln(status)
+			return nil
+		}
+
+		// Our resourceVersion is too old to resume from; start over from a fresh list
+		if expired {
+			services, version, err := listServicesAt(clientset, w.namespace, w.selector, w.serviceType, w.selectorFilter)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("failed to list services: %v", err)
+			}
+			if err := w.resync(known, services); err != nil {
+				return err
+			}
+			resourceVersion = version
+		}
+	}
+}
+
+// apply reports a watch event for svc and records it in known. A service modified so that it
+// no longer passes the filters is reported as deleted, as a fresh list would no longer show it.
+func (w *serviceWatch) apply(known map[string]ServiceInfo, eventType string, svc *corev1.Service) error {
+	info := newServiceInfo(svc)
+	if !w.matches(svc) {
+		if _, ok := known[svc.Name]; !ok {
+			return nil
 		}
+		eventType = string(watch.Deleted)
+	}
+
+	if eventType == string(watch.Deleted) {
+		delete(known, svc.Name)
+	} else {
+		known[svc.Name] = info
 	}
+	return w.emit(eventType, info)
+}
 
-	fmt.Println()
-	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+// resync reports the difference between the last known services and a fresh list as
+// events: new services as ADDED, changed ones as MODIFIED and missing ones as DELETED
+func (w *serviceWatch) resync(known map[string]ServiceInfo, services []ServiceInfo) error {
+	current := make(map[string]bool, len(services))
+	for _, svc := range services {
+		current[svc.Name] = true
+		previous, ok := known[svc.Name]
+		eventType := string(watch.Added)
+		if ok {
+			if previous.resourceVersion == svc.resourceVersion {
+				continue
+			}
+			eventType = string(watch.Modified)
+		}
+		known[svc.Name] = svc
+		if err := w.emit(eventType, svc); err != nil {
+			return err
+		}
+	}
+
+	var gone []string
+	for name := range known {
+		if !current[name] {
+			gone = append(gone, name)
+		}
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		svc := known[name]
+		delete(known, name)
+		if err := w.emit(string(watch.Deleted), svc); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// captureStdout redirects os.Stdout to a pipe until the returned function is called,
+// which returns the lines written meanwhile
+func captureStdout(t *testing.T) func() []string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	lines := make(chan []string, 1)
+	go func() {
+		var read []string
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			read = append(read, scanner.Text())
+		}
+		lines <- read
+	}()
+	return func() []string {
+		os.Stdout = stdout
+		writer.Close()
+		return <-lines
+	}
+}
+
+// testService is a service in namespace app at the given resourceVersion
+func testService(name, resourceVersion string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "app", ResourceVersion: resourceVersion},
+		Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+	}
+}
+
+// runServiceWatch runs a services --watch in namespace app whose watches are served by
+// the given functions in turn; the watch is stopped once they are used up
+func runServiceWatch(t *testing.T, clientset *fake.Clientset, format, tmpl string, watches ...func(*watch.FakeWatcher)) {
+	t.Helper()
+	previousOutput := output
+	output = io.Discard
+	defer func() { output = previousOutput }()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	clientset.PrependWatchReactor("services", func(k8stesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFakeWithChanSize(4, false)
+		if calls < len(watches) {
+			watches[calls](watcher)
+		} else {
+			// The events have been read by now; stop the watch as Ctrl+C would
+			cancel()
+		}
+		calls++
+		watcher.Stop()
+		return true, watcher, nil
+	})
+
+	listed, resourceVersion, err := listServicesAt(clientset, "app", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	emit, err := serviceEventWriter(format, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched := serviceWatch{namespace: "app", emit: emit, statusToStderr: true}
+	if err := watched.run(ctx, clientset, listed, resourceVersion); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchServicesJSONWritesOnlyEvents(t *testing.T) {
+	stdout := captureStdout(t)
+	runServiceWatch(t, fake.NewClientset(), "json", "", func(watcher *watch.FakeWatcher) {
+		watcher.Add(testService("web", "2"))
+		watcher.Delete(testService("db", "3"))
+	})
+
+	var events []serviceEvent
+	for _, line := range stdout() {
+		var event serviceEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("stdout line %q is not a JSON event: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 || events[0].Type != "ADDED" || events[0].Service.Name != "web" || events[1].Type != "DELETED" || events[1].Service.Name != "db" {
+		t.Errorf("events = %+v, want ADDED web and DELETED db", events)
+	}
+}
+
+func TestWatchServicesTemplateFormatsEveryEvent(t *testing.T) {
+	stdout := captureStdout(t)
+	runServiceWatch(t, fake.NewClientset(), "template", "{{.Type}} {{.Service.Name}}", func(watcher *watch.FakeWatcher) {
+		watcher.Add(testService("web", "2"))
+		watcher.Modify(testService("web", "3"))
+	})
+
+	if got, want := strings.Join(stdout(), "\n"), "ADDED web\nMODIFIED web"; got != want {
+		t.Errorf("stdout = %q, want only the templated events %q", got, want)
+	}
+}
+
+func TestWatchServicesReportsChangesMissedWhileExpired(t *testing.T) {
+	clientset := fake.NewClientset(testService("web", "1"), testService("db", "1"), testService("cache", "1"))
+	services := corev1.SchemeGroupVersion.WithResource("services")
+
+	stdout := captureStdout(t)
+	runServiceWatch(t, clientset, "template", "{{.Type}} {{.Service.Name}}", func(watcher *watch.FakeWatcher) {
+		// While the watch is down, web changes, db goes away and api appears
+		tracker := clientset.Tracker()
+		if err := tracker.Update(services, testService("web", "5"), "app"); err != nil {
+			t.Error(err)
+		}
+		if err := tracker.Delete(services, "app", "db"); err != nil {
+			t.Error(err)
+		}
+		if err := tracker.Add(testService("api", "6")); err != nil {
+			t.Error(err)
+		}
+		watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+	})
+
+	got := stdout()
+	sort.Strings(got)
+	if want := []string{"ADDED api", "DELETED db", "MODIFIED web"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events after the watch expired = %q, want %q (cache is unchanged)", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignal asks a running daemon to write its current state to its log
+var statusSignal os.Signal = syscall.SIGUSR1
+
+// retargetSignal makes a running daemon re-read its connection record, moving to a new
+// local port after a remap or re-resolving its pod
+var retargetSignal os.Signal = syscall.SIGHUP
+
+// drainSignal makes a running daemon stop accepting local connections and exit
+// once the open ones have closed
+var drainSignal os.Signal = syscall.SIGUSR2
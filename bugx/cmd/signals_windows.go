@@ -0,0 +1,14 @@
+//go:build windows
+
+package cmd
+
+import "os"
+
+// statusSignal is not available on Windows; status falls back to the connection record
+var statusSignal os.Signal
+
+// retargetSignal is not available on Windows, so connections cannot be remapped
+var retargetSignal os.Signal
+
+// drainSignal is not available on Windows, so disconnect cannot drain connections
+var drainSignal os.Signal
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// tunnelSpec is the tunnel schema shared by connect --from-file files and the tunnels of a
+// bugx up project file, so the same fields mean the same thing in both
+type tunnelSpec struct {
+	Service    string            `json:"service"`
+	Namespace  string            `json:"namespace,omitempty"`
+	LocalPort  string            `json:"localPort,omitempty"`
+	RemotePort string            `json:"remotePort,omitempty"`
+	Address    []string          `json:"address,omitempty"`
+	Kubeconfig string            `json:"kubeconfig,omitempty"`
+	Context    string            `json:"context,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"` // recorded on the connection, for connect list --filter
+}
+
+// validate checks the fields of a tunnel definition that need more than the schema
+func (spec *tunnelSpec) validate() error {
+	if spec.Service == "" {
+		return fmt.Errorf("service is required")
+	}
+	if spec.LocalPort != "" {
+		if _, err := parseLocalPorts(spec.LocalPort); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLabels adds the definition's labels to a connection, over those taken from its pod
+func (spec *tunnelSpec) applyLabels(conn *ConnectionInfo) {
+	if len(spec.Labels) == 0 {
+		return
+	}
+	if conn.Labels == nil {
+		conn.Labels = make(map[string]string)
+	}
+	for key, value := range spec.Labels {
+		conn.Labels[key] = value
+	}
+}
+
+// connectSpec is a single tunnel definition read by connect --from-file (YAML or JSON)
+type connectSpec struct {
+	tunnelSpec
+	Alias string `json:"alias,omitempty"`
+}
+
+// loadConnectSpec reads and validates a tunnel definition file
+func loadConnectSpec(path string) (*connectSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFoundError("tunnel file %s not found", path)
+		}
+		return nil, fmt.Errorf("failed to read tunnel file: %v", err)
+	}
+
+	var spec connectSpec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, usageError("failed to parse %s: %v", path, err)
+	}
+	if err := spec.validate(); err != nil {
+		return nil, usageError("%s: %v", path, err)
+	}
+
+	return &spec, nil
+}
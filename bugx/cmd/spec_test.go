@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTunnelSchemaSharedByConnectAndUp(t *testing.T) {
+	dir := t.TempDir()
+	fields := `service: pgbouncer
+namespace: staging
+localPort: "6432"
+remotePort: sql
+address: [127.0.0.1]
+context: dev
+labels:
+  team: data
+`
+	want := tunnelSpec{
+		Service: "pgbouncer", Namespace: "staging", LocalPort: "6432", RemotePort: "sql",
+		Address: []string{"127.0.0.1"}, Context: "dev", Labels: map[string]string{"team": "data"},
+	}
+
+	specPath := filepath.Join(dir, "tunnel.yaml")
+	if err := os.WriteFile(specPath, []byte(fields+"alias: db\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	spec, err := loadConnectSpec(specPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spec.tunnelSpec, want) || spec.Alias != "db" {
+		t.Errorf("loadConnectSpec() = %+v, want %+v with alias db", *spec, want)
+	}
+
+	projectPath := filepath.Join(dir, ".bugx.yaml")
+	indented := "tunnels:\n  - name: db-proxy\n    dependsOn: []\n"
+	for _, line := range []string{"service: pgbouncer", "namespace: staging", `localPort: "6432"`, "remotePort: sql", "address: [127.0.0.1]", "context: dev", "labels:", "  team: data"} {
+		indented += "    " + line + "\n"
+	}
+	if err := os.WriteFile(projectPath, []byte(indented), 0600); err != nil {
+		t.Fatal(err)
+	}
+	project, err := loadProjectFile(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tunnel := project.Tunnels[0]; !reflect.DeepEqual(tunnel.tunnelSpec, want) || tunnel.Name != "db-proxy" {
+		t.Errorf("loadProjectFile() tunnel = %+v, want %+v named db-proxy", tunnel, want)
+	}
+
+	// Both reject the same invalid local port
+	if err := os.WriteFile(specPath, []byte("service: web\nlocalPort: \"99999\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConnectSpec(specPath); err == nil {
+		t.Error("loadConnectSpec() accepted local port 99999")
+	}
+	if err := os.WriteFile(projectPath, []byte("tunnels:\n  - service: web\n    localPort: \"99999\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProjectFile(projectPath); err == nil {
+		t.Error("loadProjectFile() accepted local port 99999")
+	}
+}
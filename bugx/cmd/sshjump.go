@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// sshJump is the global --ssh-jump flag: a user@host bastion through which the API server
+// is reached with an SSH local port-forward. Empty connects directly.
+var sshJump string
+
+// sshJumpReadyTimeout bounds how long ssh may take to open its local port
+const sshJumpReadyTimeout = 15 * time.Second
+
+// sshJumps are the running ssh processes, keyed by the API server address they forward to,
+// so clients rebuilt for the same cluster share one. A process reaches one cluster through
+// one bastion, so the bastion is not part of the key.
+var (
+	sshJumps      = make(map[string]*sshJumpTunnel)
+	sshJumpsMutex sync.Mutex
+
+	// sshJumpServers maps a rewritten config host back to the API server it reaches
+	sshJumpServers = make(map[string]string)
+)
+
+// sshJumpTunnel is an ssh process forwarding a local port to the API server
+type sshJumpTunnel struct {
+	cmd       *exec.Cmd
+	localAddr string
+	done      chan struct{} // closed when ssh exits
+}
+
+// exited reports whether the tunnel's ssh process has ended
+func (t *sshJumpTunnel) exited() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// withSSHJump returns a copy of config that reaches the API server through an ssh local
+// port-forward via the jump bastion, starting ssh if no tunnel to that server is running yet.
+// The certificate is still verified against the original host name.
+func withSSHJump(config *rest.Config, jump string) (*rest.Config, error) {
+	host := config.Host
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server host %q: %v", config.Host, err)
+	}
+	target := hostURL.Host
+	if hostURL.Port() == "" {
+		port := "443"
+		if hostURL.Scheme == "http" {
+			port = "80"
+		}
+		target = net.JoinHostPort(hostURL.Hostname(), port)
+	}
+
+	sshJumpsMutex.Lock()
+	defer sshJumpsMutex.Unlock()
+
+	// A tunnel whose ssh died (e.g. the bastion dropped it) is replaced when a daemon
+	// rebuilds its clients to reconnect
+	tunnel, ok := sshJumps[target]
+	if !ok || tunnel.exited() {
+		if tunnel, err = startSSHJump(jump, target); err != nil {
+			return nil, err
+		}
+		sshJumps[target] = tunnel
+	}
+
+	config = rest.CopyConfig(config)
+	if config.TLSClientConfig.ServerName == "" && !config.TLSClientConfig.Insecure {
+		config.TLSClientConfig.ServerName = hostURL.Hostname()
+	}
+	server := config.Host
+	hostURL.Host = tunnel.localAddr
+	config.Host = hostURL.String()
+	sshJumpServers[config.Host] = server
+	return config, nil
+}
+
+// apiServer returns the API server a config reaches, seeing through an --ssh-jump tunnel,
+// so connections record the cluster's address rather than a loopback port
+func apiServer(config *rest.Config) string {
+	sshJumpsMutex.Lock()
+	defer sshJumpsMutex.Unlock()
+
+	if server, ok := sshJumpServers[config.Host]; ok {
+		return server
+	}
+	return config.Host
+}
+
+// startSSHJump runs ssh to forward a free loopback port to target through jump, and waits
+// until the port accepts connections. ssh runs in batch mode, so keys must be loaded in an
+// agent or configured in ~/.ssh/config; it reads the user's ssh configuration as usual.
+func startSSHJump(jump, target string) (*sshJumpTunnel, error) {
+	// Checked here too, since restore reads the bastion back from the connections file
+	if err := validateSSHJump(jump); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick a local port for --ssh-jump: %v", err)
+	}
+	localAddr := listener.Addr().String()
+	listener.Close()
+	_, localPort, _ := net.SplitHostPort(localAddr)
+
+	cmd := exec.Command("ssh", "-N",
+		"-o", "BatchMode=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-L", "127.0.0.1:"+localPort+":"+target,
+		"--", jump,
+	)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run ssh for --ssh-jump: %v", err)
+	}
+
+	exited := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		exited <- cmd.Wait()
+		close(done)
+	}()
+
+	deadline := timeSource.Now().Add(sshJumpReadyTimeout)
+	for !probeTCP(localAddr, statusProbeTimeout) {
+		select {
+		case err := <-exited:
+			return nil, unreachableError("ssh to %s exited before forwarding to %s: %v", jump, target, err)
+		case <-timeSource.After(200 * time.Millisecond):
+		}
+		if timeSource.Now().After(deadline) {
+			cmd.Process.Kill()
+			return nil, unreachableError("ssh to %s did not forward to %s within %s", jump, target, sshJumpReadyTimeout)
+		}
+	}
+
+	fmt.Fprintf(output, "Reaching API server %s through ssh %s (local port %s)\n", target, jump, localPort)
+	return &sshJumpTunnel{cmd: cmd, localAddr: localAddr, done: done}, nil
+}
+
+// validateSSHJump rejects an --ssh-jump value ssh would take as an option, such as
+// -oProxyCommand=..., which would run an arbitrary command
+func validateSSHJump(jump string) error {
+	if strings.HasPrefix(jump, "-") {
+		return usageError("invalid --ssh-jump %q: expected [user@]host", jump)
+	}
+	return nil
+}
+
+// closeSSHJumps stops the ssh processes started for --ssh-jump
+func closeSSHJumps() {
+	sshJumpsMutex.Lock()
+	defer sshJumpsMutex.Unlock()
+
+	for target, tunnel := range sshJumps {
+		tunnel.cmd.Process.Kill()
+		delete(sshJumps, target)
+	}
+}
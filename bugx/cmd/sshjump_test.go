@@ -0,0 +1,24 @@
+package cmd
+
+import "testing"
+
+func TestValidateSSHJump(t *testing.T) {
+	for _, jump := range []string{"", "bastion", "ops@bastion.example.com", "ops@[::1]"} {
+		if err := validateSSHJump(jump); err != nil {
+			t.Errorf("validateSSHJump(%q) = %v, want nil", jump, err)
+		}
+	}
+	for _, jump := range []string{"-oProxyCommand=touch /tmp/pwned", "-F/dev/null"} {
+		err := validateSSHJump(jump)
+		if err == nil {
+			t.Errorf("validateSSHJump(%q) accepted an ssh option", jump)
+		} else if code := ExitCode(err); code != ExitUsage {
+			t.Errorf("validateSSHJump(%q) exit code = %d, want %d", jump, code, ExitUsage)
+		}
+	}
+
+	// A bastion read back from the connections file is checked before ssh runs
+	if _, err := startSSHJump("-oProxyCommand=false", "api.cluster.invalid:6443"); err == nil {
+		t.Errorf("startSSHJump ran ssh with an option as the destination")
+	}
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewStatsCmd creates the stats command
+func NewStatsCmd() *cobra.Command {
+	var (
+		outputFormat string
+		tmpl         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Summarize all recorded connections",
+		Long: `Summarize all recorded connections: how many are running, healthy or stopped,
+how often their forwards were restarted, the bytes forwarded, the uptime of
+the oldest running tunnel, and the number of connections per namespace.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			connections, err := loadConnections()
+			if err != nil {
+				return fmt.Errorf("failed to load connections: %v", err)
+			}
+
+			report := newStatsReport(connections, timeSource.Now())
+			if ok, err := printFormatted(outputFormat, tmpl, report); ok {
+				return err
+			}
+
+			displayStats(report)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the summary with -o template")
+
+	return cmd
+}
+
+// statsReport aggregates the connection records
+type statsReport struct {
+	Connections         int            `json:"connections"`
+	Running             int            `json:"running"`
+	Unhealthy           int            `json:"unhealthy"`
+	Stopped             int            `json:"stopped"`
+	Restarts            int            `json:"restarts"`
+	BytesIn             int64          `json:"bytesIn"`
+	BytesOut            int64          `json:"bytesOut"`
+	OldestUptimeSeconds int64          `json:"oldestUptimeSeconds"`
+	Oldest              string         `json:"oldest,omitempty"` // namespace/service of the longest-running tunnel
+	Namespaces          map[string]int `json:"namespaces"`
+}
+
+// newStatsReport aggregates connections as of now
+func newStatsReport(connections []ConnectionInfo, now time.Time) statsReport {
+	report := statsReport{
+		Connections: len(connections),
+		Namespaces:  make(map[string]int),
+	}
+
+	var oldest time.Time
+	for _, conn := range connections {
+		report.Namespaces[conn.Namespace]++
+		report.Restarts += conn.Restarts
+		report.BytesIn += conn.BytesIn
+		report.BytesOut += conn.BytesOut
+
+		if !isProcessRunning(conn.PID) {
+			report.Stopped++
+			continue
+		}
+		report.Running++
+		if conn.Status == "unhealthy" {
+			report.Unhealthy++
+		}
+		if !conn.StartedAt.IsZero() && (oldest.IsZero() || conn.StartedAt.Before(oldest)) {
+			oldest = conn.StartedAt
+			report.Oldest = conn.Namespace + "/" + conn.ServiceName
+		}
+	}
+	if !oldest.IsZero() {
+		report.OldestUptimeSeconds = int64(now.Sub(oldest).Seconds())
+	}
+
+	return report
+}
+
+// displayStats prints a stats report
+func displayStats(report statsReport) {
+	fmt.Fprintf(output, "Connections:  %d (%d running, %d unhealthy, %d stopped)\n", report.Connections, report.Running, report.Unhealthy, report.Stopped)
+	fmt.Fprintf(output, "Restarts:     %d\n", report.Restarts)
+	fmt.Fprintf(output, "Forwarded:    %s in, %s out\n", formatBytes(report.BytesIn), formatBytes(report.BytesOut))
+	if report.Oldest != "" {
+		fmt.Fprintf(output, "Oldest:       %s (up %s)\n", report.Oldest, time.Duration(report.OldestUptimeSeconds)*time.Second)
+	}
+
+	if len(report.Namespaces) == 0 {
+		return
+	}
+	namespaces := make([]string, 0, len(report.Namespaces))
+	for namespace := range report.Namespaces {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	fmt.Fprintln(output, "Namespaces:")
+	for _, namespace := range namespaces {
+		fmt.Fprintf(output, "  %-20s %d\n", namespace, report.Namespaces[namespace])
+	}
+}
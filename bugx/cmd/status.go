@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// NewStatusCmd creates the status command
+func NewStatusCmd() *cobra.Command {
+	var (
+		namespace    string
+		outputFormat string
+		tmpl         string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "status [servicename|alias]",
+		Short: "Show the state of a background connection",
+		Long: `Show the state of a background connection.
+
+The stored connection record is printed, and if the daemon is running it is
+asked to write its live state (pod, restarts, bytes transferred, uptime) to
+its log, which is printed as well.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			namespace = resolveNamespace(namespace)
+
+			conn, err := findConnection(kubeContextFlag, name, namespace)
+			var exitErr *exitError
+			if errors.As(err, &exitErr) {
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("connection not found: %s/%s", namespace, name)
+			}
+
+			running := isProcessRunning(conn.PID)
+
+			if ok, err := printFormatted(outputFormat, tmpl, newStatusReport(conn, running)); ok {
+				return err
+			}
+
+			displayStatus(conn, running)
+
+			if !running || statusSignal == nil || conn.LogFile == "" {
+				return nil
+			}
+
+			dump, err := requestStatusDump(conn)
+			if err != nil {
+				return fmt.Errorf("failed to query daemon: %v", err)
+			}
+			if dump != "" {
+				fmt.Fprintln(output)
+				fmt.Fprint(output, dump)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of the service (defaults to the profile's namespace, then default)")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", "", "Output format: json or template")
+	cmd.Flags().StringVar(&tmpl, "template", "", "Go template applied to the status with -o template")
+
+	cmd.ValidArgsFunction = completeConnectionNames
+
+	return cmd
+}
+
+// statusReport is the machine-readable health of a connection
+type statusReport struct {
+	Service       string     `json:"service"`
+	Namespace     string     `json:"namespace"`
+	PID           int        `json:"pid"`
+	LocalPort     string     `json:"localPort"`
+	Running       bool       `json:"running"`
+	TCPReachable  bool       `json:"tcpReachable"`
+	UptimeSeconds int64      `json:"uptimeSeconds"`
+	LastHealthy   *time.Time `json:"lastHealthy"`
+}
+
+// statusProbeTimeout bounds the TCP reachability probe so status returns promptly for broken tunnels
+const statusProbeTimeout = time.Second
+
+// newStatusReport builds the status report for a connection, probing its local port
+func newStatusReport(conn *ConnectionInfo, running bool) statusReport {
+	report := statusReport{
+		Service:   conn.ServiceName,
+		Namespace: conn.Namespace,
+		PID:       conn.PID,
+		LocalPort: conn.LocalPort,
+		Running:   running,
+	}
+
+	if running {
+		report.TCPReachable = probeTCP(localEndpoint(conn.Addresses(), conn.LocalPort), statusProbeTimeout)
+		if !conn.StartedAt.IsZero() {
+			report.UptimeSeconds = int64(timeSince(conn.StartedAt).Seconds())
+		}
+	}
+	if !conn.LastHealthy.IsZero() {
+		lastHealthy := conn.LastHealthy
+		report.LastHealthy = &lastHealthy
+	}
+
+	return report
+}
+
+// probeTCP reports whether a TCP connection to address can be opened within timeout
+func probeTCP(address string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// displayStatus prints the stored record of a connection
+func displayStatus(conn *ConnectionInfo, running bool) {
+	status := conn.Status
+	if !running {
+		status = "stopped"
+	}
+
+	fmt.Fprintf(output, "%s/%s\n", conn.Namespace, conn.ServiceName)
+	if conn.Alias != "" {
+		fmt.Fprintf(output, "  Alias:    %s\n", conn.Alias)
+	}
+	if conn.Context != "" {
+		fmt.Fprintf(output, "  Context:  %s\n", conn.Context)
+	}
+	if conn.Cluster != "" {
+		fmt.Fprintf(output, "  Cluster:  %s\n", conn.Cluster)
+	}
+	if conn.Server != "" {
+		fmt.Fprintf(output, "  Server:   %s\n", conn.Server)
+	}
+	fmt.Fprintf(output, "  Pod:      %s\n", conn.podRef())
+	fmt.Fprintf(output, "  Local:    %s\n", localEndpoint(conn.Addresses(), conn.LocalPort))
+	for _, mirror := range conn.Mirrors {
+		fmt.Fprintf(output, "  Mirror:   %s -> %s\n", localEndpoint(conn.Addresses(), mirror.LocalPort), mirror.PodName)
+	}
+	fmt.Fprintf(output, "  Remote:   %d\n", conn.RemotePort)
+	fmt.Fprintf(output, "  PID:      %d\n", conn.PID)
+	fmt.Fprintf(output, "  Status:   %s\n", status)
+	if !conn.StartedAt.IsZero() {
+		fmt.Fprintf(output, "  Started:  %s (%s ago)\n", conn.StartedAt.Format(time.RFC3339), timeSince(conn.StartedAt).Round(time.Second))
+	}
+	if !conn.ExpiresAt.IsZero() {
+		fmt.Fprintf(output, "  Expires:  %s (%s)\n", conn.ExpiresAt.Format(time.RFC3339), conn.ttlRemaining())
+	}
+	if !conn.LastHealthy.IsZero() {
+		fmt.Fprintf(output, "  Healthy:  %s\n", conn.LastHealthy.Format(time.RFC3339))
+	}
+	if conn.HealthCmd != "" {
+		fmt.Fprintf(output, "  Health:   %s\n", healthSummary(*conn))
+	}
+	fmt.Fprintf(output, "  In:       %s\n", formatBytes(conn.BytesIn))
+	fmt.Fprintf(output, "  Out:      %s\n", formatBytes(conn.BytesOut))
+	if conn.LogFile != "" {
+		fmt.Fprintf(output, "  Log:      %s\n", conn.LogFile)
+	}
+}
+
+// requestStatusDump signals the daemon to write its state and returns what it appended to its log
+func requestStatusDump(conn *ConnectionInfo) (string, error) {
+	info, err := os.Stat(conn.LogFile)
+	if err != nil {
+		return "", err
+	}
+	offset := info.Size()
+
+	process, err := os.FindProcess(conn.PID)
+	if err != nil {
+		return "", err
+	}
+	if err := process.Signal(statusSignal); err != nil {
+		return "", err
+	}
+
+	// Give the daemon a moment to write
+	deadline := timeSource.Now().Add(2 * time.Second)
+	for timeSource.Now().Before(deadline) {
+		<-timeSource.After(100 * time.Millisecond)
+		dump, err := readFileFrom(conn.LogFile, offset)
+		if err != nil {
+			return "", err
+		}
+		if strings.Contains(dump, "Uptime:") {
+			return dump, nil
+		}
+	}
+
+	return "", fmt.Errorf("daemon did not respond within 2s")
+}
+
+// readFileFrom returns the contents of path starting at offset
+func readFileFrom(path string, offset int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
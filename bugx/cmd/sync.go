@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"bugxcli/bugx/config"
+)
+
+// resolveAPIURLSource returns the API URL connections are synced to and where it came from:
+// the active profile, else the config file
+func resolveAPIURLSource() (string, string) {
+	if activeProfile != nil && activeProfile.APIURL != "" {
+		return activeProfile.APIURL, profileSource()
+	}
+	if apiURL, err := config.NewConfig().LoadAPIURL(); err == nil && apiURL != "" {
+		return apiURL, sourceConfigFile
+	}
+	return "", sourceNone
+}
+
+// syncConnection posts a connection to <api_url>/connections so a team dashboard can show it.
+// It silently does nothing when no API URL or token is configured.
+func syncConnection(conn ConnectionInfo) error {
+	cfg := config.NewConfig()
+
+	apiURL, _ := resolveAPIURLSource()
+	if apiURL == "" {
+		return nil
+	}
+
+	token, err := cfg.LoadToken()
+	if err != nil || strings.TrimSpace(token) == "" {
+		return nil
+	}
+
+	// The kubeconfig path is local to this machine and never leaves it
+	conn.Kubeconfig = ""
+
+	body, err := json.Marshal(conn)
+	if err != nil {
+		return fmt.Errorf("failed to marshal connection: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(apiURL, "/")+"/connections", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create sync request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(token))
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to sync connection: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to sync connection: server returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"bugxcli/bugx/config"
+)
+
+// timings holds the intervals in effect; loadTimings replaces the defaults with configured values
+var timings = config.DefaultTimings()
+
+// loadTimings loads the configured timings and applies the ready timeout to a
+// --ready-timeout flag that was not given on the command line
+func loadTimings(cmd *cobra.Command) {
+	loaded, err := config.NewConfig().LoadTimings()
+	if err != nil && !isUnwritable(err) {
+		warnf("%v", err)
+	}
+	timings = loaded
+
+	if flag := cmd.Flags().Lookup("ready-timeout"); flag != nil && !flag.Changed {
+		flag.Value.Set(timings.ReadyTimeout.String())
+	}
+}
+
+// loadStoreFormat loads the format the connections file is written in
+func loadStoreFormat() {
+	storeFormat = config.NewConfig().LoadStoreFormat()
+}
@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// projectFileName is the project file bugx up reads by default
+const projectFileName = ".bugx.yaml"
+
+// projectFileNameJSON is read by default instead when only it exists; YAML parsing accepts JSON
+const projectFileNameJSON = ".bugx.json"
+
+// projectConfig is the schema of a .bugx.yaml project file
+type projectConfig struct {
+	Tunnels []projectTunnel `json:"tunnels"`
+}
+
+// projectTunnel declares one tunnel in a project file
+type projectTunnel struct {
+	tunnelSpec
+	Name string `json:"name,omitempty"` // defaults to the service name
+
+	// DependsOn names tunnels that must be healthy before this one is started
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// Priority orders tunnels that do not depend on each other; lower starts first
+	Priority int `json:"priority,omitempty"`
+}
+
+// NewUpCmd creates the up command
+func NewUpCmd() *cobra.Command {
+	var (
+		file          string
+		readyTimeout  time.Duration
+		healthTimeout time.Duration
+		dryRun        bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Start the tunnels declared in a project file",
+		Long: `Start every tunnel declared in a project file (.bugx.yaml by default) as a
+background connection.
+
+Tunnels start in dependency order: a tunnel listing others in dependsOn is
+only started once each of them accepts TCP connections on its local port.
+Independent tunnels start in priority order (lower first), then file order.
+Tunnels that already have a running connection are left alone.
+
+With --dry-run the project file is validated and every tunnel is resolved
+against the cluster (service, pod and ports), without starting anything.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !cmd.Flags().Changed("file") {
+				if _, err := os.Stat(projectFileName); os.IsNotExist(err) {
+					if _, err := os.Stat(projectFileNameJSON); err == nil {
+						file = projectFileNameJSON
+					}
+				}
+			}
+			project, err := loadProjectFile(file)
+			if err != nil {
+				return err
+			}
+
+			ordered, err := orderTunnels(project.Tunnels)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				return validateProject(ordered)
+			}
+
+			endpoints := make(map[string]string)
+			failed := make(map[string]bool)
+			for _, tunnel := range ordered {
+				if dep := firstFailedDependency(tunnel, failed, endpoints, healthTimeout); dep != "" {
+					fmt.Fprintf(os.Stderr, "  Skipped  %s: dependency %s is not healthy\n", tunnel.Name, dep)
+					failed[tunnel.Name] = true
+					continue
+				}
+
+				endpoint, err := startProjectTunnel(tunnel, readyTimeout)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "  Failed   %s: %v\n", tunnel.Name, err)
+					failed[tunnel.Name] = true
+					continue
+				}
+				endpoints[tunnel.Name] = endpoint
+			}
+
+			if len(failed) > 0 {
+				return fmt.Errorf("%d of %d tunnel(s) could not be started", len(failed), len(ordered))
+			}
+			fmt.Fprintf(output, "All %d tunnel(s) up.\n", len(ordered))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", projectFileName, "Project file declaring the tunnels, in YAML or JSON (.bugx.json is read when there is no .bugx.yaml)")
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", 10*time.Second, "How long to wait for each forward to become ready")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the project file and resolve every tunnel without starting any")
+	cmd.Flags().DurationVar(&healthTimeout, "health-timeout", 30*time.Second, "How long to wait for a dependency to accept TCP connections")
+
+	return cmd
+}
+
+// loadProjectFile reads and validates a project file
+func loadProjectFile(path string) (*projectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("project file %s not found", path)
+		}
+		return nil, fmt.Errorf("failed to read project file: %v", err)
+	}
+
+	var project projectConfig
+	if err := yaml.UnmarshalStrict(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(project.Tunnels) == 0 {
+		return nil, fmt.Errorf("%s declares no tunnels", path)
+	}
+
+	names := make(map[string]bool)
+	for i := range project.Tunnels {
+		tunnel := &project.Tunnels[i]
+		if err := tunnel.validate(); err != nil {
+			return nil, fmt.Errorf("%s: tunnel %d: %v", path, i+1, err)
+		}
+		if tunnel.Name == "" {
+			tunnel.Name = tunnel.Service
+		}
+		if names[tunnel.Name] {
+			return nil, fmt.Errorf("%s: duplicate tunnel name %q", path, tunnel.Name)
+		}
+		names[tunnel.Name] = true
+	}
+
+	return &project, nil
+}
+
+// orderTunnels sorts tunnels so every tunnel comes after its dependencies.
+// Among tunnels whose dependencies are satisfied, lower priority comes first, then file order.
+func orderTunnels(tunnels []projectTunnel) ([]projectTunnel, error) {
+	index := make(map[string]int)
+	for i, tunnel := range tunnels {
+		index[tunnel.Name] = i
+	}
+	for _, tunnel := range tunnels {
+		for _, dep := range tunnel.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("tunnel %s depends on unknown tunnel %q", tunnel.Name, dep)
+			}
+		}
+	}
+
+	var ordered []projectTunnel
+	done := make(map[string]bool)
+	for len(ordered) < len(tunnels) {
+		var available []int
+		for i, tunnel := range tunnels {
+			if done[tunnel.Name] {
+				continue
+			}
+			satisfied := true
+			for _, dep := range tunnel.DependsOn {
+				if !done[dep] {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				available = append(available, i)
+			}
+		}
+
+		if len(available) == 0 {
+			var pending []string
+			for _, tunnel := range tunnels {
+				if !done[tunnel.Name] {
+					pending = append(pending, tunnel.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between tunnels: %s", strings.Join(pending, ", "))
+		}
+
+		sort.SliceStable(available, func(a, b int) bool {
+			return tunnels[available[a]].Priority < tunnels[available[b]].Priority
+		})
+		next := tunnels[available[0]]
+		ordered = append(ordered, next)
+		done[next.Name] = true
+	}
+
+	return ordered, nil
+}
+
+// validateProject resolves every tunnel without starting any, reporting services used twice,
+// local ports claimed twice or already in use, and tunnels that cannot be resolved
+func validateProject(tunnels []projectTunnel) error {
+	problems := 0
+	services := make(map[string]string) // namespace/service -> tunnel name
+	ports := make(map[string]string)    // address:port -> tunnel name
+
+	for _, tunnel := range tunnels {
+		var issues []string
+
+		key := resolveNamespace(tunnel.Namespace) + "/" + tunnel.Service
+		if other, ok := services[key]; ok {
+			issues = append(issues, fmt.Sprintf("service %s is also used by tunnel %s", key, other))
+		} else {
+			services[key] = tunnel.Name
+		}
+
+		running := runningProjectTunnel(tunnel)
+		var conn ConnectionInfo
+		if running != nil {
+			conn = *running
+		} else if resolved, err := resolveProjectTunnel(tunnel); err != nil {
+			issues = append(issues, err.Error())
+		} else {
+			conn = resolved
+		}
+
+		if conn.LocalPort != "" {
+			for _, address := range conn.Addresses() {
+				endpoint := net.JoinHostPort(address, conn.LocalPort)
+				if other, ok := ports[endpoint]; ok {
+					issues = append(issues, fmt.Sprintf("local port %s is also used by tunnel %s", endpoint, other))
+					break
+				}
+				ports[endpoint] = tunnel.Name
+			}
+			if running == nil && !portAvailable(conn.LocalPort, conn.Addresses()) {
+				issues = append(issues, fmt.Sprintf("local port %s is already in use", conn.LocalPort))
+			}
+		}
+
+		for _, issue := range issues {
+			fmt.Fprintf(os.Stderr, "  Problem  %s: %s\n", tunnel.Name, issue)
+		}
+		problems += len(issues)
+		if len(issues) > 0 {
+			continue
+		}
+		if running != nil {
+			fmt.Fprintf(output, "  Running  %s on %s\n", tunnel.Name, localEndpoint(conn.Addresses(), conn.LocalPort))
+		} else {
+			fmt.Fprintf(output, "  OK       %s: %s -> pod %s, %s -> %d\n", tunnel.Name, key, conn.PodName, localEndpoint(conn.Addresses(), conn.LocalPort), conn.RemotePort)
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d problem(s) found; nothing was started", problems)
+	}
+	fmt.Fprintf(output, "All %d tunnel(s) valid; nothing was started.\n", len(tunnels))
+	return nil
+}
+
+// firstFailedDependency waits for each dependency of tunnel to accept TCP connections
+// and returns the name of the first one that failed or did not become healthy
+func firstFailedDependency(tunnel projectTunnel, failed map[string]bool, endpoints map[string]string, timeout time.Duration) string {
+	for _, dep := range tunnel.DependsOn {
+		if failed[dep] {
+			return dep
+		}
+		if !waitForTCP(endpoints[dep], timeout) {
+			return dep
+		}
+	}
+	return ""
+}
+
+// waitForTCP polls address until it accepts a TCP connection or timeout elapses
+func waitForTCP(address string, timeout time.Duration) bool {
+	deadline := timeSource.Now().Add(timeout)
+	for {
+		if probeTCP(address, statusProbeTimeout) {
+			return true
+		}
+		if timeSource.Now().After(deadline) {
+			return false
+		}
+		<-timeSource.After(500 * time.Millisecond)
+	}
+}
+
+// runningProjectTunnel returns the running connection of a project tunnel, if there is one
+func runningProjectTunnel(tunnel projectTunnel) *ConnectionInfo {
+	namespace := resolveNamespace(tunnel.Namespace)
+	if existing, _ := findConnection(projectTunnelContext(tunnel), tunnel.Service, namespace); existing != nil && existing.ServiceName == tunnel.Service && isProcessRunning(existing.PID) {
+		return existing
+	}
+	return nil
+}
+
+// projectTunnelContext returns the kubeconfig context a project tunnel runs in: its own,
+// else the global --context, else the kubeconfig's current context
+func projectTunnelContext(tunnel projectTunnel) string {
+	if tunnel.Context != "" {
+		return tunnel.Context
+	}
+	if kubeContextFlag != "" {
+		return kubeContextFlag
+	}
+	return currentContext(getKubeconfigPath(tunnel.Kubeconfig))
+}
+
+// startProjectTunnel starts a background connection for a project tunnel and returns its local endpoint.
+// A tunnel whose connection is already running is not restarted.
+func startProjectTunnel(tunnel projectTunnel, readyTimeout time.Duration) (string, error) {
+	if existing := runningProjectTunnel(tunnel); existing != nil {
+		endpoint := localEndpoint(existing.Addresses(), existing.LocalPort)
+		fmt.Fprintf(output, "  Running  %s on %s\n", tunnel.Name, endpoint)
+		return endpoint, nil
+	}
+
+	conn, err := resolveProjectTunnel(tunnel)
+	if err != nil {
+		return "", err
+	}
+
+	// Replace a dead entry rather than recording the service twice
+	if err := removeConnection(conn.Context, conn.ServiceName, conn.Namespace); err != nil {
+		return "", fmt.Errorf("failed to remove stale entry: %v", err)
+	}
+
+	if err := createBackgroundPortForward(conn, backgroundOptions{
+		sinceLog:     5,
+		hook:         &execHook{},
+		readyTimeout: readyTimeout,
+		noBanner:     true,
+	}); err != nil {
+		return "", err
+	}
+
+	endpoint := localEndpoint(conn.Addresses(), conn.LocalPort)
+	fmt.Fprintf(output, "  Started  %s on %s (pod %s)\n", tunnel.Name, endpoint, conn.PodName)
+	return endpoint, nil
+}
+
+// resolveProjectTunnel looks up a project tunnel's service, pod and ports in the cluster
+// and returns the connection that would be started for it
+func resolveProjectTunnel(tunnel projectTunnel) (ConnectionInfo, error) {
+	namespace := resolveNamespace(tunnel.Namespace)
+
+	kubeconfigPath := getKubeconfigPath(tunnel.Kubeconfig)
+	if kubeconfigPath == "" {
+		return ConnectionInfo{}, fmt.Errorf("kubeconfig not found")
+	}
+	kubeContext := projectTunnelContext(tunnel)
+
+	config, clientset, err := getClients(kubeconfigPath, kubeContext)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	resolved, err := ResolveService(clientset, namespace, tunnel.Service)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	svc := resolved.Service
+	remotePort, err := resolveRemotePort(svc, tunnel.RemotePort)
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	selection, err := resolved.SelectPod(clientset, PodSelectOptions{})
+	if err != nil {
+		return ConnectionInfo{}, err
+	}
+	pod := selection.Pod
+	servicePort := remotePort
+	if remotePort, err = resolvePodPort(svc, pod, tunnel.RemotePort, remotePort); err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	localPort := tunnel.LocalPort
+	if localPort == "" {
+		var ok bool
+		if localPort, ok = defaultLocalPort(servicePort); !ok {
+			return ConnectionInfo{}, fmt.Errorf("tunnel %s: the default local port, service port %d + 1, is past 65535; set its localPort", tunnel.Name, servicePort)
+		}
+	}
+	if _, err := parseLocalPorts(localPort); err != nil {
+		return ConnectionInfo{}, err
+	}
+
+	conn := ConnectionInfo{
+		ServiceName:  tunnel.Service,
+		Namespace:    namespace,
+		LocalPort:    localPort,
+		RemotePort:   remotePort,
+		ServicePort:  namedTargetPort(svc, tunnel.RemotePort, servicePort),
+		PodName:      pod.Name,
+		Address:      strings.Join(tunnel.Address, ","),
+		Kubeconfig:   kubeconfigPath,
+		Context:      kubeContext,
+		Cluster:      contextCluster(kubeconfigPath, kubeContext),
+		Server:       apiServer(config),
+		Transport:    forwardTransport,
+		PingInterval: pingInterval,
+		SSHJump:      sshJump,
+	}
+	if tunnel.Name != tunnel.Service {
+		conn.Alias = tunnel.Name
+	}
+	tunnel.applyLabels(&conn)
+	return conn, nil
+}
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bugxcli/bugx/config"
+)
+
+// Version is the version of this build, set at link time:
+//
+//	go build -ldflags "-X bugxcli/bugx/cmd.Version=v1.4.0"
+var Version = "dev"
+
+// checksumsAsset is the release asset listing the SHA-256 of every other asset, as
+// "<hex digest>  <asset name>" lines (the format of sha256sum and goreleaser)
+const checksumsAsset = "checksums.txt"
+
+// updateTimeout bounds the release lookup and the download
+const updateTimeout = 5 * time.Minute
+
+// releaseInfo is the part of a GitHub releases API response bugx update reads
+type releaseInfo struct {
+	TagName string         `json:"tag_name"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+// releaseAsset is a downloadable file of a release
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// NewUpdateCmd creates the update command
+func NewUpdateCmd() *cobra.Command {
+	var (
+		checkOnly bool
+		force     bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update bugx to the latest release",
+		Long: `Check the configured release (see bugx config set-update-url) for a newer
+version, download the binary for this OS and architecture, verify it against the
+release's checksums.txt and replace the running executable with it. The previous
+executable is restored if the replacement fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := &http.Client{Timeout: updateTimeout}
+			release, err := fetchRelease(client, config.NewConfig().LoadUpdateURL())
+			if err != nil {
+				return err
+			}
+
+			newer, comparable := versionNewer(release.TagName, Version)
+			switch {
+			case !comparable && (checkOnly || !force):
+				fmt.Fprintf(output, "This is a %s build; the latest release is %s. Pass --force to install it\n", Version, release.TagName)
+				return nil
+			case !newer && (checkOnly || !force):
+				fmt.Fprintf(output, "bugx %s is up to date (latest release: %s)\n", Version, release.TagName)
+				return nil
+			case checkOnly:
+				fmt.Fprintf(output, "Update available: %s -> %s\n", Version, release.TagName)
+				return nil
+			}
+
+			name := releaseAssetName(config.GetOS(), runtime.GOARCH)
+			binary, checksums := findAsset(release, name), findAsset(release, checksumsAsset)
+			if binary == nil {
+				return notFoundError("release %s has no binary %s for this platform", release.TagName, name)
+			}
+			if checksums == nil {
+				return notFoundError("release %s has no %s; refusing to install an unverified binary", release.TagName, checksumsAsset)
+			}
+
+			sum, err := fetchChecksum(client, checksums.URL, name)
+			if err != nil {
+				return err
+			}
+
+			exe, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("failed to locate the running executable: %v", err)
+			}
+			if exe, err = filepath.EvalSymlinks(exe); err != nil {
+				return fmt.Errorf("failed to locate the running executable: %v", err)
+			}
+
+			fmt.Fprintf(output, "Downloading %s %s...\n", name, release.TagName)
+			if err := replaceExecutable(client, exe, binary.URL, sum); err != nil {
+				return err
+			}
+			fmt.Fprintf(output, "Updated bugx %s -> %s\n", Version, release.TagName)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&checkOnly, "check-only", false, "Only report whether a newer release is available")
+	cmd.Flags().BoolVar(&force, "force", false, "Install the latest release even if it is not newer, or this is a development build")
+
+	return cmd
+}
+
+// releaseAssetName is the name of the release binary for a platform, e.g. bugx_linux_amd64
+func releaseAssetName(goos, goarch string) string {
+	name := fmt.Sprintf("bugx_%s_%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// findAsset returns the release asset with the given name, or nil
+func findAsset(release *releaseInfo, name string) *releaseAsset {
+	for i := range release.Assets {
+		if release.Assets[i].Name == name {
+			return &release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// fetchRelease gets the release description at url
+func fetchRelease(client *http.Client, url string) (*releaseInfo, error) {
+	body, err := httpGet(client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var release releaseInfo
+	if err := json.NewDecoder(body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("invalid release description at %s: %v", url, err)
+	}
+	if release.TagName == "" {
+		return nil, fmt.Errorf("invalid release description at %s: no tag_name", url)
+	}
+	return &release, nil
+}
+
+// fetchChecksum reads the SHA-256 of the asset name from a checksums file
+func fetchChecksum(client *http.Client, url, name string) ([]byte, error) {
+	body, err := httpGet(client, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a * before the name
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid checksum for %s in %s", name, checksumsAsset)
+		}
+		return sum, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, unreachableError("failed to download %s: %v", checksumsAsset, err)
+	}
+	return nil, notFoundError("%s has no checksum for %s; refusing to install an unverified binary", checksumsAsset, name)
+}
+
+// httpGet gets url, failing on any status but 200 OK
+func httpGet(client *http.Client, url string) (io.ReadCloser, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, unreachableError("failed to reach %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, notFoundError("%s not found", url)
+		}
+		return nil, fmt.Errorf("failed to get %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// replaceExecutable downloads the binary at url next to exe, checks its SHA-256 against sum
+// and that it runs, then swaps it in by renames within exe's directory. The current executable
+// is kept as exe.old until the swap succeeded and moved back if it did not.
+func replaceExecutable(client *http.Client, exe, url string, sum []byte) error {
+	newPath, oldPath := exe+".new", exe+".old"
+
+	body, err := httpGet(client, url)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.OpenFile(newPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot write next to %s: %v", exe, err)
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(newPath)
+		return unreachableError("failed to download %s: %v", url, err)
+	}
+	if got := hash.Sum(nil); !bytes.Equal(got, sum) {
+		os.Remove(newPath)
+		return fmt.Errorf("checksum mismatch for %s: got %x, want %x", url, got, sum)
+	}
+
+	// A binary for the wrong platform or a truncated upload fails here, before anything is replaced
+	if out, err := exec.Command(newPath, "--version").CombinedOutput(); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("downloaded binary does not run: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("failed to move the current executable aside: %v", err)
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		if rollbackErr := os.Rename(oldPath, exe); rollbackErr != nil {
+			return fmt.Errorf("failed to install the new executable: %v; restoring the previous one also failed (it is at %s): %v", err, oldPath, rollbackErr)
+		}
+		os.Remove(newPath)
+		return fmt.Errorf("failed to install the new executable, kept the current one: %v", err)
+	}
+
+	// A running executable cannot be removed on Windows; the next update removes it
+	os.Remove(oldPath)
+	return nil
+}
+
+// versionNewer reports whether release is a newer version than current, comparing the
+// major.minor.patch of tags such as v1.4.0 (a pre-release suffix is ignored). comparable is
+// false when either is not such a version, e.g. for a dev build.
+func versionNewer(release, current string) (newer, comparable bool) {
+	r, ok1 := parseVersion(release)
+	c, ok2 := parseVersion(current)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	for i := range r {
+		if r[i] != c[i] {
+			return r[i] > c[i], true
+		}
+	}
+	return false, true
+}
+
+// parseVersion parses v1.2.3 or 1.2.3, ignoring a -pre-release or +build suffix
+func parseVersion(version string) ([3]int, bool) {
+	var parts [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	fields := strings.Split(version, ".")
+	if len(fields) != 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
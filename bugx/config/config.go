@@ -133,12 +133,117 @@ func (c *Config) LoadClusterName() (string, error) {
 	return clusterName, nil
 }
 
-// loadConfig loads the config file
-func (c *Config) loadConfig() (map[string]interface{}, error) {
-	if err := c.ensureConfigDir(); err != nil {
-		return nil, err
+// DefaultMaxConnections is the cap on simultaneously running background connections when none is configured
+const DefaultMaxConnections = 50
+
+// SaveMaxConnections saves the cap on simultaneously running background connections.
+// Zero restores the default.
+func (c *Config) SaveMaxConnections(max int) error {
+	if max < 0 {
+		return fmt.Errorf("max connections must not be negative")
+	}
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		cfg = make(map[string]interface{})
+	}
+
+	if max == 0 {
+		delete(cfg, "max_connections")
+	} else {
+		cfg["max_connections"] = max
+	}
+	return c.saveConfig(cfg)
+}
+
+// LoadMaxConnections loads the cap on simultaneously running background connections
+func (c *Config) LoadMaxConnections() int {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return DefaultMaxConnections
+	}
+
+	// JSON numbers decode as float64
+	max, ok := cfg["max_connections"].(float64)
+	if !ok || max < 1 {
+		return DefaultMaxConnections
+	}
+	return int(max)
+}
+
+// Store formats of the connections file
+const (
+	StoreFormatJSON = "json"
+	StoreFormatYAML = "yaml"
+)
+
+// SaveStoreFormat saves the format the connections file is written in. An empty format restores JSON.
+func (c *Config) SaveStoreFormat(format string) error {
+	if format != "" && format != StoreFormatJSON && format != StoreFormatYAML {
+		return fmt.Errorf("invalid store format %q (must be json or yaml)", format)
+	}
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		cfg = make(map[string]interface{})
 	}
 
+	if format == "" || format == StoreFormatJSON {
+		delete(cfg, "store_format")
+	} else {
+		cfg["store_format"] = format
+	}
+	return c.saveConfig(cfg)
+}
+
+// LoadStoreFormat loads the format the connections file is written in
+func (c *Config) LoadStoreFormat() string {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return StoreFormatJSON
+	}
+
+	if format, _ := cfg["store_format"].(string); format == StoreFormatYAML {
+		return StoreFormatYAML
+	}
+	return StoreFormatJSON
+}
+
+// DefaultUpdateURL is the release that bugx update checks when no other is configured
+const DefaultUpdateURL = "https://api.github.com/repos/behrooz/bugxcli/releases/latest"
+
+// SaveUpdateURL saves the release URL checked by bugx update. An empty URL restores the default.
+func (c *Config) SaveUpdateURL(url string) error {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		cfg = make(map[string]interface{})
+	}
+
+	if url == "" {
+		delete(cfg, "update_url")
+	} else {
+		cfg["update_url"] = url
+	}
+	return c.saveConfig(cfg)
+}
+
+// LoadUpdateURL loads the release URL checked by bugx update
+func (c *Config) LoadUpdateURL() string {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return DefaultUpdateURL
+	}
+
+	url, ok := cfg["update_url"].(string)
+	if !ok || url == "" {
+		return DefaultUpdateURL
+	}
+	return url
+}
+
+// loadConfig loads the config file
+func (c *Config) loadConfig() (map[string]interface{}, error) {
+	// Reading does not create the directory, so a read-only home still loads the defaults
 	configPath := filepath.Join(c.configDir, configFileName)
 
 	data, err := os.ReadFile(configPath)
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const profilesDirName = "profiles"
+
+// Profile holds the defaults for one environment (e.g. dev, staging, prod)
+type Profile struct {
+	Name        string `json:"-"`
+	APIURL      string `json:"api_url,omitempty"`
+	ClusterName string `json:"cluster_name,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Kubeconfig  string `json:"kubeconfig,omitempty"`
+}
+
+// profilePath returns the file a profile is stored in
+func (c *Config) profilePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	return filepath.Join(c.configDir, profilesDirName, name+".json"), nil
+}
+
+// SaveProfile saves a profile, replacing any existing profile with the same name
+func (c *Config) SaveProfile(profile Profile) error {
+	profilePath, err := c.profilePath(profile.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(profilePath), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Set restrictive permissions
+	return os.WriteFile(profilePath, data, 0600)
+}
+
+// LoadProfile loads a profile by name
+func (c *Config) LoadProfile(name string) (*Profile, error) {
+	profilePath, err := c.profilePath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("profile %q not found", name)
+		}
+		return nil, err
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %q: %v", name, err)
+	}
+	profile.Name = name
+
+	return &profile, nil
+}
+
+// ListProfiles returns the names of all saved profiles, sorted
+func (c *Config) ListProfiles() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(c.configDir, profilesDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// SaveActiveProfile sets the profile used when no --profile flag is given.
+// An empty name clears it.
+func (c *Config) SaveActiveProfile(name string) error {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		cfg = make(map[string]interface{})
+	}
+
+	if name == "" {
+		delete(cfg, "profile")
+	} else {
+		cfg["profile"] = name
+	}
+	return c.saveConfig(cfg)
+}
+
+// LoadActiveProfile loads the name of the active profile, or "" if none is set
+func (c *Config) LoadActiveProfile() (string, error) {
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return "", err
+	}
+
+	name, _ := cfg["profile"].(string)
+	return name, nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timings holds the intervals bugx waits on. Each can be overridden in the config
+// file under "timings" so slow or fast clusters can be tuned globally.
+type Timings struct {
+	ReadyTimeout   time.Duration // how long a forward may take to become ready
+	SpawnWait      time.Duration // wait after spawning a daemon before checking on it
+	SpawnCheck     time.Duration // further wait before deciding whether the daemon survived
+	StatsInterval  time.Duration // how often a daemon persists its transfer counts and health
+	RetryInterval  time.Duration // delay between reconnect attempts and service polls
+	TerminateGrace time.Duration // how long a daemon gets to exit after SIGTERM before SIGKILL
+	HealthInterval time.Duration // how often a daemon runs its --health-cmd
+	RemapTimeout   time.Duration // how long connect remap waits for the daemon to move
+}
+
+// DefaultTimings returns the timings used when none are configured
+func DefaultTimings() Timings {
+	return Timings{
+		ReadyTimeout:   10 * time.Second,
+		SpawnWait:      800 * time.Millisecond,
+		SpawnCheck:     200 * time.Millisecond,
+		StatsInterval:  10 * time.Second,
+		RetryInterval:  2 * time.Second,
+		TerminateGrace: 5 * time.Second,
+		HealthInterval: 30 * time.Second,
+		RemapTimeout:   5 * time.Second,
+	}
+}
+
+// timingFields maps the config keys of the timings to their fields
+func (t *Timings) timingFields() map[string]*time.Duration {
+	return map[string]*time.Duration{
+		"ready_timeout":   &t.ReadyTimeout,
+		"spawn_wait":      &t.SpawnWait,
+		"spawn_check":     &t.SpawnCheck,
+		"stats_interval":  &t.StatsInterval,
+		"retry_interval":  &t.RetryInterval,
+		"terminate_grace": &t.TerminateGrace,
+		"health_interval": &t.HealthInterval,
+		"remap_timeout":   &t.RemapTimeout,
+	}
+}
+
+// TimingNames returns the config keys of the tunable timings, sorted
+func TimingNames() []string {
+	var t Timings
+	var names []string
+	for name := range t.timingFields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the timing stored under a config key
+func (t Timings) Get(name string) (time.Duration, bool) {
+	field, ok := t.timingFields()[name]
+	if !ok {
+		return 0, false
+	}
+	return *field, true
+}
+
+// SaveTiming sets one timing by its config key. A zero value restores the default.
+func (c *Config) SaveTiming(name string, value time.Duration) error {
+	var t Timings
+	if _, ok := t.timingFields()[name]; !ok {
+		return fmt.Errorf("unknown timing %q", name)
+	}
+	if value < 0 {
+		return fmt.Errorf("timing %s must not be negative", name)
+	}
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		cfg = make(map[string]interface{})
+	}
+
+	timings, _ := cfg["timings"].(map[string]interface{})
+	if timings == nil {
+		timings = make(map[string]interface{})
+	}
+	if value == 0 {
+		delete(timings, name)
+	} else {
+		timings[name] = value.String()
+	}
+	if len(timings) == 0 {
+		delete(cfg, "timings")
+	} else {
+		cfg["timings"] = timings
+	}
+	return c.saveConfig(cfg)
+}
+
+// LoadTimings loads the configured timings, using the default for any that are not set
+func (c *Config) LoadTimings() (Timings, error) {
+	t := DefaultTimings()
+
+	cfg, err := c.loadConfig()
+	if err != nil {
+		return t, err
+	}
+
+	timings, _ := cfg["timings"].(map[string]interface{})
+	fields := t.timingFields()
+	for name, raw := range timings {
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value, _ := raw.(string)
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return t, fmt.Errorf("invalid timing %s %q in config", name, value)
+		}
+		*field = d
+	}
+
+	return t, nil
+}
@@ -7,8 +7,5 @@ import (
 )
 
 func main() {
-	rootCmd := cmd.NewRootCmd()
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	os.Exit(cmd.Execute())
 }